@@ -1,14 +1,20 @@
 package main
 
 import (
+	"errors"
 	"net/http"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pedrogao/log"
 	"github.com/pedrogao/orm"
+	ormsession "github.com/pedrogao/orm/session"
 	"github.com/pedrogao/web"
 )
 
+type User struct {
+	Name string
+}
+
 func main() {
 	app := web.New()
 
@@ -20,26 +26,18 @@ func main() {
 		storage.Close()
 	}()
 
-	s := storage.NewSession()
-	_, err = s.Raw("DROP TABLE IF EXISTS User;").Exec()
-	if err != nil {
-		log.Errorf("drop table User err: %s", err)
+	if err = storage.AutoMigrate(&User{}); err != nil {
+		log.Fatalf("migrate User err: %s", err)
 	}
 
-	_, err = s.Raw("CREATE TABLE User(Name text);").Exec()
-	if err != nil {
-		log.Errorf("create table User err: %s", err)
-	}
-	s.Clear()
-
 	app.GET("/", func(ctx *web.Context) {
 		ctx.String(http.StatusOK, "simple & easy")
 	})
 
 	app.POST("/users", func(ctx *web.Context) {
 		name := ctx.Query("name")
-		session := storage.NewSession()
-		_, err := session.Raw("INSERT INTO User(`Name`) values (?)", name).Exec()
+		session := storage.NewSession().WithContext(ctx.Req.Context())
+		_, err := session.Insert(&User{Name: name})
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, map[string]any{"message": err.Error()})
 			return
@@ -49,17 +47,19 @@ func main() {
 
 	app.GET("/users", func(ctx *web.Context) {
 		name := ctx.Query("name")
-		session := storage.NewSession()
-		row := session.Raw("SELECT * FROM User WHERE Name = ?", name).QueryRow()
-
-		var ret string
-		err = row.Scan(&ret)
+		session := storage.NewSession().WithContext(ctx.Req.Context())
+		var user User
+		err := session.Raw("SELECT * FROM User WHERE Name = ?", name).ScanOne(&user)
+		if errors.Is(err, ormsession.ErrRecordNotFound) {
+			ctx.JSON(http.StatusNotFound, map[string]any{"message": err.Error()})
+			return
+		}
 		if err != nil {
 			ctx.JSON(http.StatusInternalServerError, map[string]any{"message": err.Error()})
 			return
 		}
 
-		ctx.JSON(http.StatusOK, map[string]any{"name": ret})
+		ctx.JSON(http.StatusOK, map[string]any{"name": user.Name})
 	})
 
 	if err = app.Run(":3000"); err != nil {
@@ -0,0 +1,125 @@
+package orm
+
+import (
+	"fmt"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/session"
+)
+
+// MigrateOption controls the destructive changes of AutoMigrate, all disabled by default
+type MigrateOption struct {
+	DropColumns   bool // drop columns which are not declared by model
+	DropIndexes   bool // drop indexes which are not declared by model
+	RenameColumns bool // rename columns tagged by `rename_from:old`
+}
+
+// AutoMigrate creates tables, adds missing columns and indexes of models
+func (e *Engine) AutoMigrate(models ...any) error {
+	return e.AutoMigrateWith(MigrateOption{}, models...)
+}
+
+// AutoMigrateWith diffs the live schema with models, and applies changes allowed by opt
+func (e *Engine) AutoMigrateWith(opt MigrateOption, models ...any) error {
+	for _, model := range models {
+		if err := e.migrate(e.NewSession().Primary().Model(model), opt); err != nil {
+			log.Errorf("auto migrate %T err: %s", model, err)
+			return fmt.Errorf("auto migrate %T err: %s", model, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) migrate(s *session.Session, opt MigrateOption) error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+	exist, err := s.HasTable()
+	if err != nil {
+		return err
+	}
+	if !exist {
+		return s.CreateTable()
+	}
+
+	columns, err := s.Columns()
+	if err != nil {
+		return err
+	}
+	existed := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existed[column] = true
+	}
+
+	declared := make(map[string]bool, len(table.Fields))
+	for _, field := range table.Fields {
+		declared[field.Name] = true
+		if existed[field.Name] {
+			continue
+		}
+
+		if opt.RenameColumns && field.RenameFrom != "" && existed[field.RenameFrom] {
+			log.Infof("rename column %s.%s to %s", table.Name, field.RenameFrom, field.Name)
+			if err = s.RenameColumn(field.RenameFrom, field.Name); err != nil {
+				return err
+			}
+			existed[field.Name] = true
+			delete(existed, field.RenameFrom)
+			continue
+		}
+
+		log.Infof("add column %s.%s", table.Name, field.Name)
+		if err = s.AddColumn(field); err != nil {
+			return err
+		}
+	}
+
+	indexes, err := s.Indexes()
+	if err != nil {
+		return err
+	}
+	existedIndexes := make(map[string]bool, len(indexes))
+	for _, index := range indexes {
+		existedIndexes[index] = true
+	}
+	declaredIndexes := make(map[string]bool, len(table.Indexes))
+	for _, index := range table.Indexes {
+		declaredIndexes[index.Name] = true
+	}
+
+	// indexes are dropped first, sqlite refuses to drop a column in an index
+	if opt.DropIndexes {
+		for _, index := range indexes {
+			if declaredIndexes[index] {
+				continue
+			}
+			log.Infof("drop index %s on %s", index, table.Name)
+			if err = s.DropIndex(index); err != nil {
+				return err
+			}
+		}
+	}
+	if opt.DropColumns {
+		for _, column := range columns {
+			if declared[column] || !existed[column] {
+				continue
+			}
+			log.Infof("drop column %s.%s", table.Name, column)
+			if err = s.DropColumn(column); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, index := range table.Indexes {
+		if existedIndexes[index.Name] {
+			continue
+		}
+		log.Infof("create index %s on %s", index.Name, table.Name)
+		if err = s.CreateIndex(index); err != nil {
+			return err
+		}
+	}
+	return s.CreateJoinTables()
+}
@@ -0,0 +1,100 @@
+package orm
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+type memberV1 struct {
+	ID   int
+	Name string `orm:"index"`
+	Age  int
+}
+
+func (memberV1) TableName() string { return "Member" }
+
+type memberV2 struct {
+	ID    int
+	Name  string `orm:"index"`
+	Years int    `orm:"rename_from:Age"`
+	Email string `orm:"index"`
+}
+
+func (memberV2) TableName() string { return "Member" }
+
+type memberV3 struct {
+	ID    int
+	Years int
+}
+
+func (memberV3) TableName() string { return "Member" }
+
+func checkSchema(t *testing.T, e *Engine, wantColumns, wantIndexes []string) {
+	t.Helper()
+	s := e.NewSession().Model(&memberV1{})
+	columns, err := s.Columns()
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexes, err := s.Indexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(columns)
+	sort.Strings(indexes)
+	if !reflect.DeepEqual(columns, wantColumns) {
+		t.Fatalf("columns = %v, want %v", columns, wantColumns)
+	}
+	if len(indexes) != len(wantIndexes) || len(indexes) > 0 && !reflect.DeepEqual(indexes, wantIndexes) {
+		t.Fatalf("indexes = %v, want %v", indexes, wantIndexes)
+	}
+}
+
+func TestAutoMigrate(t *testing.T) {
+	e := newTestEngine(t)
+	if exist, err := e.NewSession().Model(&memberV1{}).HasTable(); err != nil || exist {
+		t.Fatalf("HasTable before migration = %v, %v", exist, err)
+	}
+	if err := e.AutoMigrate(&memberV1{}); err != nil {
+		t.Fatal(err)
+	}
+	if exist, err := e.NewSession().Model(&memberV1{}).HasTable(); err != nil || !exist {
+		t.Fatalf("HasTable after migration = %v, %v", exist, err)
+	}
+	checkSchema(t, e, []string{"Age", "ID", "Name"}, []string{"idx_Member_Name"})
+	if _, err := e.NewSession().Insert(&memberV1{ID: 1, Name: "Tom", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Age is renamed to Years, Email and its index are added
+	if err := e.AutoMigrateWith(MigrateOption{RenameColumns: true}, &memberV2{}); err != nil {
+		t.Fatal(err)
+	}
+	checkSchema(t, e, []string{"Email", "ID", "Name", "Years"}, []string{"idx_Member_Email", "idx_Member_Name"})
+	var member memberV2
+	if err := e.NewSession().Select("Name", "Years").Where("ID = ?", 1).First(&member); err != nil {
+		t.Fatal(err)
+	}
+	if member.Years != 18 || member.Name != "Tom" {
+		t.Fatalf("member after rename = %+v", member)
+	}
+
+	// nothing is dropped by default
+	if err := e.AutoMigrate(&memberV3{}); err != nil {
+		t.Fatal(err)
+	}
+	checkSchema(t, e, []string{"Email", "ID", "Name", "Years"}, []string{"idx_Member_Email", "idx_Member_Name"})
+
+	if err := e.AutoMigrateWith(MigrateOption{DropColumns: true, DropIndexes: true}, &memberV3{}); err != nil {
+		t.Fatal(err)
+	}
+	checkSchema(t, e, []string{"ID", "Years"}, nil)
+	var migrated memberV3
+	if err := e.NewSession().Where("ID = ?", 1).First(&migrated); err != nil {
+		t.Fatal(err)
+	}
+	if migrated.Years != 18 {
+		t.Fatalf("member after drop = %+v", migrated)
+	}
+}
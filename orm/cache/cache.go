@@ -0,0 +1,16 @@
+package cache
+
+import "time"
+
+// Cache caches query results, entries are tagged by tables they read
+// so that writes to a table invalidate them
+type Cache interface {
+	// Get returns the value of key, false if missing or expired
+	Get(key string) (any, bool)
+	// Set caches value of key for ttl, tagged by tags
+	Set(key string, value any, ttl time.Duration, tags ...string)
+	// Invalidate removes entries tagged by any of tags
+	Invalidate(tags ...string)
+	// Clear removes all entries
+	Clear()
+}
@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Cache evicting the least recently used entry beyond capacity
+type LRU struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	tags     map[string]map[string]struct{} // keys by tag
+	stats    Stats
+}
+
+type Stats struct {
+	Size          int
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+}
+
+type entry struct {
+	key     string
+	value   any
+	tags    []string
+	expires time.Time
+}
+
+var _ Cache = (*LRU)(nil)
+
+// NewLRU returns a LRU cache of capacity entries, unlimited if capacity isn't positive
+func NewLRU(capacity int) *LRU {
+	return &LRU{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+		tags:     make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *LRU) Get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	ent := e.Value.(*entry)
+	if !ent.expires.IsZero() && time.Now().After(ent.expires) {
+		c.removeElement(e)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	c.stats.Hits++
+	return ent.value, true
+}
+
+// Set caches value of key for ttl, never expires if ttl isn't positive
+func (c *LRU) Set(key string, value any, ttl time.Duration, tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[key]; ok {
+		c.removeElement(e)
+	}
+	ent := &entry{key: key, value: value, tags: tags}
+	if ttl > 0 {
+		ent.expires = time.Now().Add(ttl)
+	}
+	c.items[key] = c.ll.PushFront(ent)
+	for _, tag := range tags {
+		keys, ok := c.tags[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tags[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+
+	for c.capacity > 0 && c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+func (c *LRU) Invalidate(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if e, ok := c.items[key]; ok {
+				c.removeElement(e)
+				c.stats.Invalidations++
+			}
+		}
+	}
+}
+
+func (c *LRU) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Invalidations += uint64(c.ll.Len())
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.tags = make(map[string]map[string]struct{})
+}
+
+func (c *LRU) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.ll.Len()
+	return stats
+}
+
+func (c *LRU) removeElement(e *list.Element) {
+	ent := e.Value.(*entry)
+	c.ll.Remove(e)
+	delete(c.items, ent.key)
+	for _, tag := range ent.tags {
+		if keys, ok := c.tags[tag]; ok {
+			delete(keys, ent.key)
+			if len(keys) == 0 {
+				delete(c.tags, tag)
+			}
+		}
+	}
+}
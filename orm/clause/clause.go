@@ -0,0 +1,75 @@
+package clause
+
+import (
+	"strings"
+)
+
+type Type int
+
+const (
+	INSERT Type = iota
+	VALUES
+	SELECT
+	LIMIT
+	OFFSET
+	WHERE
+	GROUPBY
+	HAVING
+	ORDERBY
+	UPDATE
+	DELETE
+	COUNT
+	JOIN
+	WITH
+)
+
+// Clause builds a sql statement by parts
+type Clause struct {
+	sql     map[Type]string
+	sqlVars map[Type][]any
+}
+
+// Set generates the sql of a part
+func (c *Clause) Set(name Type, vars ...any) {
+	if c.sql == nil {
+		c.sql = make(map[Type]string)
+		c.sqlVars = make(map[Type][]any)
+	}
+	sql, vars := generators[name](vars...)
+	c.sql[name] = sql
+	c.sqlVars[name] = vars
+}
+
+// Has reports whether the part has been set
+func (c *Clause) Has(name Type) bool {
+	_, ok := c.sql[name]
+	return ok
+}
+
+// Build joins parts in orders into a sql statement, unset parts are skipped
+func (c *Clause) Build(orders ...Type) (string, []any) {
+	var sqls []string
+	var vars []any
+	for _, order := range orders {
+		if sql, ok := c.sql[order]; ok {
+			sqls = append(sqls, sql)
+			vars = append(vars, c.sqlVars[order]...)
+		}
+	}
+	return strings.Join(sqls, " "), vars
+}
+
+// Clone returns a copy of parts, which is set independently
+func (c *Clause) Clone() Clause {
+	cloned := Clause{sql: make(map[Type]string, len(c.sql)), sqlVars: make(map[Type][]any, len(c.sqlVars))}
+	for name, sql := range c.sql {
+		cloned.sql[name] = sql
+		cloned.sqlVars[name] = c.sqlVars[name]
+	}
+	return cloned
+}
+
+func (c *Clause) Reset() {
+	c.sql = nil
+	c.sqlVars = nil
+}
@@ -0,0 +1,63 @@
+package clause
+
+// Conditions accumulates the predicates of WHERE or HAVING,
+// predicates are grouped from left to right, eg. ((a) OR (b)) AND (c)
+type Conditions struct {
+	sql  string
+	conj string // last conjunction
+	vars []any
+}
+
+// And appends a predicate joined by AND
+func (c *Conditions) And(desc string, vars ...any) {
+	c.add("AND", desc, vars)
+}
+
+// Or appends a predicate joined by OR
+func (c *Conditions) Or(desc string, vars ...any) {
+	c.add("OR", desc, vars)
+}
+
+// Not appends a negated predicate joined by AND
+func (c *Conditions) Not(desc string, vars ...any) {
+	c.add("AND", "NOT ("+desc+")", vars)
+}
+
+func (c *Conditions) add(conj, desc string, vars []any) {
+	predicate := "(" + desc + ")"
+	switch {
+	case c.sql == "":
+		c.sql = predicate
+	case c.conj == "" || c.conj == conj:
+		c.sql += " " + conj + " " + predicate
+		c.conj = conj
+	default:
+		c.sql = "(" + c.sql + ") " + conj + " " + predicate
+		c.conj = conj
+	}
+	c.vars = append(c.vars, vars...)
+}
+
+func (c *Conditions) Empty() bool {
+	return c.sql == ""
+}
+
+// Build returns predicates as a desc and vars, eg. (a = ?) AND (b = ?)
+func (c *Conditions) Build() (string, []any) {
+	return c.sql, c.vars
+}
+
+func (c *Conditions) Reset() {
+	c.sql = ""
+	c.conj = ""
+	c.vars = nil
+}
+
+// In returns predicate `column IN (?, ?)` with vars
+func In(column string, vars ...any) (string, []any) {
+	if len(vars) == 0 {
+		// nothing matches an empty set
+		return "1 = 0", nil
+	}
+	return column + " IN (" + genBindVars(len(vars)) + ")", vars
+}
@@ -0,0 +1,78 @@
+package clause
+
+import (
+	"strings"
+)
+
+// Builder is a value composed into sql in place of its placeholder, eg. Expr and subqueries
+type Builder interface {
+	Build() (string, []any)
+}
+
+// Expr is a sql expression with vars, eg. Expr{SQL: "count(*) + ?", Vars: []any{1}}
+type Expr struct {
+	SQL  string
+	Vars []any
+}
+
+func (e Expr) Build() (string, []any) {
+	return Expand(e.SQL, e.Vars)
+}
+
+// Expand replaces the placeholder of each Builder in vars with its sql and splices its vars in order.
+// The sql is parenthesized unless the placeholder already is, eg. `ID IN (?)`.
+func Expand(sql string, vars []any) (string, []any) {
+	if !hasBuilder(vars) {
+		return sql, vars
+	}
+
+	var (
+		b        strings.Builder
+		expanded = make([]any, 0, len(vars))
+		quote    byte
+		n        int
+	)
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?' && n < len(vars):
+			v := vars[n]
+			n++
+			if builder, ok := v.(Builder); ok {
+				sub, subVars := builder.Build()
+				if enclosed(sql, i) {
+					b.WriteString(sub)
+				} else {
+					b.WriteString("(" + sub + ")")
+				}
+				expanded = append(expanded, subVars...)
+				continue
+			}
+			expanded = append(expanded, v)
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), append(expanded, vars[n:]...)
+}
+
+func hasBuilder(vars []any) bool {
+	for _, v := range vars {
+		if _, ok := v.(Builder); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosed reports whether the placeholder at i is the only content of parentheses
+func enclosed(sql string, i int) bool {
+	before := strings.TrimRight(sql[:i], " \t\n")
+	after := strings.TrimLeft(sql[i+1:], " \t\n")
+	return strings.HasSuffix(before, "(") && strings.HasPrefix(after, ")")
+}
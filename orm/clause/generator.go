@@ -0,0 +1,142 @@
+package clause
+
+import (
+	"fmt"
+	"strings"
+)
+
+type generator func(values ...any) (string, []any)
+
+var generators map[Type]generator
+
+func init() {
+	generators = make(map[Type]generator)
+	generators[INSERT] = _insert
+	generators[VALUES] = _values
+	generators[SELECT] = _select
+	generators[LIMIT] = _limit
+	generators[OFFSET] = _offset
+	generators[WHERE] = _where
+	generators[GROUPBY] = _groupBy
+	generators[HAVING] = _having
+	generators[ORDERBY] = _orderBy
+	generators[UPDATE] = _update
+	generators[DELETE] = _delete
+	generators[COUNT] = _count
+	generators[JOIN] = _join
+	generators[WITH] = _with
+}
+
+// genBindVars returns `?, ?, ?` for num vars
+func genBindVars(num int) string {
+	var vars []string
+	for i := 0; i < num; i++ {
+		vars = append(vars, "?")
+	}
+	return strings.Join(vars, ", ")
+}
+
+// INSERT INTO $tableName ($fields)
+func _insert(values ...any) (string, []any) {
+	tableName := values[0]
+	fields := strings.Join(values[1].([]string), ", ")
+	return fmt.Sprintf("INSERT INTO %s (%v)", tableName, fields), []any{}
+}
+
+// VALUES ($v1), ($v2), ...
+func _values(values ...any) (string, []any) {
+	var (
+		bindStr string
+		sql     strings.Builder
+		vars    []any
+	)
+	sql.WriteString("VALUES ")
+	for i, value := range values {
+		v := value.([]any)
+		if bindStr == "" {
+			bindStr = genBindVars(len(v))
+		}
+		sql.WriteString(fmt.Sprintf("(%v)", bindStr))
+		if i+1 != len(values) {
+			sql.WriteString(", ")
+		}
+		vars = append(vars, v...)
+	}
+	return sql.String(), vars
+}
+
+// SELECT $fields FROM $tableName
+func _select(values ...any) (string, []any) {
+	tableName := values[0]
+	fields := strings.Join(values[1].([]string), ", ")
+	return fmt.Sprintf("SELECT %v FROM %s", fields, tableName), []any{}
+}
+
+// LIMIT $num
+func _limit(values ...any) (string, []any) {
+	return "LIMIT ?", values
+}
+
+// OFFSET $num
+func _offset(values ...any) (string, []any) {
+	return "OFFSET ?", values
+}
+
+// WHERE $desc
+func _where(values ...any) (string, []any) {
+	desc, vars := values[0], values[1:]
+	return fmt.Sprintf("WHERE %s", desc), vars
+}
+
+// GROUP BY $fields
+func _groupBy(values ...any) (string, []any) {
+	return fmt.Sprintf("GROUP BY %s", strings.Join(values[0].([]string), ", ")), []any{}
+}
+
+// HAVING $desc
+func _having(values ...any) (string, []any) {
+	desc, vars := values[0], values[1:]
+	return fmt.Sprintf("HAVING %s", desc), vars
+}
+
+// ORDER BY $desc
+func _orderBy(values ...any) (string, []any) {
+	return fmt.Sprintf("ORDER BY %s", values[0]), []any{}
+}
+
+// UPDATE $tableName SET $k1 = ?, $k2 = ?
+func _update(values ...any) (string, []any) {
+	tableName := values[0]
+	columns := values[1].([]string)
+	vars := values[2].([]any)
+	var keys []string
+	for _, column := range columns {
+		keys = append(keys, column+" = ?")
+	}
+	return fmt.Sprintf("UPDATE %s SET %s", tableName, strings.Join(keys, ", ")), vars
+}
+
+// DELETE FROM $tableName
+func _delete(values ...any) (string, []any) {
+	return fmt.Sprintf("DELETE FROM %s", values[0]), []any{}
+}
+
+// SELECT count(*) FROM $tableName
+func _count(values ...any) (string, []any) {
+	return _select(values[0], []string{"count(*)"})
+}
+
+// $join1 $join2
+func _join(values ...any) (string, []any) {
+	return strings.Join(values[0].([]string), " "), values[1:]
+}
+
+// WITH $name1 AS (?), $name2 AS (?)
+func _with(values ...any) (string, []any) {
+	names := values[0].([]string)
+	ctes := make([]string, 0, len(names))
+	for _, name := range names {
+		ctes = append(ctes, name+" AS (?)")
+	}
+	return fmt.Sprintf("WITH %s", strings.Join(ctes, ", ")), values[1:]
+}
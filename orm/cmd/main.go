@@ -6,8 +6,14 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pedrogao/log"
 	"github.com/pedrogao/orm"
+	"github.com/pedrogao/orm/migrate"
+	"github.com/pedrogao/orm/session"
 )
 
+type User struct {
+	Name string
+}
+
 func main() {
 	engine, err := orm.NewEngine("sqlite3", "test.db")
 	if err != nil {
@@ -16,11 +22,28 @@ func main() {
 
 	defer engine.Close()
 
-	s := engine.NewSession()
-	_, _ = s.Raw("DROP TABLE IF EXISTS User;").Exec()
-	_, _ = s.Raw("CREATE TABLE User(Name text);").Exec()
-	_, _ = s.Raw("CREATE TABLE User(Name text);").Exec()
-	result, _ := s.Raw("INSERT INTO User(`Name`) values (?), (?)", "Tom", "Sam").Exec()
-	count, _ := result.RowsAffected()
+	m := migrate.New(engine)
+	_ = m.Add(&migrate.Migration{
+		Version: 1,
+		Name:    "create_user",
+		Up: func(s *session.Session) error {
+			return s.Model(&User{}).CreateTable()
+		},
+		Down: func(s *session.Session) error {
+			return s.Model(&User{}).DropTable()
+		},
+	})
+	if err = m.Up(); err != nil {
+		log.Fatal(err)
+	}
+
+	s := engine.NewSession().Model(&User{})
+	count, _ := s.Insert(&User{Name: "Tom"}, &User{Name: "Sam"})
 	fmt.Printf("Exec success, %d affected\n", count)
+
+	var users []User
+	if err = s.Where("Name = ?", "Tom").Find(&users); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Find users: %+v\n", users)
 }
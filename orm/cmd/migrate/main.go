@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm"
+	"github.com/pedrogao/orm/migrate"
+)
+
+const usage = `usage: migrate [flags] command
+
+commands:
+  up           apply all pending migrations
+  down N       revert the last N migrations, 1 by default
+  status       show status of migrations
+  create NAME  create up and down sql files of a new migration
+
+flags:
+`
+
+func main() {
+	driver := flag.String("driver", "sqlite3", "database driver")
+	source := flag.String("source", "test.db", "data source name")
+	dir := flag.String("dir", "migrations", "directory of sql migrations")
+	dryRun := flag.Bool("dry-run", false, "print migrations instead of applying them")
+	flag.Usage = func() {
+		_, _ = fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if args[0] == "create" {
+		if len(args) < 2 {
+			log.Fatal("migration name is required")
+		}
+		up, down, err := migrate.Create(*dir, args[1])
+		if err != nil {
+			log.Fatalf("create migration err: %s", err)
+		}
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return
+	}
+
+	engine, err := orm.NewEngine(*driver, *source)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer engine.Close()
+
+	var opts []migrate.Option
+	if *dryRun {
+		opts = append(opts, migrate.WithDryRun(os.Stdout))
+	}
+	m := migrate.New(engine, opts...)
+	if err = m.LoadDir(*dir); err != nil {
+		log.Fatalf("load migrations err: %s", err)
+	}
+
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		n := 1
+		if len(args) > 1 {
+			if n, err = strconv.Atoi(args[1]); err != nil || n < 1 {
+				log.Fatalf("invalid number of migrations: %s", args[1])
+			}
+		}
+		err = m.Down(n)
+	case "status":
+		var statuses []migrate.Status
+		if statuses, err = m.Status(); err == nil {
+			for _, status := range statuses {
+				appliedAt := "pending"
+				if status.Applied {
+					appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%-40s %s\n", status.Migration, appliedAt)
+			}
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("migrate %s err: %s", args[0], err)
+	}
+}
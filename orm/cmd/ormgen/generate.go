@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"text/template"
+)
+
+var tmpl = template.Must(template.New("ormgen").Parse(`// Code generated by ormgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	"{{.}}"
+{{- end}}
+
+	"github.com/pedrogao/orm/field"
+	"github.com/pedrogao/orm/session"
+)
+{{range .Models}}{{$m := .}}
+{{- if $.Structs}}
+type {{.Name}} struct {
+{{- range .Columns}}
+	{{.Field}} {{.Type}}{{if .Tag}} ` + "`" + `orm:"{{.Tag}}"` + "`" + `{{end}}
+{{- end}}
+}
+
+func ({{.Name}}) TableName() string {
+	return {{printf "%q" .Table}}
+}
+{{end}}
+// {{.Name}}Table is the table of {{.Name}}
+const {{.Name}}Table = {{printf "%q" .Table}}
+
+// columns of {{.Name}}
+const (
+{{- range .Columns}}
+	{{$m.Name}}Column{{.Field}} = {{printf "%q" .Name}}
+{{- end}}
+)
+
+// {{.Name}}Columns are typed columns of {{.Name}}, eg. {{.Name}}Columns.{{(index .Columns 0).Field}}.Eq(v)
+var {{.Name}}Columns = struct {
+{{- range .Columns}}
+	{{.Field}} field.Field[{{.Type}}]
+{{- end}}
+}{
+{{- range .Columns}}
+	{{.Field}}: field.New[{{.Type}}]({{$m.Name}}Column{{.Field}}),
+{{- end}}
+}
+
+// {{.Name}}Query is a typed query of {{.Name}}
+type {{.Name}}Query struct {
+	s *session.Session
+}
+
+// Query{{.Name}} starts a typed query of {{.Name}} on s
+func Query{{.Name}}(s *session.Session) *{{.Name}}Query {
+	return &{{.Name}}Query{s: s.Model(&{{.Name}}{})}
+}
+
+// Session returns the underlying session
+func (q *{{.Name}}Query) Session() *session.Session {
+	return q.s
+}
+
+// Where appends predicates joined by AND
+func (q *{{.Name}}Query) Where(preds ...field.Predicate) *{{.Name}}Query {
+	field.Where(q.s, preds...)
+	return q
+}
+
+func (q *{{.Name}}Query) OrderBy(orders ...field.Order) *{{.Name}}Query {
+	field.OrderBy(q.s, orders...)
+	return q
+}
+
+func (q *{{.Name}}Query) Limit(num int) *{{.Name}}Query {
+	q.s.Limit(num)
+	return q
+}
+
+func (q *{{.Name}}Query) Offset(num int) *{{.Name}}Query {
+	q.s.Offset(num)
+	return q
+}
+
+// AllowGlobal allows Update or Delete without predicates
+func (q *{{.Name}}Query) AllowGlobal() *{{.Name}}Query {
+	q.s.AllowGlobal()
+	return q
+}
+
+func (q *{{.Name}}Query) Find() ([]*{{.Name}}, error) {
+	var list []*{{.Name}}
+	if err := q.s.Find(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// First returns the first record, session.ErrRecordNotFound if none
+func (q *{{.Name}}Query) First() (*{{.Name}}, error) {
+	var obj {{.Name}}
+	if err := q.s.First(&obj); err != nil {
+		return nil, err
+	}
+	return &obj, nil
+}
+
+func (q *{{.Name}}Query) Count() (int64, error) {
+	return q.s.Count()
+}
+
+// Create inserts objs, the generated primary key is written back if only one is inserted
+func (q *{{.Name}}Query) Create(objs ...*{{.Name}}) (int64, error) {
+	values := make([]any, 0, len(objs))
+	for _, obj := range objs {
+		values = append(values, obj)
+	}
+	return q.s.Insert(values...)
+}
+
+// Update updates matched records by columns, eg. {{.Name}}Column{{(index .Columns 0).Field}}: v
+func (q *{{.Name}}Query) Update(values map[string]any) (int64, error) {
+	return q.s.Update(values)
+}
+
+func (q *{{.Name}}Query) Delete() (int64, error) {
+	return q.s.Delete()
+}
+{{end}}`))
+
+func generate(f *file) ([]byte, error) {
+	for _, m := range f.Models {
+		if len(m.Columns) == 0 {
+			return nil, fmt.Errorf("model %s has no column", m.Name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, f); err != nil {
+		return nil, err
+	}
+	code, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format err: %s\n%s", err, buf.Bytes())
+	}
+	return code, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/pedrogao/log"
+)
+
+const usage = `usage: ormgen [flags] FILE.go
+       ormgen -sqlite DB -pkg NAME [flags]
+
+generates typed columns, predicates and queries of orm models in FILE.go,
+or generates models with them from tables of a sqlite database
+
+flags:
+`
+
+func main() {
+	types := flag.String("types", "", "comma separated models to generate, all exported structs by default")
+	out := flag.String("out", "", "output file, FILE_gen.go by default, stdout for sqlite")
+	sqlite := flag.String("sqlite", "", "sqlite database to reverse-engineer models from")
+	tables := flag.String("tables", "", "comma separated tables of sqlite, all tables by default")
+	pkg := flag.String("pkg", "models", "package of models generated from sqlite")
+	flag.Usage = func() {
+		_, _ = fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var (
+		file *file
+		err  error
+	)
+	if *sqlite != "" {
+		file, err = reverseSQLite(*sqlite, splitList(*tables), *pkg)
+	} else {
+		if flag.NArg() != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		src := flag.Arg(0)
+		file, err = parseFile(src, splitList(*types))
+		if *out == "" {
+			*out = strings.TrimSuffix(src, filepath.Ext(src)) + "_gen.go"
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code, err := generate(file)
+	if err != nil {
+		log.Fatalf("generate err: %s", err)
+	}
+	if *out == "" {
+		_, _ = os.Stdout.Write(code)
+		return
+	}
+	if err = os.WriteFile(*out, code, 0o644); err != nil {
+		log.Fatalf("write %s err: %s", *out, err)
+	}
+	fmt.Printf("generated %s\n", *out)
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
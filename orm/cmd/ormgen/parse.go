@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/schema"
+)
+
+// file is the generated file of models
+type file struct {
+	Package string
+	Imports []string // import paths used by column types
+	Models  []*model
+	Structs bool // whether structs of models are generated too
+}
+
+type model struct {
+	Name    string // go type name
+	Table   string
+	Columns []*column
+}
+
+type column struct {
+	Field string // go field name
+	Name  string // column name
+	Type  string // go type of field, pointer dereferenced
+	Tag   string // orm tag of generated struct
+}
+
+// parseFile parses models of go source file, all exported structs if types is empty
+func parseFile(path string, types []string) (*file, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s err: %s", path, err)
+	}
+
+	p := &fileParser{
+		fset:    fset,
+		structs: map[string]*ast.StructType{},
+		tables:  map[string]string{},
+		imports: map[string]string{},
+		used:    map[string]bool{},
+
+		embedded: map[string]bool{},
+	}
+	p.collect(f)
+
+	out := &file{Package: f.Name.Name}
+	var names []string
+	if len(types) > 0 {
+		names = types
+	} else {
+		for name := range p.structs {
+			// structs only embedded by models aren't models
+			if ast.IsExported(name) && !p.embedded[name] {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		st, ok := p.structs[name]
+		if !ok {
+			return nil, fmt.Errorf("struct %s not found in %s", name, path)
+		}
+		m := &model{Name: name, Table: name}
+		if table, ok := p.tables[name]; ok {
+			m.Table = table
+		}
+		p.columns(m, st)
+		out.Models = append(out.Models, m)
+	}
+
+	for name := range p.used {
+		if path, ok := p.imports[name]; ok {
+			out.Imports = append(out.Imports, path)
+		}
+	}
+	sort.Strings(out.Imports)
+	return out, nil
+}
+
+type fileParser struct {
+	fset    *token.FileSet
+	structs map[string]*ast.StructType
+	tables  map[string]string // table names returned by TableName methods
+	imports map[string]string // import paths by package name
+	used    map[string]bool   // package names used by column types
+
+	embedded map[string]bool // structs embedded by others
+}
+
+func (p *fileParser) collect(f *ast.File) {
+	for _, spec := range f.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		p.imports[name] = path
+	}
+
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				if ts, ok := spec.(*ast.TypeSpec); ok {
+					if st, ok := ts.Type.(*ast.StructType); ok {
+						p.structs[ts.Name.Name] = st
+						p.collectEmbedded(st)
+					}
+				}
+			}
+		case *ast.FuncDecl:
+			if table, ok := tableName(d); ok {
+				p.tables[receiverName(d)] = table
+			}
+		}
+	}
+}
+
+func (p *fileParser) collectEmbedded(st *ast.StructType) {
+	for _, f := range st.Fields.List {
+		if len(f.Names) > 0 {
+			continue
+		}
+		typ := f.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if ident, ok := typ.(*ast.Ident); ok {
+			p.embedded[ident.Name] = true
+		}
+	}
+}
+
+// columns appends columns of struct to m, embedded structs of the file are flattened,
+// associations and ignored fields are skipped
+func (p *fileParser) columns(m *model, st *ast.StructType) {
+	for _, f := range st.Fields.List {
+		var tag string
+		if f.Tag != nil {
+			raw, _ := strconv.Unquote(f.Tag.Value)
+			tag = reflect.StructTag(raw).Get(schema.TagName)
+		}
+		if tag == "-" {
+			continue
+		}
+
+		typ := f.Type
+		if star, ok := typ.(*ast.StarExpr); ok {
+			typ = star.X
+		}
+		if len(f.Names) == 0 {
+			if ident, ok := typ.(*ast.Ident); ok && p.structs[ident.Name] != nil {
+				p.columns(m, p.structs[ident.Name])
+			} else {
+				log.Warnf("%s: embedded %s skipped, only structs of the same file are flattened", m.Name, p.expr(f.Type))
+			}
+			continue
+		}
+		if !strings.Contains(tag, "type:") && p.isAssociation(typ, tag) {
+			continue
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			c := &column{Field: name.Name, Name: name.Name, Type: p.expr(typ)}
+			for _, option := range strings.Split(tag, ";") {
+				if key, value, ok := strings.Cut(strings.TrimSpace(option), ":"); ok && strings.TrimSpace(key) == "column" {
+					c.Name = strings.TrimSpace(value)
+				}
+			}
+			p.use(typ)
+			m.Columns = append(m.Columns, c)
+		}
+	}
+}
+
+// isAssociation reports whether a field of typ is an association like schema does, that's a struct
+// or a slice of structs, pointers or not. Structs of the file are known, structs of other packages
+// aren't, so they're associations only if tagged with a kind of relationship, eg. has_many.
+func (p *fileParser) isAssociation(typ ast.Expr, tag string) bool {
+	if t, ok := typ.(*ast.ArrayType); ok && t.Len == nil {
+		typ = t.Elt
+	}
+	for {
+		star, ok := typ.(*ast.StarExpr)
+		if !ok {
+			break
+		}
+		typ = star.X
+	}
+	switch t := typ.(type) {
+	case *ast.Ident:
+		return p.structs[t.Name] != nil
+	case *ast.SelectorExpr:
+		for _, kind := range []string{"has_one", "has_many", "belongs_to", "many2many"} {
+			if strings.Contains(tag, kind) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *fileParser) use(typ ast.Expr) {
+	ast.Inspect(typ, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				p.used[ident.Name] = true
+			}
+		}
+		return true
+	})
+}
+
+func (p *fileParser) expr(e ast.Expr) string {
+	var buf bytes.Buffer
+	_ = printer.Fprint(&buf, p.fset, e)
+	return buf.String()
+}
+
+// tableName returns the literal returned by method TableName
+func tableName(fn *ast.FuncDecl) (string, bool) {
+	if fn.Name.Name != "TableName" || fn.Recv == nil || fn.Body == nil || len(fn.Body.List) != 1 {
+		return "", false
+	}
+	ret, ok := fn.Body.List[0].(*ast.ReturnStmt)
+	if !ok || len(ret.Results) != 1 {
+		return "", false
+	}
+	lit, ok := ret.Results[0].(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	table, err := strconv.Unquote(lit.Value)
+	return table, err == nil
+}
+
+func receiverName(fn *ast.FuncDecl) string {
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if ident, ok := typ.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const modelsSrc = `package models
+
+import (
+	"database/sql"
+	"time"
+
+	"example.com/other"
+)
+
+type User struct {
+	ID       int
+	Tags     []string
+	Scores   [3]int
+	Data     []byte
+	Name     sql.NullString
+	Birthday *time.Time
+	Orders   []*Order
+	Profile  Profile
+	Groups   []other.Group ` + "`orm:\"many2many:user_groups\"`" + `
+	Owner    *other.User   ` + "`orm:\"belongs_to\"`" + `
+}
+
+type Order struct {
+	ID     int
+	UserID int
+}
+
+type Profile struct {
+	ID     int
+	UserID int
+}
+`
+
+func TestParseFileAssociations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "models.go")
+	if err := os.WriteFile(path, []byte(modelsSrc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := parseFile(path, []string{"User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var columns []string
+	for _, c := range f.Models[0].Columns {
+		columns = append(columns, c.Field)
+	}
+	want := []string{"ID", "Tags", "Scores", "Data", "Name", "Birthday"}
+	if !reflect.DeepEqual(columns, want) {
+		t.Fatalf("columns = %v, want %v", columns, want)
+	}
+}
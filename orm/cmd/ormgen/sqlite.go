@@ -0,0 +1,160 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// reverseSQLite generates models of tables in a sqlite database, all tables if tables is empty
+func reverseSQLite(path string, tables []string, pkg string) (*file, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open %s err: %s", path, err)
+	}
+	defer db.Close()
+
+	if len(tables) == 0 {
+		if tables, err = sqliteTables(db); err != nil {
+			return nil, err
+		}
+	}
+
+	out := &file{Package: pkg, Structs: true}
+	imports := map[string]bool{}
+	for _, table := range tables {
+		m, err := sqliteModel(db, table)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range m.Columns {
+			switch {
+			case strings.HasPrefix(c.Type, "sql."):
+				imports["database/sql"] = true
+			case c.Type == "time.Time":
+				imports["time"] = true
+			}
+		}
+		out.Models = append(out.Models, m)
+	}
+	for path := range imports {
+		out.Imports = append(out.Imports, path)
+	}
+	sort.Strings(out.Imports)
+	return out, nil
+}
+
+func sqliteTables(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("list tables err: %s", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err = rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+func sqliteModel(db *sql.DB, table string) (*model, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%q)", table))
+	if err != nil {
+		return nil, fmt.Errorf("table info of %s err: %s", table, err)
+	}
+	defer rows.Close()
+
+	m := &model{Name: goName(table), Table: table}
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, typ        string
+			dflt             sql.NullString
+		)
+		if err = rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return nil, err
+		}
+
+		c := &column{Field: goName(name), Name: name, Type: goType(typ, notNull == 0 && pk == 0)}
+		var options []string
+		if c.Field != name {
+			options = append(options, "column:"+name)
+		}
+		if pk > 0 {
+			options = append(options, "primary_key")
+			if strings.EqualFold(typ, "INTEGER") {
+				// INTEGER PRIMARY KEY is an alias of rowid, generated if not given
+				options = append(options, "auto_increment")
+			}
+		} else if notNull != 0 {
+			options = append(options, "not_null")
+		}
+		c.Tag = strings.Join(options, ";")
+		m.Columns = append(m.Columns, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(m.Columns) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return m, nil
+}
+
+// goType maps a sqlite column type to go type by the rules of type affinity,
+// nullable columns are mapped to sql.Null* types
+func goType(typ string, nullable bool) string {
+	t := strings.ToUpper(typ)
+	var goType, nullType string
+	switch {
+	case strings.Contains(t, "INT"):
+		goType, nullType = "int64", "sql.NullInt64"
+	case strings.Contains(t, "CHAR"), strings.Contains(t, "CLOB"), strings.Contains(t, "TEXT"):
+		goType, nullType = "string", "sql.NullString"
+	case t == "", strings.Contains(t, "BLOB"):
+		return "[]byte"
+	case strings.Contains(t, "BOOL"):
+		goType, nullType = "bool", "sql.NullBool"
+	case strings.Contains(t, "DATE"), strings.Contains(t, "TIME"):
+		goType, nullType = "time.Time", "sql.NullTime"
+	default:
+		goType, nullType = "float64", "sql.NullFloat64"
+	}
+	if nullable {
+		return nullType
+	}
+	return goType
+}
+
+var initialisms = map[string]string{
+	"id": "ID", "url": "URL", "uri": "URI", "api": "API", "http": "HTTP",
+	"json": "JSON", "sql": "SQL", "uuid": "UUID", "ip": "IP",
+}
+
+// goName converts a table or column name into an exported go name, eg. user_id to UserID
+func goName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var sb strings.Builder
+	for _, word := range words {
+		if initialism, ok := initialisms[strings.ToLower(word)]; ok {
+			sb.WriteString(initialism)
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		sb.WriteString(string(runes))
+	}
+	if s := sb.String(); s != "" && !unicode.IsDigit([]rune(s)[0]) {
+		return s
+	}
+	return "X" + sb.String()
+}
@@ -0,0 +1,98 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/session"
+)
+
+var ErrDatabaseNotFound = errors.New("database not found")
+
+// Databases resolves engines by name, eg. a database per tenant
+type Databases struct {
+	mu      sync.RWMutex
+	engines map[string]*Engine
+}
+
+func NewDatabases() *Databases {
+	return &Databases{engines: map[string]*Engine{}}
+}
+
+// Register adds engine as database name, the engine registered before is replaced
+func (d *Databases) Register(name string, engine *Engine) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.engines[name] = engine
+}
+
+// Remove removes database name, the engine isn't closed
+func (d *Databases) Remove(name string) *Engine {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	engine := d.engines[name]
+	delete(d.engines, name)
+	return engine
+}
+
+func (d *Databases) Engine(name string) (*Engine, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	engine, ok := d.engines[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrDatabaseNotFound, name)
+	}
+	return engine, nil
+}
+
+// Session returns a new session of database name
+func (d *Databases) Session(name string) (*session.Session, error) {
+	engine, err := d.Engine(name)
+	if err != nil {
+		return nil, err
+	}
+	return engine.NewSession(), nil
+}
+
+// SessionContext returns a new session of the database named in ctx by WithDatabase
+func (d *Databases) SessionContext(ctx context.Context) (*session.Session, error) {
+	name, ok := DatabaseFrom(ctx)
+	if !ok {
+		return nil, fmt.Errorf("%w: no database in context", ErrDatabaseNotFound)
+	}
+	s, err := d.Session(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.WithContext(ctx), nil
+}
+
+// Close closes all engines
+func (d *Databases) Close() (err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for name, engine := range d.engines {
+		if e := engine.Close(); e != nil {
+			log.Errorf("close database %s err: %s", name, e)
+			err = e
+		}
+	}
+	d.engines = map[string]*Engine{}
+	return
+}
+
+type databaseKey struct{}
+
+// WithDatabase returns a copy of ctx naming the database, eg. the tenant of a request
+func WithDatabase(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, databaseKey{}, name)
+}
+
+// DatabaseFrom returns the database named in ctx
+func DatabaseFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(databaseKey{}).(string)
+	return name, ok
+}
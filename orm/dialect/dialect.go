@@ -0,0 +1,107 @@
+package dialect
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var dialectsMap = map[string]Dialect{}
+
+var ErrUnsupportedType = errors.New("unsupported sql type")
+
+// Dialect adapts the orm to the SQL flavor of a database driver
+type Dialect interface {
+	// DataTypeOf maps a go value to the column type of the database,
+	// ErrUnsupportedType is returned if the kind of value has no column type
+	DataTypeOf(typ reflect.Value) (string, error)
+	// Quote quotes an identifier, eg. table or column name
+	Quote(name string) string
+	// Rebind rewrites `?` placeholders into the driver's bind variables
+	Rebind(query string) string
+	// AutoIncrementSQL returns the column definition of an auto increment primary key
+	AutoIncrementSQL(dataType string) string
+	// TableExistSQL returns sql and vars to check whether a table exists
+	TableExistSQL(tableName string) (string, []any)
+	// IndexesSQL returns sql and vars to list names of indexes created on a table,
+	// indexes implied by primary key or unique constraints are excluded if possible
+	IndexesSQL(tableName string) (string, []any)
+	// DropIndexSQL returns sql to drop an index of a table
+	DropIndexSQL(tableName, indexName string) string
+	// UpsertSQL returns the conflict clause appended to an INSERT statement,
+	// columns in updates are overwritten by the inserted values on conflict
+	UpsertSQL(conflicts, updates []string) string
+	// ReturningSQL returns the RETURNING clause, empty if not supported
+	ReturningSQL(columns []string) string
+	// MaxPlaceholders returns the max number of bind variables in one statement
+	MaxPlaceholders() int
+}
+
+func RegisterDialect(name string, dialect Dialect) {
+	dialectsMap[name] = dialect
+}
+
+func GetDialect(name string) (dialect Dialect, ok bool) {
+	dialect, ok = dialectsMap[name]
+	return
+}
+
+// quoteAll quotes every name with dialect
+func quoteAll(d Dialect, names []string) []string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, d.Quote(name))
+	}
+	return quoted
+}
+
+// quoteWith wraps name by quote, the quote inside name is escaped by doubling it
+func quoteWith(name, quote string) string {
+	// table.column should be quoted as "table"."column"
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quote + strings.ReplaceAll(part, quote, quote+quote) + quote
+	}
+	return strings.Join(parts, ".")
+}
+
+// rebindDollar rewrites `?` into `$1`, `$2`..., placeholders inside
+// string literals and quoted identifiers are left untouched
+func rebindDollar(query string) string {
+	if strings.IndexByte(query, '?') < 0 {
+		return query
+	}
+
+	var (
+		sb    strings.Builder
+		n     int
+		quote byte
+	)
+	sb.Grow(len(query) + 8)
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '?':
+			n++
+			sb.WriteByte('$')
+			sb.WriteString(strconv.Itoa(n))
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// Locker is implemented by dialects supporting session level advisory locks,
+// the lock and unlock statements must be executed on the same connection
+type Locker interface {
+	LockSQL(name string) (string, []any)
+	UnlockSQL(name string) (string, []any)
+}
@@ -0,0 +1,125 @@
+package dialect
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func mustDialect(t *testing.T, name string) Dialect {
+	t.Helper()
+	d, ok := GetDialect(name)
+	if !ok {
+		t.Fatalf("dialect %s not registered", name)
+	}
+	return d
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		dialect, name, want string
+	}{
+		{"sqlite3", "User", `"User"`},
+		{"sqlite3", "User.Name", `"User"."Name"`},
+		{"sqlite3", `we"ird`, `"we""ird"`},
+		{"postgres", "User.Name", `"User"."Name"`},
+		{"pgx", "User", `"User"`},
+		{"mysql", "User", "`User`"},
+		{"mysql", "User.Name", "`User`.`Name`"},
+		{"mysql", "we`ird", "`we``ird`"},
+		{"pedrodb", "User", `"User"`},
+	}
+	for _, tt := range tests {
+		if got := mustDialect(t, tt.dialect).Quote(tt.name); got != tt.want {
+			t.Errorf("%s.Quote(%q) = %s, want %s", tt.dialect, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		dialect, query, want string
+	}{
+		{"sqlite3", "SELECT * FROM User WHERE Name = ? AND Age > ?", "SELECT * FROM User WHERE Name = ? AND Age > ?"},
+		{"mysql", "SELECT * FROM User WHERE Name = ?", "SELECT * FROM User WHERE Name = ?"},
+		{"postgres", "SELECT * FROM User", "SELECT * FROM User"},
+		{"postgres", "SELECT * FROM User WHERE Name = ? AND Age > ?", "SELECT * FROM User WHERE Name = $1 AND Age > $2"},
+		{"postgres", `SELECT '?' FROM "a?" WHERE Name = ?`, `SELECT '?' FROM "a?" WHERE Name = $1`},
+		{"postgres", "SELECT `?`, ? FROM User", "SELECT `?`, $1 FROM User"},
+	}
+	for _, tt := range tests {
+		if got := mustDialect(t, tt.dialect).Rebind(tt.query); got != tt.want {
+			t.Errorf("%s.Rebind(%q) = %s, want %s", tt.dialect, tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestDataTypeOf(t *testing.T) {
+	values := []any{true, int8(0), int16(0), int32(0), 0, int64(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0), "", []byte{}, time.Time{}}
+	tests := map[string][]string{
+		"sqlite3": {"bool", "integer", "integer", "integer", "integer", "bigint", "integer", "integer", "integer",
+			"bigint", "real", "real", "text", "blob", "datetime"},
+		"mysql": {"boolean", "tinyint", "smallint", "int", "bigint", "bigint", "tinyint unsigned", "smallint unsigned",
+			"int unsigned", "bigint unsigned", "float", "double", "varchar(255)", "longblob", "datetime(3)"},
+		"postgres": {"boolean", "smallint", "smallint", "integer", "bigint", "bigint", "smallint", "integer", "bigint",
+			"bigint", "real", "double precision", "text", "bytea", "timestamp with time zone"},
+	}
+	for name, want := range tests {
+		d := mustDialect(t, name)
+		for i, v := range values {
+			if got, err := d.DataTypeOf(reflect.ValueOf(v)); err != nil || got != want[i] {
+				t.Errorf("%s.DataTypeOf(%T) = %s, %v, want %s", name, v, got, err, want[i])
+			}
+		}
+		for _, v := range []any{map[string]int{}, make(chan int), struct{}{}} {
+			if _, err := d.DataTypeOf(reflect.ValueOf(v)); !errors.Is(err, ErrUnsupportedType) {
+				t.Errorf("%s.DataTypeOf(%T) err = %v, want ErrUnsupportedType", name, v, err)
+			}
+		}
+	}
+}
+
+func TestUpsertSQL(t *testing.T) {
+	tests := []struct {
+		dialect            string
+		conflicts, updates []string
+		want               string
+	}{
+		{"sqlite3", []string{"ID"}, []string{"Name", "Age"},
+			`ON CONFLICT ("ID") DO UPDATE SET "Name" = excluded."Name", "Age" = excluded."Age"`},
+		{"sqlite3", []string{"ID"}, nil, `ON CONFLICT ("ID") DO NOTHING`},
+		{"sqlite3", nil, nil, `ON CONFLICT DO NOTHING`},
+		{"postgres", []string{"ID", "Email"}, []string{"Name"},
+			`ON CONFLICT ("ID", "Email") DO UPDATE SET "Name" = excluded."Name"`},
+		{"mysql", []string{"ID"}, []string{"Name", "Age"},
+			"ON DUPLICATE KEY UPDATE `Name` = VALUES(`Name`), `Age` = VALUES(`Age`)"},
+		{"mysql", []string{"ID"}, nil, "ON DUPLICATE KEY UPDATE `ID` = `ID`"},
+		{"mysql", nil, nil, ""},
+	}
+	for _, tt := range tests {
+		if got := mustDialect(t, tt.dialect).UpsertSQL(tt.conflicts, tt.updates); got != tt.want {
+			t.Errorf("%s.UpsertSQL(%v, %v) = %s, want %s", tt.dialect, tt.conflicts, tt.updates, got, tt.want)
+		}
+	}
+}
+
+func TestReturningSQL(t *testing.T) {
+	tests := []struct {
+		dialect string
+		columns []string
+		want    string
+	}{
+		{"sqlite3", []string{"ID"}, `RETURNING "ID"`},
+		{"sqlite3", nil, ""},
+		{"postgres", []string{"ID", "CreatedAt"}, `RETURNING "ID", "CreatedAt"`},
+		{"mysql", []string{"ID"}, ""},
+		{"pedrodb", []string{"ID"}, ""},
+	}
+	for _, tt := range tests {
+		if got := mustDialect(t, tt.dialect).ReturningSQL(tt.columns); got != tt.want {
+			t.Errorf("%s.ReturningSQL(%v) = %s, want %s", tt.dialect, tt.columns, got, tt.want)
+		}
+	}
+}
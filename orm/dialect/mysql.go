@@ -0,0 +1,120 @@
+package dialect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type mysql struct{}
+
+var _ Dialect = (*mysql)(nil) // must implement Dialect
+
+func init() {
+	RegisterDialect("mysql", &mysql{})
+}
+
+func (m *mysql) DataTypeOf(typ reflect.Value) (string, error) {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8:
+		return "tinyint", nil
+	case reflect.Int16:
+		return "smallint", nil
+	case reflect.Int32:
+		return "int", nil
+	case reflect.Int, reflect.Int64:
+		return "bigint", nil
+	case reflect.Uint8:
+		return "tinyint unsigned", nil
+	case reflect.Uint16:
+		return "smallint unsigned", nil
+	case reflect.Uint32:
+		return "int unsigned", nil
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return "bigint unsigned", nil
+	case reflect.Float32:
+		return "float", nil
+	case reflect.Float64:
+		return "double", nil
+	case reflect.String:
+		// text can't be used as key without a prefix length
+		return "varchar(255)", nil
+	case reflect.Array, reflect.Slice:
+		return "longblob", nil
+	case reflect.Struct:
+		if _, ok := typ.Interface().(time.Time); ok {
+			return "datetime(3)", nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s (%s)", ErrUnsupportedType, typ.Type(), typ.Kind())
+}
+
+func (m *mysql) Quote(name string) string {
+	return quoteWith(name, "`")
+}
+
+func (m *mysql) Rebind(query string) string {
+	return query
+}
+
+func (m *mysql) AutoIncrementSQL(dataType string) string {
+	return dataType + " AUTO_INCREMENT PRIMARY KEY"
+}
+
+func (m *mysql) TableExistSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?", args
+}
+
+func (m *mysql) IndexesSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT DISTINCT index_name FROM information_schema.statistics " +
+		"WHERE table_schema = DATABASE() AND table_name = ? AND index_name <> 'PRIMARY'", args
+}
+
+func (m *mysql) DropIndexSQL(tableName, indexName string) string {
+	return fmt.Sprintf("DROP INDEX %s ON %s", m.Quote(indexName), m.Quote(tableName))
+}
+
+// UpsertSQL resolves conflicts by any unique key, conflicts are only used
+// to emulate DO NOTHING by assigning the first conflict column to itself
+func (m *mysql) UpsertSQL(conflicts, updates []string) string {
+	if len(updates) == 0 {
+		if len(conflicts) == 0 {
+			return ""
+		}
+		quoted := m.Quote(conflicts[0])
+		return fmt.Sprintf("ON DUPLICATE KEY UPDATE %s = %s", quoted, quoted)
+	}
+
+	sets := make([]string, 0, len(updates))
+	for _, column := range updates {
+		quoted := m.Quote(column)
+		sets = append(sets, fmt.Sprintf("%s = VALUES(%s)", quoted, quoted))
+	}
+	return "ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", ")
+}
+
+// ReturningSQL returns empty, mysql doesn't support RETURNING
+func (m *mysql) ReturningSQL(_ []string) string {
+	return ""
+}
+
+var _ Locker = (*mysql)(nil)
+
+func (m *mysql) LockSQL(name string) (string, []any) {
+	// wait forever until the lock is acquired
+	return "SELECT GET_LOCK(?, -1)", []any{name}
+}
+
+func (m *mysql) UnlockSQL(name string) (string, []any) {
+	return "SELECT RELEASE_LOCK(?)", []any{name}
+}
+
+// MaxPlaceholders is limited by the uint16 count of parameters of prepared statements
+func (m *mysql) MaxPlaceholders() int {
+	return 65535
+}
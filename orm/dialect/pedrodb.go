@@ -0,0 +1,32 @@
+package dialect
+
+// pedrodb is the dialect of github.com/pedrogao/storage/driver, its SQL subset follows sqlite
+type pedrodb struct {
+	sqlite3
+}
+
+var _ Dialect = (*pedrodb)(nil) // must implement Dialect
+
+func init() {
+	RegisterDialect("pedrodb", &pedrodb{})
+}
+
+func (p *pedrodb) TableExistSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT name FROM pedrodb_master WHERE type = 'table' AND name = ?", args
+}
+
+func (p *pedrodb) IndexesSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT name FROM pedrodb_master WHERE type = 'index' AND tbl_name = ?", args
+}
+
+// ReturningSQL returns empty, ids are returned by LastInsertId
+func (p *pedrodb) ReturningSQL(_ []string) string {
+	return ""
+}
+
+// MaxPlaceholders is not limited by pedrodb, the limit keeps statements reasonably small
+func (p *pedrodb) MaxPlaceholders() int {
+	return 65535
+}
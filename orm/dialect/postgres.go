@@ -0,0 +1,102 @@
+package dialect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type postgres struct{}
+
+var _ Dialect = (*postgres)(nil) // must implement Dialect
+
+func init() {
+	RegisterDialect("postgres", &postgres{})
+	RegisterDialect("pgx", &postgres{})
+}
+
+func (p *postgres) DataTypeOf(typ reflect.Value) (string, error) {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "boolean", nil
+	case reflect.Int8, reflect.Int16, reflect.Uint8:
+		return "smallint", nil
+	case reflect.Int32, reflect.Uint16:
+		return "integer", nil
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "bigint", nil
+	case reflect.Float32:
+		return "real", nil
+	case reflect.Float64:
+		return "double precision", nil
+	case reflect.String:
+		return "text", nil
+	case reflect.Array, reflect.Slice:
+		return "bytea", nil
+	case reflect.Struct:
+		if _, ok := typ.Interface().(time.Time); ok {
+			return "timestamp with time zone", nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s (%s)", ErrUnsupportedType, typ.Type(), typ.Kind())
+}
+
+func (p *postgres) Quote(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (p *postgres) Rebind(query string) string {
+	return rebindDollar(query)
+}
+
+func (p *postgres) AutoIncrementSQL(dataType string) string {
+	switch dataType {
+	case "smallint":
+		return "smallserial PRIMARY KEY"
+	case "integer":
+		return "serial PRIMARY KEY"
+	}
+	return "bigserial PRIMARY KEY"
+}
+
+func (p *postgres) TableExistSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT table_name FROM information_schema.tables WHERE table_schema = CURRENT_SCHEMA() AND table_name = ?", args
+}
+
+func (p *postgres) IndexesSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT indexname FROM pg_indexes WHERE schemaname = CURRENT_SCHEMA() AND tablename = ? " +
+		"AND indexname NOT IN (SELECT conname FROM pg_constraint)", args
+}
+
+func (p *postgres) DropIndexSQL(_, indexName string) string {
+	return "DROP INDEX " + p.Quote(indexName)
+}
+
+func (p *postgres) UpsertSQL(conflicts, updates []string) string {
+	return onConflictSQL(p, conflicts, updates)
+}
+
+func (p *postgres) ReturningSQL(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+	return "RETURNING " + strings.Join(quoteAll(p, columns), ", ")
+}
+
+var _ Locker = (*postgres)(nil)
+
+func (p *postgres) LockSQL(name string) (string, []any) {
+	return "SELECT pg_advisory_lock(hashtext(?))", []any{name}
+}
+
+func (p *postgres) UnlockSQL(name string) (string, []any) {
+	return "SELECT pg_advisory_unlock(hashtext(?))", []any{name}
+}
+
+// MaxPlaceholders is limited by the uint16 count of parameters in the wire protocol
+func (p *postgres) MaxPlaceholders() int {
+	return 65535
+}
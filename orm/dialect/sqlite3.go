@@ -0,0 +1,109 @@
+package dialect
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type sqlite3 struct{}
+
+var _ Dialect = (*sqlite3)(nil) // must implement Dialect
+
+func init() {
+	RegisterDialect("sqlite3", &sqlite3{})
+}
+
+func (s *sqlite3) DataTypeOf(typ reflect.Value) (string, error) {
+	switch typ.Kind() {
+	case reflect.Bool:
+		return "bool", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uintptr:
+		return "integer", nil
+	case reflect.Int64, reflect.Uint64:
+		return "bigint", nil
+	case reflect.Float32, reflect.Float64:
+		return "real", nil
+	case reflect.String:
+		return "text", nil
+	case reflect.Array, reflect.Slice:
+		return "blob", nil
+	case reflect.Struct:
+		if _, ok := typ.Interface().(time.Time); ok {
+			return "datetime", nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s (%s)", ErrUnsupportedType, typ.Type(), typ.Kind())
+}
+
+func (s *sqlite3) Quote(name string) string {
+	return quoteWith(name, `"`)
+}
+
+func (s *sqlite3) Rebind(query string) string {
+	return query
+}
+
+func (s *sqlite3) AutoIncrementSQL(_ string) string {
+	// only INTEGER PRIMARY KEY can be AUTOINCREMENT
+	return "integer PRIMARY KEY AUTOINCREMENT"
+}
+
+func (s *sqlite3) TableExistSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	return "SELECT name FROM sqlite_master WHERE type='table' AND name = ?", args
+}
+
+func (s *sqlite3) IndexesSQL(tableName string) (string, []any) {
+	args := []any{tableName}
+	// sql of auto indexes is null
+	return "SELECT name FROM sqlite_master WHERE type='index' AND tbl_name = ? AND sql IS NOT NULL", args
+}
+
+func (s *sqlite3) DropIndexSQL(_, indexName string) string {
+	return "DROP INDEX " + s.Quote(indexName)
+}
+
+func (s *sqlite3) UpsertSQL(conflicts, updates []string) string {
+	return onConflictSQL(s, conflicts, updates)
+}
+
+func (s *sqlite3) ReturningSQL(columns []string) string {
+	// RETURNING is supported since sqlite 3.35
+	if len(columns) == 0 {
+		return ""
+	}
+	return "RETURNING " + strings.Join(quoteAll(s, columns), ", ")
+}
+
+// onConflictSQL generates the `ON CONFLICT` clause shared by sqlite and postgres
+func onConflictSQL(d Dialect, conflicts, updates []string) string {
+	var sb strings.Builder
+	sb.WriteString("ON CONFLICT")
+	if len(conflicts) > 0 {
+		sb.WriteString(" (")
+		sb.WriteString(strings.Join(quoteAll(d, conflicts), ", "))
+		sb.WriteString(")")
+	}
+
+	if len(updates) == 0 {
+		sb.WriteString(" DO NOTHING")
+		return sb.String()
+	}
+
+	sets := make([]string, 0, len(updates))
+	for _, column := range updates {
+		quoted := d.Quote(column)
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", quoted, quoted))
+	}
+	sb.WriteString(" DO UPDATE SET ")
+	sb.WriteString(strings.Join(sets, ", "))
+	return sb.String()
+}
+
+// MaxPlaceholders is SQLITE_MAX_VARIABLE_NUMBER, 999 before sqlite 3.32
+func (s *sqlite3) MaxPlaceholders() int {
+	return 32766
+}
@@ -0,0 +1,138 @@
+package field
+
+import (
+	"strings"
+
+	"github.com/pedrogao/orm/clause"
+	"github.com/pedrogao/orm/dialect"
+	"github.com/pedrogao/orm/session"
+)
+
+// Predicate is a typed condition of columns, built for the dialect of session
+type Predicate struct {
+	build func(d dialect.Dialect) (string, []any)
+}
+
+func (p Predicate) Build(d dialect.Dialect) (string, []any) {
+	return p.build(d)
+}
+
+// Field is a typed column of model, eg. Field[string] for column Name of string field
+type Field[T any] struct {
+	name string
+}
+
+func New[T any](name string) Field[T] {
+	return Field[T]{name: name}
+}
+
+// Name returns the column name
+func (f Field[T]) Name() string {
+	return f.name
+}
+
+func (f Field[T]) Eq(v T) Predicate  { return f.compare("=", v) }
+func (f Field[T]) Neq(v T) Predicate { return f.compare("<>", v) }
+func (f Field[T]) Gt(v T) Predicate  { return f.compare(">", v) }
+func (f Field[T]) Gte(v T) Predicate { return f.compare(">=", v) }
+func (f Field[T]) Lt(v T) Predicate  { return f.compare("<", v) }
+func (f Field[T]) Lte(v T) Predicate { return f.compare("<=", v) }
+
+// Like matches the column by a pattern, eg. Like("Tom%")
+func (f Field[T]) Like(pattern string) Predicate { return f.compare("LIKE", pattern) }
+
+func (f Field[T]) In(values ...T) Predicate {
+	return Predicate{build: func(d dialect.Dialect) (string, []any) {
+		vars := make([]any, 0, len(values))
+		for _, v := range values {
+			vars = append(vars, v)
+		}
+		return clause.In(d.Quote(f.name), vars...)
+	}}
+}
+
+func (f Field[T]) IsNull() Predicate {
+	return Predicate{build: func(d dialect.Dialect) (string, []any) {
+		return d.Quote(f.name) + " IS NULL", nil
+	}}
+}
+
+func (f Field[T]) IsNotNull() Predicate {
+	return Predicate{build: func(d dialect.Dialect) (string, []any) {
+		return d.Quote(f.name) + " IS NOT NULL", nil
+	}}
+}
+
+// Asc returns the ascending order of column for Session.OrderBy
+func (f Field[T]) Asc() Order { return Order{name: f.name} }
+
+// Desc returns the descending order of column for Session.OrderBy
+func (f Field[T]) Desc() Order { return Order{name: f.name, desc: true} }
+
+func (f Field[T]) compare(op string, v any) Predicate {
+	return Predicate{build: func(d dialect.Dialect) (string, []any) {
+		return d.Quote(f.name) + " " + op + " ?", []any{v}
+	}}
+}
+
+// And joins predicates by AND, true if no predicate
+func And(preds ...Predicate) Predicate { return join(" AND ", "1 = 1", preds) }
+
+// Or joins predicates by OR, false if no predicate
+func Or(preds ...Predicate) Predicate { return join(" OR ", "1 = 0", preds) }
+
+// Not negates a predicate
+func Not(pred Predicate) Predicate {
+	return Predicate{build: func(d dialect.Dialect) (string, []any) {
+		desc, vars := pred.Build(d)
+		return "NOT (" + desc + ")", vars
+	}}
+}
+
+func join(sep, empty string, preds []Predicate) Predicate {
+	return Predicate{build: func(d dialect.Dialect) (string, []any) {
+		if len(preds) == 0 {
+			return empty, nil
+		}
+		var (
+			descs []string
+			vars  []any
+		)
+		for _, pred := range preds {
+			desc, v := pred.Build(d)
+			descs = append(descs, "("+desc+")")
+			vars = append(vars, v...)
+		}
+		return strings.Join(descs, sep), vars
+	}}
+}
+
+// Order is a typed order of column
+type Order struct {
+	name string
+	desc bool
+}
+
+func (o Order) Build(d dialect.Dialect) string {
+	if o.desc {
+		return d.Quote(o.name) + " DESC"
+	}
+	return d.Quote(o.name)
+}
+
+// Where appends predicates joined by AND to session
+func Where(s *session.Session, preds ...Predicate) *session.Session {
+	for _, pred := range preds {
+		desc, vars := pred.Build(s.Dialect())
+		s.Where(desc, vars...)
+	}
+	return s
+}
+
+// OrderBy appends orders to session
+func OrderBy(s *session.Session, orders ...Order) *session.Session {
+	for _, order := range orders {
+		s.OrderBy(order.Build(s.Dialect()))
+	}
+	return s
+}
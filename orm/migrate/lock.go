@@ -0,0 +1,106 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/dialect"
+)
+
+const lockName = "schema_migrations"
+
+var ErrLockTimeout = errors.New("acquire migration lock timeout")
+
+// LockTimeout of the fallback lock table, a crashed migrator leaves the lock
+// row which can be removed by hand: DELETE FROM schema_migrations_lock
+var LockTimeout = time.Minute
+
+// SchemaMigrationLock is the fallback lock of dialects without advisory locks
+type SchemaMigrationLock struct {
+	ID       int64 `orm:"primary_key"`
+	LockedAt time.Time
+}
+
+func (SchemaMigrationLock) TableName() string {
+	return "schema_migrations_lock"
+}
+
+// withLock runs f while holding the migration lock, so that concurrent deploys don't race
+func (m *Migrator) withLock(f func() error) error {
+	if m.dryRun {
+		return f()
+	}
+
+	unlock, err := m.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err = m.ensureTable(); err != nil {
+		return err
+	}
+	return f()
+}
+
+func (m *Migrator) lock() (unlock func(), err error) {
+	if locker, ok := m.engine.Dialect().(dialect.Locker); ok {
+		return m.advisoryLock(locker)
+	}
+	return m.tableLock()
+}
+
+// advisoryLock holds a connection until unlock, advisory locks belong to connections
+func (m *Migrator) advisoryLock(locker dialect.Locker) (func(), error) {
+	ctx := context.Background()
+	conn, err := m.engine.DB().Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	d := m.engine.Dialect()
+	query, args := locker.LockSQL(lockName)
+	var ignored any
+	if err = conn.QueryRowContext(ctx, d.Rebind(query), args...).Scan(&ignored); err != nil {
+		_ = conn.Close()
+		log.Errorf("acquire migration lock err: %s", err)
+		return nil, err
+	}
+
+	return func() {
+		query, args := locker.UnlockSQL(lockName)
+		if err := conn.QueryRowContext(ctx, d.Rebind(query), args...).Scan(&ignored); err != nil {
+			log.Errorf("release migration lock err: %s", err)
+		}
+		_ = conn.Close()
+	}, nil
+}
+
+// tableLock inserts the only row of lock table, the insertion fails while another migrator holds it
+func (m *Migrator) tableLock() (func(), error) {
+	if err := m.engine.AutoMigrate(&SchemaMigrationLock{}); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(LockTimeout)
+	for {
+		_, err := m.engine.NewSession().Insert(&SchemaMigrationLock{ID: 1, LockedAt: time.Now()})
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%w: %s", ErrLockTimeout, err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return func() {
+		s := m.engine.NewSession()
+		if _, err := s.Model(&SchemaMigrationLock{}).Where(s.Dialect().Quote("ID")+" = ?", 1).Delete(); err != nil {
+			log.Errorf("release migration lock err: %s", err)
+		}
+	}, nil
+}
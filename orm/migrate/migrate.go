@@ -0,0 +1,275 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm"
+	"github.com/pedrogao/orm/session"
+)
+
+var (
+	ErrNoUp             = errors.New("migration has no up")
+	ErrNoDown           = errors.New("migration has no down")
+	ErrChecksumMismatch = errors.New("checksum of applied migration mismatched")
+)
+
+// Migration is a versioned schema change written in go or sql
+type Migration struct {
+	Version int64 // eg. 20221019150405, applied in ascending order
+	Name    string
+	Up      func(s *session.Session) error
+	Down    func(s *session.Session) error
+	UpSQL   string
+	DownSQL string
+}
+
+// Checksum returns sha256 of UpSQL, empty for go migrations which can't be verified
+func (m *Migration) Checksum() string {
+	if m.UpSQL == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(m.UpSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// SchemaMigration is the bookkeeping record of an applied migration
+type SchemaMigration struct {
+	Version   int64 `orm:"primary_key"`
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status of a migration
+type Status struct {
+	Migration *Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+type Migrator struct {
+	engine     *orm.Engine
+	migrations []*Migration
+	dryRun     bool
+	out        io.Writer
+}
+
+type Option func(*Migrator)
+
+// WithDryRun prints migrations to out instead of applying them, nothing is written to database
+func WithDryRun(out io.Writer) Option {
+	return func(m *Migrator) {
+		m.dryRun = true
+		m.out = out
+	}
+}
+
+func New(engine *orm.Engine, opts ...Option) *Migrator {
+	m := &Migrator{engine: engine, out: os.Stdout}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Add adds migrations, versions must be unique
+func (m *Migrator) Add(migrations ...*Migration) error {
+	for _, migration := range migrations {
+		for _, existed := range m.migrations {
+			if existed.Version == migration.Version {
+				return fmt.Errorf("duplicate migration version: %d", migration.Version)
+			}
+		}
+		m.migrations = append(m.migrations, migration)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool {
+		return m.migrations[i].Version < m.migrations[j].Version
+	})
+	return nil
+}
+
+func (m *Migrator) Migrations() []*Migration {
+	return m.migrations
+}
+
+// Up applies all pending migrations in order
+func (m *Migrator) Up() error {
+	return m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range m.migrations {
+			if record, ok := applied[migration.Version]; ok {
+				if err = verify(migration, record); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = m.apply(migration, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Down reverts the last n applied migrations
+func (m *Migrator) Down(n int) error {
+	return m.withLock(func() error {
+		applied, err := m.applied()
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && n > 0; i-- {
+			migration := m.migrations[i]
+			if _, ok := applied[migration.Version]; !ok {
+				continue
+			}
+			if err = m.apply(migration, false); err != nil {
+				return err
+			}
+			n--
+		}
+		return nil
+	})
+}
+
+// Status returns status of all migrations, checksums of applied migrations are verified
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []Status
+	for _, migration := range m.migrations {
+		status := Status{Migration: migration}
+		if record, ok := applied[migration.Version]; ok {
+			if err = verify(migration, record); err != nil {
+				return nil, err
+			}
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// apply runs up or down of a migration with its bookkeeping in a transaction
+func (m *Migrator) apply(migration *Migration, up bool) error {
+	direction := "down"
+	if up {
+		direction = "up"
+	}
+
+	if m.dryRun {
+		_, _ = fmt.Fprintf(m.out, "-- %s %s\n", direction, migration)
+		sql := migration.DownSQL
+		if up {
+			sql = migration.UpSQL
+		}
+		if sql == "" {
+			sql = "-- go migration"
+		}
+		_, _ = fmt.Fprintln(m.out, sql)
+		return nil
+	}
+
+	log.Infof("migrate %s: %s", direction, migration)
+	err := m.engine.Transaction(func(s *session.Session) error {
+		var err error
+		if up {
+			err = run(s, migration.Up, migration.UpSQL, ErrNoUp)
+		} else {
+			err = run(s, migration.Down, migration.DownSQL, ErrNoDown)
+		}
+		if err != nil {
+			return err
+		}
+
+		record := s.Model(&SchemaMigration{})
+		if !up {
+			_, err = record.Where(s.Dialect().Quote("Version")+" = ?", migration.Version).Delete()
+			return err
+		}
+		_, err = record.Insert(&SchemaMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			Checksum:  migration.Checksum(),
+			AppliedAt: time.Now(),
+		})
+		return err
+	})
+	if err != nil {
+		log.Errorf("migrate %s %s err: %s", direction, migration, err)
+		return fmt.Errorf("migrate %s %s err: %w", direction, migration, err)
+	}
+	return nil
+}
+
+// run runs f or sql, missing is returned if neither is given
+func run(s *session.Session, f func(*session.Session) error, sql string, missing error) error {
+	switch {
+	case f != nil:
+		return f(s)
+	case sql != "":
+		_, err := s.Raw(sql).Exec()
+		return err
+	}
+	return missing
+}
+
+// applied returns applied migrations keyed by version, none if the table isn't created yet
+func (m *Migrator) applied() (map[int64]*SchemaMigration, error) {
+	s := m.engine.NewSession().Primary()
+	exist, err := s.Model(&SchemaMigration{}).HasTable()
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return map[int64]*SchemaMigration{}, nil
+	}
+
+	var records []*SchemaMigration
+	if err := s.OrderBy(s.Dialect().Quote("Version")).Find(&records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int64]*SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (m *Migrator) ensureTable() error {
+	return m.engine.AutoMigrate(&SchemaMigration{})
+}
+
+func verify(migration *Migration, record *SchemaMigration) error {
+	checksum := migration.Checksum()
+	if checksum == "" || record.Checksum == "" || checksum == record.Checksum {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrChecksumMismatch, migration)
+}
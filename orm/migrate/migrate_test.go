@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pedrogao/orm"
+)
+
+func newTestEngine(t *testing.T) *orm.Engine {
+	t.Helper()
+	e, err := orm.NewEngine("sqlite3", ":memory:", &orm.EngineOptions{MaxOpenConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = e.Close() })
+	return e
+}
+
+var userMigration = &Migration{
+	Version: 1,
+	Name:    "create_user",
+	UpSQL:   `CREATE TABLE "User" ("ID" integer PRIMARY KEY, "Name" text)`,
+	DownSQL: `DROP TABLE "User"`,
+}
+
+func hasTable(e *orm.Engine, name string) bool {
+	var n int
+	_ = e.NewSession().Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).
+		QueryRow().Scan(&n)
+	return n > 0
+}
+
+func TestUpDown(t *testing.T) {
+	e := newTestEngine(t)
+	m := New(e)
+	if err := m.Add(userMigration); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	statuses, err := m.Status()
+	if err != nil || len(statuses) != 1 || !statuses[0].Applied {
+		t.Fatalf("status after up = %v, %v", statuses, err)
+	}
+	if err = m.Down(1); err != nil {
+		t.Fatal(err)
+	}
+	if hasTable(e, "User") {
+		t.Fatal("table User isn't dropped by down")
+	}
+	if statuses, _ = m.Status(); statuses[0].Applied {
+		t.Fatal("migration is still applied after down")
+	}
+}
+
+func TestDryRunWritesNothing(t *testing.T) {
+	e := newTestEngine(t)
+	var out bytes.Buffer
+	m := New(e, WithDryRun(&out))
+	if err := m.Add(userMigration); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), userMigration.UpSQL) {
+		t.Fatalf("dry run output = %q", out.String())
+	}
+	for _, table := range []string{"User", "schema_migrations", "schema_migrations_lock"} {
+		if hasTable(e, table) {
+			t.Errorf("table %s is created by dry run", table)
+		}
+	}
+}
+
+func TestMissingUp(t *testing.T) {
+	m := New(newTestEngine(t))
+	if err := m.Add(&Migration{Version: 1, Name: "empty", DownSQL: "SELECT 1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); !errors.Is(err, ErrNoUp) {
+		t.Fatalf("up without up err = %v, want ErrNoUp", err)
+	}
+}
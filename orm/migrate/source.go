@@ -0,0 +1,77 @@
+package migrate
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// sql migration files are named as {version}_{name}.up.sql and {version}_{name}.down.sql
+var fileRe = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// LoadDir adds sql migrations in dir
+func (m *Migrator) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	migrations := map[int64]*Migration{}
+	for _, entry := range entries {
+		matches := fileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid migration version %s: %s", entry.Name(), err)
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		migration, ok := migrations[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			migrations[version] = migration
+		}
+		if matches[3] == "up" {
+			migration.UpSQL = string(content)
+		} else {
+			migration.DownSQL = string(content)
+		}
+	}
+
+	for _, migration := range migrations {
+		if err = m.Add(migration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Create creates empty up and down sql files of a new migration versioned by current time
+func Create(dir, name string) (up, down string, err error) {
+	if !regexp.MustCompile(`^\w+$`).MatchString(name) {
+		return "", "", fmt.Errorf("invalid migration name: %s", name)
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", "", err
+	}
+
+	version := time.Now().Format("20060102150405")
+	up = filepath.Join(dir, fmt.Sprintf("%s_%s.up.sql", version, name))
+	down = filepath.Join(dir, fmt.Sprintf("%s_%s.down.sql", version, name))
+	if err = os.WriteFile(up, []byte("-- "+name+" up\n"), 0644); err != nil {
+		return "", "", err
+	}
+	if err = os.WriteFile(down, []byte("-- "+name+" down\n"), 0644); err != nil {
+		return "", "", err
+	}
+	return up, down, nil
+}
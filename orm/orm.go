@@ -1,35 +1,174 @@
 package orm
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/cache"
+	"github.com/pedrogao/orm/dialect"
 	"github.com/pedrogao/orm/session"
 )
 
+type EngineOptions struct {
+	// Dialect of the database, the dialect registered as the driver name if nil
+	Dialect dialect.Dialect
+
+	StatementTimeout time.Duration // default timeout of each statement, no timeout if zero
+	StmtCacheSize    int           // capacity of prepared statement cache, disabled if zero
+
+	// connection pool, unchanged if zero
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Replicas are data source names of replicas opened by the driver of primary,
+	// reads outside transactions are routed to replicas picked by ReplicaPolicy
+	Replicas      []string
+	ReplicaPolicy ReplicaPolicy // RoundRobinPolicy if nil
+
+	// Cache caches results of Find, First and Count, invalidated by writes to their tables,
+	// queries are cached for CacheTTL, or only if marked by Session.Cache if CacheTTL is zero
+	Cache    cache.Cache
+	CacheTTL time.Duration
+
+	// QueryLogger logs statements, DefaultQueryLogger with redacted args if nil
+	QueryLogger session.QueryLogger
+	// Interceptors observe statements around execution, eg. metrics and tracing
+	Interceptors []session.Interceptor
+}
+
+var DefaultEngineOptions = &EngineOptions{}
+
 type Engine struct {
-	db *sql.DB
+	db      *sql.DB
+	dialect dialect.Dialect
+	opts    *EngineOptions
+	stmts   *session.StmtCache
+	logger  session.QueryLogger
+	// replicas serve reads, nil if no replica
+	replicas *replicaSet
+
+	mu           sync.RWMutex // protects interceptors, which are copied on write
+	interceptors []session.Interceptor
+}
+
+// Stats of connection pool and prepared statement cache
+type Stats struct {
+	DB        sql.DBStats
+	StmtCache session.StmtCacheStats
+	Replicas  []sql.DBStats
+}
+
+func parseOptions(opts ...*EngineOptions) (*EngineOptions, error) {
+	if len(opts) == 0 || opts[0] == nil {
+		return DefaultEngineOptions, nil
+	}
+
+	if len(opts) != 1 {
+		return nil, fmt.Errorf("number of options: %d is more than 1", len(opts))
+	}
+	return opts[0], nil
+}
+
+// NewEngine opens the database of driver. SQL is generated by the dialect of EngineOptions,
+// or the dialect registered as driver, eg. sqlite3, mysql, postgres, pgx and pedrodb. Drivers
+// of other names fail unless their dialects are given or registered by dialect.RegisterDialect.
+func NewEngine(driver, source string, opts ...*EngineOptions) (e *Engine, err error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	d := opt.Dialect
+	if d == nil {
+		var ok bool
+		if d, ok = dialect.GetDialect(driver); !ok {
+			log.Errorf("dialect %s not found", driver)
+			return nil, fmt.Errorf("dialect %s not found, register it by dialect.RegisterDialect "+
+				"or set EngineOptions.Dialect", driver)
+		}
+	}
+
+	db, err := open(driver, source, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	replicas := make([]*Replica, 0, len(opt.Replicas))
+	for _, dsn := range opt.Replicas {
+		var rdb *sql.DB
+		if rdb, err = open(driver, dsn, opt); err != nil {
+			for _, r := range replicas {
+				_ = r.db.Close()
+			}
+			_ = db.Close()
+			return nil, err
+		}
+		replicas = append(replicas, &Replica{db: rdb})
+	}
+
+	e = &Engine{db: db, dialect: d, opts: opt, logger: opt.QueryLogger}
+	if e.logger == nil {
+		e.logger = &session.DefaultQueryLogger{}
+	}
+	e.interceptors = append(e.interceptors, opt.Interceptors...)
+	if len(replicas) > 0 {
+		e.replicas = &replicaSet{replicas: replicas, policy: opt.ReplicaPolicy}
+		if e.replicas.policy == nil {
+			e.replicas.policy = &RoundRobinPolicy{}
+		}
+	}
+	if opt.StmtCacheSize > 0 {
+		e.stmts = session.NewStmtCache(db, opt.StmtCacheSize)
+	}
+	return
 }
 
-func NewEngine(driver, source string) (e *Engine, err error) {
-	var db *sql.DB
-	db, err = sql.Open(driver, source)
+// open opens and pings a database, configured by pool options of opt
+func open(driver, source string, opt *EngineOptions) (*sql.DB, error) {
+	db, err := sql.Open(driver, source)
 	if err != nil {
 		log.Errorf("open err: %s", err)
-		return
+		return nil, fmt.Errorf("open err: %s", err)
 	}
 
 	if err = db.Ping(); err != nil {
 		log.Errorf("ping err: %s", err)
-		return
+		_ = db.Close()
+		return nil, fmt.Errorf("ping err: %s", err)
 	}
 
-	e = &Engine{db: db}
-	return
+	if opt.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opt.MaxOpenConns)
+	}
+	if opt.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opt.MaxIdleConns)
+	}
+	if opt.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opt.ConnMaxLifetime)
+	}
+	if opt.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opt.ConnMaxIdleTime)
+	}
+	return db, nil
 }
 
 func (e *Engine) Close() error {
+	if e.stmts != nil {
+		e.stmts.Reset()
+	}
+	if e.replicas != nil {
+		for _, r := range e.replicas.replicas {
+			if err := r.db.Close(); err != nil {
+				log.Errorf("close replica err: %s", err)
+			}
+		}
+	}
 	if err := e.db.Close(); err != nil {
 		log.Errorf("close orm engine err: %s", err)
 		return fmt.Errorf("close orm engine err: %s", err)
@@ -37,6 +176,73 @@ func (e *Engine) Close() error {
 	return nil
 }
 
+func (e *Engine) DB() *sql.DB {
+	return e.db
+}
+
+// Replicas returns replicas of the primary
+func (e *Engine) Replicas() []*Replica {
+	if e.replicas == nil {
+		return nil
+	}
+	return e.replicas.replicas
+}
+
+func (e *Engine) Dialect() dialect.Dialect {
+	return e.dialect
+}
+
+// Use appends interceptors to sessions created afterwards, it's safe to call concurrently with NewSession
+func (e *Engine) Use(interceptors ...session.Interceptor) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// copied, so that sessions created before keep their interceptors
+	copied := make([]session.Interceptor, 0, len(e.interceptors)+len(interceptors))
+	copied = append(copied, e.interceptors...)
+	e.interceptors = append(copied, interceptors...)
+}
+
 func (e *Engine) NewSession() *session.Session {
-	return session.New(e.db)
+	e.mu.RLock()
+	interceptors := e.interceptors
+	e.mu.RUnlock()
+
+	opts := []session.Option{
+		session.WithTimeout(e.opts.StatementTimeout),
+		session.WithQueryLogger(e.logger),
+		session.WithInterceptors(interceptors...),
+	}
+	if e.stmts != nil {
+		opts = append(opts, session.WithStmtCache(e.stmts))
+	}
+	if e.replicas != nil {
+		opts = append(opts, session.WithReadResolver(e.replicas))
+	}
+	if e.opts.Cache != nil {
+		opts = append(opts, session.WithCache(e.opts.Cache, e.opts.CacheTTL))
+	}
+	return session.New(e.db, e.dialect, opts...)
+}
+
+func (e *Engine) Stats() Stats {
+	stats := Stats{DB: e.db.Stats()}
+	for _, r := range e.Replicas() {
+		stats.Replicas = append(stats.Replicas, r.db.Stats())
+	}
+	if e.stmts != nil {
+		stats.StmtCache = e.stmts.Stats()
+	}
+	return stats
+}
+
+// Transaction runs f in a transaction of a new session, commits if f returns nil,
+// otherwise rollbacks on error or panic
+func (e *Engine) Transaction(f func(*session.Session) error) error {
+	return e.NewSession().Transaction(f)
+}
+
+// TransactionContext runs f like Transaction, the transaction is rolled back once ctx is done
+func (e *Engine) TransactionContext(ctx context.Context, f func(*session.Session) error) error {
+	return e.NewSession().WithContext(ctx).Transaction(f)
 }
@@ -0,0 +1,40 @@
+package orm
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pedrogao/orm/session"
+)
+
+func TestUseConcurrently(t *testing.T) {
+	e := newTestEngine(t)
+	var count int64
+	counter := session.InterceptorFuncs{AfterFunc: func(context.Context, *session.QueryInfo) {
+		atomic.AddInt64(&count, 1)
+	}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e.Use(counter)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = e.NewSession().Raw("SELECT 1").Exec()
+		}()
+	}
+	wg.Wait()
+
+	atomic.StoreInt64(&count, 0)
+	if _, err := e.NewSession().Raw("SELECT 1").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt64(&count); n != 4 {
+		t.Fatalf("interceptors called = %d, want 4", n)
+	}
+}
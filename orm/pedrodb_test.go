@@ -0,0 +1,104 @@
+package orm
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/orm/session"
+	_ "github.com/pedrogao/storage/driver"
+)
+
+type Member struct {
+	ID        int
+	Name      string `orm:"index"`
+	Age       int
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+func TestPedrodbEngine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	e, err := NewEngine("pedrodb", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if err = e.AutoMigrate(&Member{}); err != nil {
+		t.Fatal(err)
+	}
+	// migrating again finds the table and the index
+	if err = e.AutoMigrate(&Member{}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := e.NewSession()
+	members := []Member{{Name: "Tom", Age: 18}, {Name: "Sam", Age: 20}, {Name: "Amy", Age: 30}}
+	if _, err = s.InsertBatch(members, 0); err != nil {
+		t.Fatal(err)
+	}
+	if members[0].CreatedAt.IsZero() || members[0].Version != 1 {
+		t.Fatalf("inserted members = %+v", members)
+	}
+
+	var found []Member
+	if err = s.Where("Age > ?", 18).OrderBy("Age DESC").Find(&found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 || found[0].Name != "Amy" || found[1].Name != "Sam" {
+		t.Fatalf("find = %+v", found)
+	}
+
+	var tom Member
+	if err = s.Where("Name = ?", "Tom").First(&tom); err != nil {
+		t.Fatal(err)
+	}
+	stale := tom
+	tom.Age = 19
+	if _, err = s.Update(&tom); err != nil || tom.Version != 2 {
+		t.Fatalf("update = %+v, %v", tom, err)
+	}
+	stale.Age = 17
+	if _, err = s.Update(&stale); !errors.Is(err, session.ErrStaleObject) {
+		t.Fatalf("stale update err = %v, want ErrStaleObject", err)
+	}
+
+	errFailed := errors.New("failed")
+	err = s.Transaction(func(s *session.Session) error {
+		if _, err := s.Insert(&Member{Name: "Bob"}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("transaction err = %v, want %v", err, errFailed)
+	}
+	if n, err := s.Model(&Member{}).Count(); err != nil || n != 3 {
+		t.Fatalf("count after rollback = %d, %v, want 3", n, err)
+	}
+
+	if n, err := s.Model(&Member{}).Where("Name = ?", "Sam").Delete(); err != nil || n != 1 {
+		t.Fatalf("soft delete = %d, %v, want 1", n, err)
+	}
+	if n, err := s.Model(&Member{}).Count(); err != nil || n != 2 {
+		t.Fatalf("count after soft delete = %d, %v, want 2", n, err)
+	}
+	if n, err := s.Model(&Member{}).Unscoped().Count(); err != nil || n != 3 {
+		t.Fatalf("unscoped count = %d, %v, want 3", n, err)
+	}
+
+	// the data is persisted in the file
+	if err = e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = NewEngine("pedrodb", path); err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if err = e.NewSession().Where("Name = ?", "Tom").First(&tom); err != nil || tom.Age != 19 {
+		t.Fatalf("member after reopen = %+v, %v", tom, err)
+	}
+}
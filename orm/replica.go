@@ -0,0 +1,83 @@
+package orm
+
+import (
+	"database/sql"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Replica is a read only copy of the primary database
+type Replica struct {
+	db      *sql.DB
+	latency int64 // moving average of query durations in nanoseconds
+}
+
+func (r *Replica) DB() *sql.DB {
+	return r.db
+}
+
+// Latency returns the moving average of query durations, zero if never queried
+func (r *Replica) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.latency))
+}
+
+// observe updates the moving average of latency by d, weighted by 1/8
+func (r *Replica) observe(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&r.latency)
+		avg := int64(d)
+		if old > 0 {
+			avg = old + (int64(d)-old)/8
+		}
+		if atomic.CompareAndSwapInt64(&r.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// ReplicaPolicy picks the replica to serve a read from non-empty replicas
+type ReplicaPolicy interface {
+	Pick(replicas []*Replica) *Replica
+}
+
+// RandomPolicy picks replicas randomly
+type RandomPolicy struct{}
+
+func (RandomPolicy) Pick(replicas []*Replica) *Replica {
+	return replicas[rand.Intn(len(replicas))]
+}
+
+// RoundRobinPolicy picks replicas in turn
+type RoundRobinPolicy struct {
+	next uint64
+}
+
+func (p *RoundRobinPolicy) Pick(replicas []*Replica) *Replica {
+	n := atomic.AddUint64(&p.next, 1) - 1
+	return replicas[n%uint64(len(replicas))]
+}
+
+// LeastLatencyPolicy picks the replica of least latency, replicas never queried are picked first
+type LeastLatencyPolicy struct{}
+
+func (LeastLatencyPolicy) Pick(replicas []*Replica) *Replica {
+	picked := replicas[0]
+	for _, r := range replicas[1:] {
+		if r.Latency() < picked.Latency() {
+			picked = r
+		}
+	}
+	return picked
+}
+
+// replicaSet resolves reads of sessions to replicas
+type replicaSet struct {
+	replicas []*Replica
+	policy   ReplicaPolicy
+}
+
+func (rs *replicaSet) Read() (*sql.DB, func(time.Duration)) {
+	r := rs.policy.Pick(rs.replicas)
+	return r.db, r.observe
+}
@@ -0,0 +1,184 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/orm/session"
+)
+
+// seedDB creates a sqlite file holding an account named name, to tell which database is read
+func seedDB(t *testing.T, name string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name+".db")
+	e, err := NewEngine("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if err = e.NewSession().Model(&Account{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = e.NewSession().Insert(&Account{Name: name}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFrom(t *testing.T, e *Engine) string {
+	t.Helper()
+	var account Account
+	if err := e.NewSession().First(&account); err != nil {
+		t.Fatal(err)
+	}
+	return account.Name
+}
+
+func newReplicatedEngine(t *testing.T, policy ReplicaPolicy) *Engine {
+	t.Helper()
+	e, err := NewEngine("sqlite3", seedDB(t, "primary"), &EngineOptions{
+		Replicas:      []string{seedDB(t, "r1"), seedDB(t, "r2")},
+		ReplicaPolicy: policy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = e.Close() })
+	return e
+}
+
+func TestReplicaRouting(t *testing.T) {
+	e := newReplicatedEngine(t, nil)
+	if n := len(e.Replicas()); n != 2 {
+		t.Fatalf("replicas = %d, want 2", n)
+	}
+
+	// reads go to replicas in turn by default
+	for _, want := range []string{"r1", "r2", "r1"} {
+		if got := readFrom(t, e); got != want {
+			t.Fatalf("read from %s, want %s", got, want)
+		}
+	}
+	var names []string
+	if err := e.NewSession().Raw("WITH a AS (SELECT Name FROM Account) SELECT Name FROM a").ScanAll(&names); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "r2" {
+		t.Fatalf("WITH SELECT read %v, want r2", names)
+	}
+
+	// writes and reads forced to the primary
+	if _, err := e.NewSession().Insert(&Account{Name: "written"}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := e.NewSession().Primary().Model(&Account{}).Count()
+	if err != nil || n != 2 {
+		t.Fatalf("count of primary = %d, %v, want 2", n, err)
+	}
+	for _, r := range e.Replicas() {
+		var count int
+		if err = r.DB().QueryRow("SELECT COUNT(*) FROM Account").Scan(&count); err != nil || count != 1 {
+			t.Fatalf("count of replica = %d, %v, want 1", count, err)
+		}
+	}
+	var account Account
+	if err = e.NewSession().Primary().Where("Name = ?", "written").First(&account); err != nil {
+		t.Fatalf("read from primary: %v", err)
+	}
+
+	// reads in transactions go to the primary
+	err = e.NewSession().Transaction(func(s *session.Session) error {
+		var account Account
+		if err := s.OrderBy("ID").First(&account); err != nil {
+			return err
+		}
+		if account.Name != "primary" {
+			t.Errorf("read in transaction from %s, want primary", account.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range e.Replicas() {
+		if r.Latency() <= 0 {
+			t.Fatal("latency of replica isn't observed")
+		}
+	}
+}
+
+func TestReplicaPolicies(t *testing.T) {
+	e := newReplicatedEngine(t, LeastLatencyPolicy{})
+	// replicas never queried are picked first, then the one of least latency
+	if got := readFrom(t, e); got != "r1" {
+		t.Fatalf("read from %s, want r1", got)
+	}
+	if got := readFrom(t, e); got != "r2" {
+		t.Fatalf("read from %s, want r2, which is never queried", got)
+	}
+	r1, r2 := e.Replicas()[0], e.Replicas()[1]
+	r1.observe(time.Hour)
+	if got := (LeastLatencyPolicy{}).Pick(e.Replicas()); got != r2 {
+		t.Fatal("the replica of least latency isn't picked")
+	}
+	r2.observe(2 * time.Hour)
+	if got := (LeastLatencyPolicy{}).Pick(e.Replicas()); got != r1 {
+		t.Fatal("the replica of least latency isn't picked")
+	}
+
+	rr := &RoundRobinPolicy{}
+	for i := 0; i < 4; i++ {
+		if got := rr.Pick(e.Replicas()); got != e.Replicas()[i%2] {
+			t.Fatalf("round robin pick #%d isn't replica %d", i, i%2)
+		}
+	}
+
+	picked := map[*Replica]bool{}
+	for i := 0; i < 100; i++ {
+		picked[(RandomPolicy{}).Pick(e.Replicas())] = true
+	}
+	if len(picked) != 2 {
+		t.Fatalf("random policy picks %d replicas of 100 picks, want 2", len(picked))
+	}
+}
+
+func TestDatabases(t *testing.T) {
+	dbs := NewDatabases()
+	for _, name := range []string{"tom", "sam"} {
+		e, err := NewEngine("sqlite3", seedDB(t, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		dbs.Register(name, e)
+	}
+	defer dbs.Close()
+
+	for _, name := range []string{"tom", "sam"} {
+		s, err := dbs.SessionContext(WithDatabase(context.Background(), name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var account Account
+		if err = s.First(&account); err != nil || account.Name != name {
+			t.Fatalf("account of database %s = %v, %v", name, account, err)
+		}
+	}
+
+	if _, err := dbs.Session("amy"); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatalf("session of missing database err = %v, want ErrDatabaseNotFound", err)
+	}
+	if _, err := dbs.SessionContext(context.Background()); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatalf("session without database err = %v, want ErrDatabaseNotFound", err)
+	}
+	e := dbs.Remove("sam")
+	if e == nil {
+		t.Fatal("removed engine is nil")
+	}
+	_ = e.Close()
+	if _, err := dbs.Engine("sam"); !errors.Is(err, ErrDatabaseNotFound) {
+		t.Fatalf("engine of removed database err = %v, want ErrDatabaseNotFound", err)
+	}
+}
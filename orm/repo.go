@@ -0,0 +1,185 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/pedrogao/orm/schema"
+	"github.com/pedrogao/orm/session"
+)
+
+var ErrNoPrimaryKey = errors.New("model has no primary key")
+
+// Filter narrows the query of a repository, eg.
+//
+//	func(s *session.Session) *session.Session { return s.Where("Age > ?", 18) }
+type Filter func(s *session.Session) *session.Session
+
+// Repo is a typed data access of model T, T is a struct or a pointer of struct
+type Repo[T any] struct {
+	engine *Engine
+}
+
+func NewRepo[T any](e *Engine) *Repo[T] {
+	return &Repo[T]{engine: e}
+}
+
+func (r *Repo[T]) session(ctx context.Context) *session.Session {
+	var model T
+	return r.engine.NewSession().WithContext(ctx).Model(record(&model))
+}
+
+// record returns obj as a pointer of struct, nil pointers of pointer T are allocated
+func record[T any](obj *T) any {
+	v := reflect.ValueOf(obj)
+	for v.Elem().Kind() == reflect.Ptr {
+		if v.Elem().IsNil() {
+			v.Elem().Set(reflect.New(v.Elem().Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	return v.Interface()
+}
+
+// Get returns the record whose primary key is id, session.ErrRecordNotFound if missing
+func (r *Repo[T]) Get(ctx context.Context, id any) (*T, error) {
+	s := r.session(ctx)
+	table, err := s.Table()
+	if err != nil {
+		return nil, err
+	}
+	pk := table.PrimaryKey
+	if pk == nil {
+		return nil, ErrNoPrimaryKey
+	}
+
+	var t T
+	if err = s.Where(s.Dialect().Quote(pk.Name)+" = ?", id).First(&t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List returns all records matched by filters
+func (r *Repo[T]) List(ctx context.Context, filters ...Filter) ([]T, error) {
+	var list []T
+	if err := r.apply(r.session(ctx), filters).Find(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Paginate returns records of page ordered by primary key, page starts from 1
+func (r *Repo[T]) Paginate(ctx context.Context, page, size int, filters ...Filter) ([]T, error) {
+	if page < 1 {
+		page = 1
+	}
+
+	s := r.apply(r.session(ctx), filters)
+	table, err := s.Table()
+	if err != nil {
+		return nil, err
+	}
+	if pk := table.PrimaryKey; pk != nil {
+		s.OrderBy(s.Dialect().Quote(pk.Name))
+	}
+
+	var list []T
+	if err = s.Limit(size).Offset((page - 1) * size).Find(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// Create inserts obj, the generated primary key is written back into obj
+func (r *Repo[T]) Create(ctx context.Context, obj *T) error {
+	_, err := r.engine.NewSession().WithContext(ctx).Insert(record(obj))
+	return err
+}
+
+// Update updates all fields of obj by its primary key except CreatedAt, UpdatedAt and
+// Version of obj are written back after success, session.ErrStaleObject is returned
+// on version conflict, and session.ErrRecordNotFound if no record has the primary key
+func (r *Repo[T]) Update(ctx context.Context, obj *T) error {
+	rec := record(obj)
+	s := r.engine.NewSession().WithContext(ctx).Model(rec)
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+	if table.PrimaryKey == nil {
+		return ErrNoPrimaryKey
+	}
+
+	var id any
+	now := time.Now()
+	values := make(map[string]any, len(table.Fields))
+	for i, value := range table.RecordValues(rec) {
+		switch field := table.Fields[i]; field {
+		case table.PrimaryKey:
+			id = value
+		case table.CreatedAt: // kept as inserted
+		case table.UpdatedAt:
+			values[field.Name] = schema.TimeValue(field.GoType, now)
+		default:
+			values[field.Name] = value
+		}
+	}
+	affected, err := s.Where(s.Dialect().Quote(table.PrimaryKey.Name)+" = ?", id).Update(values)
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return session.ErrRecordNotFound
+	}
+
+	dest := reflect.ValueOf(rec).Elem()
+	if table.UpdatedAt != nil {
+		schema.SetTime(dest.FieldByIndex(table.UpdatedAt.Index), now)
+	}
+	if table.Version != nil {
+		switch v := dest.FieldByIndex(table.Version.Index); v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if v.Int() != 0 {
+				v.SetInt(v.Int() + 1)
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v.Uint() != 0 {
+				v.SetUint(v.Uint() + 1)
+			}
+		}
+	}
+	return nil
+}
+
+// Delete deletes the record whose primary key is id, session.ErrRecordNotFound
+// is returned if no record has the primary key
+func (r *Repo[T]) Delete(ctx context.Context, id any) error {
+	s := r.session(ctx)
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+	pk := table.PrimaryKey
+	if pk == nil {
+		return ErrNoPrimaryKey
+	}
+
+	affected, err := s.Where(s.Dialect().Quote(pk.Name)+" = ?", id).Delete()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return session.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (r *Repo[T]) apply(s *session.Session, filters []Filter) *session.Session {
+	for _, filter := range filters {
+		s = filter(s)
+	}
+	return s
+}
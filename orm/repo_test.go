@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pedrogao/orm/session"
+)
+
+type Account struct {
+	ID      int
+	Name    string
+	Version int
+}
+
+func newTestEngine(t testing.TB) *Engine {
+	t.Helper()
+	e, err := NewEngine("sqlite3", ":memory:", &EngineOptions{MaxOpenConns: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = e.Close() })
+	return e
+}
+
+func TestRepoOfPointer(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.NewSession().Model(&Account{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repo := NewRepo[*Account](e)
+	obj := &Account{Name: "Tom", Version: 1}
+	if err := repo.Create(ctx, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.ID == 0 {
+		t.Fatal("primary key isn't written back")
+	}
+
+	got, err := repo.Get(ctx, obj.ID)
+	if err != nil || (*got).Name != "Tom" {
+		t.Fatalf("Get = %v, %v", got, err)
+	}
+	obj.Name = "Sam"
+	if err = repo.Update(ctx, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj.Version != 2 {
+		t.Fatalf("version = %d, want 2", obj.Version)
+	}
+	list, err := repo.List(ctx)
+	if err != nil || len(list) != 1 || list[0].Name != "Sam" {
+		t.Fatalf("List = %v, %v", list, err)
+	}
+}
+
+func TestRepoUpdateMissing(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.NewSession().Model(&Account{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := NewRepo[Account](e)
+	err := repo.Update(context.Background(), &Account{ID: 42, Name: "Tom"})
+	if !errors.Is(err, session.ErrRecordNotFound) {
+		t.Fatalf("update of missing record err = %v, want ErrRecordNotFound", err)
+	}
+}
+
+type Profile struct {
+	ID        int
+	Name      string
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func TestRepoUpdateKeepsCreatedAt(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.NewSession().Model(&Profile{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repo := NewRepo[Profile](e)
+	obj := &Profile{Name: "Tom", Version: 1}
+	if err := repo.Create(ctx, obj); err != nil {
+		t.Fatal(err)
+	}
+	created, err := repo.Get(ctx, obj.ID)
+	if err != nil || created.CreatedAt.IsZero() {
+		t.Fatalf("Get = %v, %v", created, err)
+	}
+
+	// a replacement without CreatedAt keeps the inserted time
+	if err = repo.Update(ctx, &Profile{ID: obj.ID, Name: "Sam", Version: 1}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.Get(ctx, obj.ID)
+	if err != nil || got.Name != "Sam" || !got.CreatedAt.Equal(created.CreatedAt) || got.UpdatedAt.IsZero() {
+		t.Fatalf("Get after update = %+v, %v, want CreatedAt %s", got, err, created.CreatedAt)
+	}
+
+	// a failed update doesn't touch UpdatedAt and Version of obj
+	stale := &Profile{ID: obj.ID, Name: "Amy", Version: 1}
+	if err = repo.Update(ctx, stale); !errors.Is(err, session.ErrStaleObject) {
+		t.Fatalf("stale update err = %v, want ErrStaleObject", err)
+	}
+	if !stale.UpdatedAt.IsZero() || stale.Version != 1 {
+		t.Fatalf("stale object after failure = %+v", stale)
+	}
+}
+
+func TestRepoDeleteMissing(t *testing.T) {
+	e := newTestEngine(t)
+	if err := e.NewSession().Model(&Account{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	repo := NewRepo[Account](e)
+	obj := &Account{Name: "Tom"}
+	if err := repo.Create(ctx, obj); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, obj.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Delete(ctx, obj.ID); !errors.Is(err, session.ErrRecordNotFound) {
+		t.Fatalf("delete of missing record err = %v, want ErrRecordNotFound", err)
+	}
+}
@@ -0,0 +1,86 @@
+package schema
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var nullTimeType = reflect.TypeOf(sql.NullTime{})
+
+// parseConventions finds fields managed by session, by tag or by field name:
+//
+//	DeletedAt *time.Time `orm:"soft_delete"` // *time.Time or sql.NullTime, NULL if not deleted
+//	Version   int        `orm:"version"`     // integer, checked and bumped by update
+//	CreatedAt time.Time  `orm:"created_at"`  // set by insert if zero
+//	UpdatedAt time.Time  `orm:"updated_at"`  // set by insert and update
+func (s *Schema) parseConventions() {
+	for _, field := range s.Fields {
+		for _, option := range strings.Split(field.Tag, ";") {
+			key, _ := splitOption(option)
+			switch key {
+			case "soft_delete":
+				s.DeletedAt = field
+			case "version":
+				s.Version = field
+			case "created_at":
+				s.CreatedAt = field
+			case "updated_at":
+				s.UpdatedAt = field
+			}
+		}
+	}
+
+	for _, field := range s.Fields {
+		switch {
+		case field.FieldName == "DeletedAt" && s.DeletedAt == nil && isNullable(field.GoType):
+			s.DeletedAt = field
+		case field.FieldName == "Version" && s.Version == nil && isInteger(field.GoType):
+			s.Version = field
+		case field.FieldName == "CreatedAt" && s.CreatedAt == nil && isTime(field.GoType):
+			s.CreatedAt = field
+		case field.FieldName == "UpdatedAt" && s.UpdatedAt == nil && isTime(field.GoType):
+			s.UpdatedAt = field
+		}
+	}
+}
+
+// TimeValue returns t as the value of a column of typ, unix seconds for integers
+func TimeValue(typ reflect.Type, t time.Time) any {
+	if isInteger(typ) {
+		return t.Unix()
+	}
+	return t
+}
+
+// SetTime sets v to t, v is time.Time, *time.Time, sql.NullTime or an integer of unix seconds
+func SetTime(v reflect.Value, t time.Time) {
+	switch {
+	case v.Type() == timeType:
+		v.Set(reflect.ValueOf(t))
+	case v.Type() == reflect.PtrTo(timeType):
+		v.Set(reflect.ValueOf(&t))
+	case v.Type() == nullTimeType:
+		v.Set(reflect.ValueOf(sql.NullTime{Time: t, Valid: true}))
+	case isInteger(v.Type()):
+		setInteger(v, t.Unix())
+	}
+}
+
+func setInteger(v reflect.Value, i int64) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(i))
+	}
+}
+
+func isNullable(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Ptr || typ == nullTimeType
+}
+
+func isTime(typ reflect.Type) bool {
+	return typ == timeType || typ == reflect.PtrTo(timeType) || typ == nullTimeType || isInteger(typ)
+}
@@ -0,0 +1,147 @@
+package schema
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+)
+
+type RelationKind int
+
+const (
+	HasOne RelationKind = iota
+	HasMany
+	BelongsTo
+	ManyToMany
+)
+
+// Relationship represents an association declared by a struct or slice field, eg.
+//
+//	Orders []Order           `orm:"has_many;foreign_key:UserID;cascade:save,delete"`
+//	User   *User             `orm:"belongs_to;foreign_key:UserID"`
+//	Tags   []Tag             `orm:"many2many:user_tags"`
+//
+// foreign keys are go field names, has one and has many keep the foreign key in
+// the related model, belongs to keeps it in the owner, many to many keeps both
+// keys in the join table.
+type Relationship struct {
+	Name           string // go field name
+	Kind           RelationKind
+	Type           reflect.Type // struct type of related model
+	Index          []int        // index sequence for reflect.Value.FieldByIndex
+	ForeignKey     string
+	References     string // field referenced by foreign key, primary key by default
+	JoinTable      string
+	JoinForeignKey string // column of join table referencing owner
+	JoinReferences string // column of join table referencing related model
+	CascadeSave    bool
+	CascadeDelete  bool
+}
+
+// IsSlice reports whether the field holds many related models
+func (r *Relationship) IsSlice() bool {
+	return r.Kind == HasMany || r.Kind == ManyToMany
+}
+
+func (s *Schema) Relationship(name string) *Relationship {
+	for _, rel := range s.Relationships {
+		if rel.Name == name {
+			return rel
+		}
+	}
+	return nil
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// relatedType returns the struct type of a relation field, nil if field is a column
+func relatedType(typ reflect.Type) (reflect.Type, bool) {
+	isSlice := false
+	if typ.Kind() == reflect.Slice {
+		isSlice = true
+		typ = typ.Elem()
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct || typ == timeType ||
+		reflect.PtrTo(typ).Implements(scannerType) || typ.Implements(valuerType) {
+		return nil, false
+	}
+	return typ, isSlice
+}
+
+func parseRelationship(owner reflect.Type, p reflect.StructField, index []int, related reflect.Type, isSlice bool) *Relationship {
+	rel := &Relationship{
+		Name:  p.Name,
+		Type:  related,
+		Index: index,
+	}
+
+	declared := false
+	for _, option := range strings.Split(p.Tag.Get(TagName), ";") {
+		key, value := splitOption(option)
+		switch key {
+		case "has_one":
+			rel.Kind, declared = HasOne, true
+		case "has_many":
+			rel.Kind, declared = HasMany, true
+		case "belongs_to":
+			rel.Kind, declared = BelongsTo, true
+		case "many2many":
+			rel.Kind, declared = ManyToMany, true
+			rel.JoinTable = value
+		case "foreign_key":
+			rel.ForeignKey = value
+		case "references":
+			rel.References = value
+		case "join_foreign_key":
+			rel.JoinForeignKey = value
+		case "join_references":
+			rel.JoinReferences = value
+		case "cascade":
+			for _, c := range strings.Split(value, ",") {
+				switch strings.TrimSpace(c) {
+				case "save":
+					rel.CascadeSave = true
+				case "delete":
+					rel.CascadeDelete = true
+				}
+			}
+		}
+	}
+
+	if !declared {
+		// infer kind by field type, it's belongs to if owner has the foreign key
+		_, ownerHasKey := owner.FieldByName(foreignKey(rel.ForeignKey, p.Name+"ID"))
+		switch {
+		case isSlice:
+			rel.Kind = HasMany
+		case ownerHasKey:
+			rel.Kind = BelongsTo
+		default:
+			rel.Kind = HasOne
+		}
+	}
+
+	switch rel.Kind {
+	case HasOne, HasMany:
+		rel.ForeignKey = foreignKey(rel.ForeignKey, owner.Name()+"ID")
+	case BelongsTo:
+		rel.ForeignKey = foreignKey(rel.ForeignKey, p.Name+"ID")
+	case ManyToMany:
+		if rel.JoinTable == "" {
+			rel.JoinTable = owner.Name() + "_" + related.Name()
+		}
+		rel.JoinForeignKey = foreignKey(rel.JoinForeignKey, owner.Name()+"ID")
+		rel.JoinReferences = foreignKey(rel.JoinReferences, related.Name()+"ID")
+	}
+	return rel
+}
+
+func foreignKey(declared, inferred string) string {
+	if declared != "" {
+		return declared
+	}
+	return inferred
+}
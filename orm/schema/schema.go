@@ -0,0 +1,273 @@
+package schema
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"go/ast"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/orm/dialect"
+)
+
+// TagName of struct field, eg. `orm:"column:name;not_null;index"`
+const TagName = "orm"
+
+// Field represents a column of database
+type Field struct {
+	Name          string // column name
+	FieldName     string // name of go struct field
+	Type          string // column type
+	Tag           string // raw tag
+	PrimaryKey    bool
+	AutoIncrement bool
+	NotNull       bool
+	Unique        bool
+	Default       string
+	RenameFrom    string // old column name, used by migration
+	Index         []int  // index sequence for reflect.Value.FieldByIndex
+	GoType        reflect.Type
+}
+
+// Index represents an index of table
+type Index struct {
+	Name    string
+	Columns []string
+	Unique  bool
+}
+
+// Tabler customizes the table name of a model
+type Tabler interface {
+	TableName() string
+}
+
+// Schema represents a table of database
+type Schema struct {
+	Model         any
+	Name          string // table name
+	Fields        []*Field
+	FieldNames    []string // column names
+	PrimaryKey    *Field
+	Indexes       []*Index
+	Relationships []*Relationship
+	// fields managed by session, nil if absent
+	DeletedAt *Field // soft delete
+	Version   *Field // optimistic locking
+	CreatedAt *Field
+	UpdatedAt *Field
+	fieldMap  map[string]*Field
+}
+
+func (s *Schema) GetField(name string) *Field {
+	return s.fieldMap[name]
+}
+
+// FieldByName returns field by column name or go field name
+func (s *Schema) FieldByName(name string) *Field {
+	if f, ok := s.fieldMap[name]; ok {
+		return f
+	}
+	for _, f := range s.Fields {
+		if f.FieldName == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// RecordValues returns values of all fields in dest
+func (s *Schema) RecordValues(dest any) []any {
+	destValue := reflect.Indirect(reflect.ValueOf(dest))
+	var fieldValues []any
+	for _, field := range s.Fields {
+		fieldValues = append(fieldValues, destValue.FieldByIndex(field.Index).Interface())
+	}
+	return fieldValues
+}
+
+// Parse parses a struct or pointer of struct into Schema, an error is returned
+// if dest isn't a struct or a field has no column type in dialect
+func Parse(dest any, d dialect.Dialect) (*Schema, error) {
+	modelValue := reflect.Indirect(reflect.ValueOf(dest))
+	if !modelValue.IsValid() || modelValue.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("parse schema of %T: model must be a struct or pointer of struct", dest)
+	}
+	modelType := modelValue.Type()
+	schema := &Schema{
+		Model:    dest,
+		Name:     tableName(dest, modelType),
+		fieldMap: make(map[string]*Field),
+	}
+
+	if err := schema.parseFields(modelType, modelType, nil, d); err != nil {
+		return nil, fmt.Errorf("parse schema of %s: %w", modelType, err)
+	}
+
+	if schema.PrimaryKey == nil {
+		// field named ID is the primary key by convention
+		for _, field := range schema.Fields {
+			if field.FieldName == "ID" || field.FieldName == "Id" {
+				field.PrimaryKey = true
+				if !strings.Contains(field.Tag, "auto_increment") {
+					field.AutoIncrement = isInteger(modelType.FieldByIndex(field.Index).Type)
+				}
+				schema.PrimaryKey = field
+				break
+			}
+		}
+	}
+
+	schema.parseConventions()
+
+	indexes := map[string]*Index{}
+	for _, field := range schema.Fields {
+		if field.Tag == "" {
+			continue
+		}
+		for _, option := range strings.Split(field.Tag, ";") {
+			key, value := splitOption(option)
+			switch key {
+			case "index", "unique_index":
+				name := value
+				if name == "" {
+					prefix := "idx"
+					if key == "unique_index" {
+						prefix = "uidx"
+					}
+					name = fmt.Sprintf("%s_%s_%s", prefix, schema.Name, field.Name)
+				}
+				index, ok := indexes[name]
+				if !ok {
+					index = &Index{Name: name, Unique: key == "unique_index"}
+					indexes[name] = index
+					schema.Indexes = append(schema.Indexes, index)
+				}
+				index.Columns = append(index.Columns, field.Name)
+			}
+		}
+	}
+	return schema, nil
+}
+
+func (s *Schema) parseFields(owner, modelType reflect.Type, parent []int, d dialect.Dialect) error {
+	for i := 0; i < modelType.NumField(); i++ {
+		p := modelType.Field(i)
+		tag, hasTag := p.Tag.Lookup(TagName)
+		if tag == "-" || (!p.Anonymous && !ast.IsExported(p.Name)) {
+			continue
+		}
+
+		index := make([]int, 0, len(parent)+1)
+		index = append(append(index, parent...), i)
+		if p.Anonymous && p.Type.Kind() == reflect.Struct && p.Type != timeType {
+			// flatten fields of embedded struct
+			if err := s.parseFields(owner, p.Type, index, d); err != nil {
+				return err
+			}
+			continue
+		}
+		if !ast.IsExported(p.Name) {
+			continue
+		}
+		if related, isSlice := relatedType(p.Type); related != nil && !strings.Contains(tag, "type:") {
+			s.Relationships = append(s.Relationships, parseRelationship(owner, p, index, related, isSlice))
+			continue
+		}
+
+		field := &Field{
+			Name:      p.Name,
+			FieldName: p.Name,
+			Index:     index,
+			GoType:    p.Type,
+		}
+		if hasTag {
+			field.Tag = tag
+			parseTag(field, tag)
+		}
+		if field.Type == "" {
+			typ, err := d.DataTypeOf(columnValue(p.Type))
+			if err != nil {
+				return fmt.Errorf("field %s: %w", p.Name, err)
+			}
+			field.Type = typ
+		}
+		if field.PrimaryKey && s.PrimaryKey == nil {
+			s.PrimaryKey = field
+		}
+
+		s.Fields = append(s.Fields, field)
+		s.FieldNames = append(s.FieldNames, field.Name)
+		s.fieldMap[field.Name] = field
+	}
+	return nil
+}
+
+func parseTag(field *Field, tag string) {
+	for _, option := range strings.Split(tag, ";") {
+		key, value := splitOption(option)
+		switch key {
+		case "column":
+			field.Name = value
+		case "type":
+			field.Type = value
+		case "primary_key", "pk":
+			field.PrimaryKey = true
+		case "auto_increment":
+			field.AutoIncrement = value != "false"
+		case "not_null":
+			field.NotNull = true
+		case "unique":
+			field.Unique = true
+		case "default":
+			field.Default = value
+		case "rename_from":
+			field.RenameFrom = value
+		}
+	}
+}
+
+func splitOption(option string) (key, value string) {
+	option = strings.TrimSpace(option)
+	if i := strings.IndexByte(option, ':'); i >= 0 {
+		return strings.TrimSpace(option[:i]), strings.TrimSpace(option[i+1:])
+	}
+	return option, ""
+}
+
+func tableName(dest any, modelType reflect.Type) string {
+	if t, ok := dest.(Tabler); ok {
+		return t.TableName()
+	}
+	if t, ok := reflect.New(modelType).Interface().(Tabler); ok {
+		return t.TableName()
+	}
+	return modelType.Name()
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+// columnValue returns a zero value which decides the column type of typ,
+// pointers are dereferenced and valuers like sql.NullString use the type of their first field
+func columnValue(typ reflect.Type) reflect.Value {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() == reflect.Struct && typ != timeType && typ.NumField() > 0 &&
+		(typ.Implements(valuerType) || reflect.PtrTo(typ).Implements(valuerType)) {
+		return columnValue(typ.Field(0).Type)
+	}
+	return reflect.New(typ).Elem()
+}
+
+func isInteger(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
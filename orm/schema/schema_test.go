@@ -0,0 +1,39 @@
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/pedrogao/orm/dialect"
+)
+
+type user struct {
+	ID   int
+	Name string `orm:"index"`
+}
+
+type withMap struct {
+	ID    int
+	Attrs map[string]string
+}
+
+func TestParse(t *testing.T) {
+	d, _ := dialect.GetDialect("sqlite3")
+	s, err := Parse(&user{}, d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "user" || s.PrimaryKey == nil || s.PrimaryKey.Name != "ID" || !s.PrimaryKey.AutoIncrement {
+		t.Errorf("unexpected schema %+v", s)
+	}
+	if len(s.Indexes) != 1 || s.Indexes[0].Name != "idx_user_Name" {
+		t.Errorf("unexpected indexes %+v", s.Indexes)
+	}
+
+	if _, err = Parse(&withMap{}, d); !errors.Is(err, dialect.ErrUnsupportedType) {
+		t.Errorf("parse map field err = %v, want ErrUnsupportedType", err)
+	}
+	if _, err = Parse(1, d); err == nil {
+		t.Error("parse int: want err")
+	}
+}
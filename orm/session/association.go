@@ -0,0 +1,604 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pedrogao/orm/clause"
+	"github.com/pedrogao/orm/schema"
+)
+
+// Preload loads associations of queried records by path, eg. Preload("Orders.Items"),
+// associations are batch loaded with one IN query per level
+func (s *Session) Preload(path string) *Session {
+	s.preloads = append(s.preloads, path)
+	return s
+}
+
+// schemaOf parses the schema of a related model type
+func (s *Session) schemaOf(typ reflect.Type) (*schema.Schema, error) {
+	return schema.Parse(reflect.New(typ).Interface(), s.dialect)
+}
+
+// CreateJoinTables creates join tables of many to many associations if not exist
+func (s *Session) CreateJoinTables() error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range table.Relationships {
+		if rel.Kind != schema.ManyToMany {
+			continue
+		}
+		related, err := s.schemaOf(rel.Type)
+		if err != nil {
+			return err
+		}
+		if table.PrimaryKey == nil || related.PrimaryKey == nil {
+			return fmt.Errorf("many to many %s.%s: both models need primary key", table.Name, rel.Name)
+		}
+
+		jfk, jref := s.quote(rel.JoinForeignKey), s.quote(rel.JoinReferences)
+		sql := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s %s, %s %s, PRIMARY KEY (%s, %s))",
+			s.quote(rel.JoinTable), jfk, table.PrimaryKey.Type, jref, related.PrimaryKey.Type, jfk, jref)
+		if _, err := s.clone().Raw(sql).Exec(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preload loads associations of parents by paths, paths sharing the same
+// association are loaded once, eg. Orders.Items and Orders.User
+func (s *Session) preload(table *schema.Schema, parents []reflect.Value, paths []string) error {
+	var names []string
+	nested := map[string][]string{}
+	for _, path := range paths {
+		name, rest := path, ""
+		if i := strings.IndexByte(path, '.'); i >= 0 {
+			name, rest = path[:i], path[i+1:]
+		}
+		if _, ok := nested[name]; !ok {
+			names = append(names, name)
+			nested[name] = nil
+		}
+		if rest != "" {
+			nested[name] = append(nested[name], rest)
+		}
+	}
+
+	for _, name := range names {
+		rel := table.Relationship(name)
+		if rel == nil {
+			return fmt.Errorf("preload: %s has no association %s", table.Name, name)
+		}
+		if len(parents) == 0 {
+			continue
+		}
+
+		related, err := s.schemaOf(rel.Type)
+		if err != nil {
+			return err
+		}
+		switch rel.Kind {
+		case schema.HasOne, schema.HasMany:
+			err = s.preloadHas(table, related, rel, parents)
+		case schema.BelongsTo:
+			err = s.preloadBelongsTo(table, related, rel, parents)
+		case schema.ManyToMany:
+			err = s.preloadManyToMany(table, related, rel, parents)
+		}
+		if err != nil {
+			return err
+		}
+		if len(nested[name]) == 0 {
+			continue
+		}
+
+		var children []reflect.Value
+		for _, parent := range parents {
+			children = append(children, structValues(parent.FieldByIndex(rel.Index))...)
+		}
+		if err = s.preload(related, children, nested[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// preloadHas loads related records holding foreign keys of parents
+func (s *Session) preloadHas(table, related *schema.Schema, rel *schema.Relationship, parents []reflect.Value) error {
+	ref, err := referenceField(table, rel.References)
+	if err != nil {
+		return err
+	}
+	fk := related.FieldByName(rel.ForeignKey)
+	if fk == nil {
+		return fmt.Errorf("association %s: foreign key %s not found in %s", rel.Name, rel.ForeignKey, related.Name)
+	}
+
+	records, err := s.findRelated(rel.Type, fk.Name, fieldKeys(parents, ref))
+	if err != nil {
+		return err
+	}
+	groups := groupBy(records, fk)
+	for _, parent := range parents {
+		setRelated(parent.FieldByIndex(rel.Index), groups[keyOf(parent.FieldByIndex(ref.Index))])
+	}
+	return nil
+}
+
+// preloadBelongsTo loads related records referenced by foreign keys of parents
+func (s *Session) preloadBelongsTo(table, related *schema.Schema, rel *schema.Relationship, parents []reflect.Value) error {
+	fk := table.FieldByName(rel.ForeignKey)
+	if fk == nil {
+		return fmt.Errorf("association %s: foreign key %s not found in %s", rel.Name, rel.ForeignKey, table.Name)
+	}
+	ref, err := referenceField(related, rel.References)
+	if err != nil {
+		return err
+	}
+
+	records, err := s.findRelated(rel.Type, ref.Name, fieldKeys(parents, fk))
+	if err != nil {
+		return err
+	}
+	groups := groupBy(records, ref)
+	for _, parent := range parents {
+		setRelated(parent.FieldByIndex(rel.Index), groups[keyOf(parent.FieldByIndex(fk.Index))])
+	}
+	return nil
+}
+
+// preloadManyToMany loads pairs of join table, then related records of pairs
+func (s *Session) preloadManyToMany(table, related *schema.Schema, rel *schema.Relationship, parents []reflect.Value) error {
+	if table.PrimaryKey == nil || related.PrimaryKey == nil {
+		return fmt.Errorf("many to many %s.%s: both models need primary key", table.Name, rel.Name)
+	}
+
+	pairs := map[string][]string{}
+	var refs []any
+	seen := map[string]bool{}
+	for _, keys := range s.chunks(fieldKeys(parents, table.PrimaryKey)) {
+		desc, vars := clause.In(s.quote(rel.JoinForeignKey), keys...)
+		rows, err := s.clone().Raw(fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s", s.quote(rel.JoinForeignKey),
+			s.quote(rel.JoinReferences), s.quote(rel.JoinTable), desc), vars...).QueryRows()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var owner, ref any
+			if err = rows.Scan(&owner, &ref); err != nil {
+				_ = rows.Close()
+				return err
+			}
+			refKey := keyOf(reflect.ValueOf(ref))
+			pairs[keyOf(reflect.ValueOf(owner))] = append(pairs[keyOf(reflect.ValueOf(owner))], refKey)
+			if !seen[refKey] {
+				seen[refKey] = true
+				refs = append(refs, ref)
+			}
+		}
+		err = rows.Err()
+		_ = rows.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	records, err := s.findRelated(rel.Type, related.PrimaryKey.Name, refs)
+	if err != nil {
+		return err
+	}
+	groups := groupBy(records, related.PrimaryKey)
+	for _, parent := range parents {
+		var matched []reflect.Value
+		for _, refKey := range pairs[keyOf(parent.FieldByIndex(table.PrimaryKey.Index))] {
+			matched = append(matched, groups[refKey]...)
+		}
+		setRelated(parent.FieldByIndex(rel.Index), matched)
+	}
+	return nil
+}
+
+// findRelated queries records of typ whose column is in keys, keys are
+// queried in chunks within the placeholder limit of dialect
+func (s *Session) findRelated(typ reflect.Type, column string, keys []any) ([]reflect.Value, error) {
+	var found []reflect.Value
+	for _, chunk := range s.chunks(keys) {
+		records := reflect.New(reflect.SliceOf(typ))
+		if err := s.clone().In(column, chunk...).Find(records.Interface()); err != nil {
+			return nil, err
+		}
+		found = append(found, structValues(records.Elem())...)
+	}
+	return found, nil
+}
+
+// chunks splits keys into chunks within the placeholder limit of dialect
+func (s *Session) chunks(keys []any) [][]any {
+	size := s.batchSize(0, 1)
+	var chunks [][]any
+	for start := 0; start < len(keys); start += size {
+		end := start + size
+		if end > len(keys) {
+			end = len(keys)
+		}
+		chunks = append(chunks, keys[start:end])
+	}
+	return chunks
+}
+
+// insertWithAssociations inserts values one by one with associations cascading on save
+func (s *Session) insertWithAssociations(table *schema.Schema, values []any) (affected int64, err error) {
+	err = s.Transaction(func(s *Session) error {
+		for _, value := range values {
+			dest := reflect.Indirect(reflect.ValueOf(value))
+			if !dest.CanAddr() {
+				return fmt.Errorf("insert %T with associations: must be a pointer", value)
+			}
+			if err := s.saveBelongsTo(table, dest); err != nil {
+				return err
+			}
+
+			n, err := s.insert(table, []any{value})
+			if err != nil {
+				return err
+			}
+			affected += n
+
+			if err = s.saveAssociations(table, dest); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// saveBelongsTo saves related records before owner, so that foreign keys of owner are known
+func (s *Session) saveBelongsTo(table *schema.Schema, dest reflect.Value) error {
+	for _, rel := range table.Relationships {
+		if rel.Kind != schema.BelongsTo || !rel.CascadeSave {
+			continue
+		}
+		records := structValues(dest.FieldByIndex(rel.Index))
+		if len(records) == 0 {
+			continue
+		}
+
+		related, err := s.schemaOf(rel.Type)
+		if err != nil {
+			return err
+		}
+		if err := s.saveRelated(related, records[0]); err != nil {
+			return err
+		}
+		fk := table.FieldByName(rel.ForeignKey)
+		ref, err := referenceField(related, rel.References)
+		if err != nil {
+			return err
+		}
+		if fk == nil {
+			return fmt.Errorf("association %s: foreign key %s not found in %s", rel.Name, rel.ForeignKey, table.Name)
+		}
+		if err = setKey(dest.FieldByIndex(fk.Index), records[0].FieldByIndex(ref.Index)); err != nil {
+			return fmt.Errorf("association %s: foreign key %s.%s: %w", rel.Name, table.Name, fk.Name, err)
+		}
+	}
+	return nil
+}
+
+// saveAssociations saves has one, has many and many to many records after owner
+func (s *Session) saveAssociations(table *schema.Schema, dest reflect.Value) error {
+	for _, rel := range table.Relationships {
+		if !rel.CascadeSave || rel.Kind == schema.BelongsTo {
+			continue
+		}
+		records := structValues(dest.FieldByIndex(rel.Index))
+		related, err := s.schemaOf(rel.Type)
+		if err != nil {
+			return err
+		}
+
+		switch rel.Kind {
+		case schema.HasOne, schema.HasMany:
+			ref, err := referenceField(table, rel.References)
+			if err != nil {
+				return err
+			}
+			fk := related.FieldByName(rel.ForeignKey)
+			if fk == nil {
+				return fmt.Errorf("association %s: foreign key %s not found in %s", rel.Name, rel.ForeignKey, related.Name)
+			}
+			for _, record := range records {
+				if err = setKey(record.FieldByIndex(fk.Index), dest.FieldByIndex(ref.Index)); err != nil {
+					return fmt.Errorf("association %s: foreign key %s.%s: %w", rel.Name, related.Name, fk.Name, err)
+				}
+				if err = s.saveRelated(related, record); err != nil {
+					return err
+				}
+			}
+		case schema.ManyToMany:
+			if table.PrimaryKey == nil || related.PrimaryKey == nil {
+				return fmt.Errorf("many to many %s.%s: both models need primary key", table.Name, rel.Name)
+			}
+			for _, record := range records {
+				if err := s.saveRelated(related, record); err != nil {
+					return err
+				}
+				columns := []string{rel.JoinForeignKey, rel.JoinReferences}
+				sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?, ?) %s", s.quote(rel.JoinTable),
+					strings.Join(s.quoteAll(columns), ", "), s.dialect.UpsertSQL(columns, nil))
+				if _, err := s.clone().Raw(sql, dest.FieldByIndex(table.PrimaryKey.Index).Interface(),
+					record.FieldByIndex(related.PrimaryKey.Index).Interface()).Exec(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// saveRelated inserts record if its primary key is zero, otherwise updates it
+func (s *Session) saveRelated(related *schema.Schema, record reflect.Value) error {
+	if pk := related.PrimaryKey; pk != nil && !record.FieldByIndex(pk.Index).IsZero() {
+		_, err := s.clone().Update(record.Addr().Interface())
+		return err
+	}
+	_, err := s.clone().Insert(record.Addr().Interface())
+	return err
+}
+
+// deleteWithAssociations deletes associations cascading on delete, then records
+func (s *Session) deleteWithAssociations(table *schema.Schema) (affected int64, err error) {
+	desc, vars := s.where.Build()
+	err = s.Transaction(func(s *Session) error {
+		for _, rel := range table.Relationships {
+			if !rel.CascadeDelete || rel.Kind == schema.BelongsTo {
+				continue
+			}
+
+			related, err := s.schemaOf(rel.Type)
+			if err != nil {
+				return err
+			}
+			switch rel.Kind {
+			case schema.HasOne, schema.HasMany:
+				ref, err := referenceField(table, rel.References)
+				if err != nil {
+					return err
+				}
+				keys, err := s.pluck(table, ref.Name, desc, vars)
+				if err != nil {
+					return err
+				}
+				fk := related.FieldByName(rel.ForeignKey)
+				if fk == nil {
+					return fmt.Errorf("association %s: foreign key %s not found in %s", rel.Name, rel.ForeignKey, related.Name)
+				}
+				if len(keys) == 0 {
+					continue
+				}
+				for _, chunk := range s.chunks(keys) {
+					child := s.clone().Model(related.Model).In(fk.Name, chunk...)
+					child.unscoped = s.unscoped
+					if _, err = child.Delete(); err != nil {
+						return err
+					}
+				}
+			case schema.ManyToMany:
+				if s.softDelete(table) {
+					// join rows are kept for soft deleted records
+					continue
+				}
+				if table.PrimaryKey == nil {
+					return fmt.Errorf("many to many %s.%s: model needs primary key", table.Name, rel.Name)
+				}
+				keys, err := s.pluck(table, table.PrimaryKey.Name, desc, vars)
+				if err != nil {
+					return err
+				}
+				if len(keys) == 0 {
+					continue
+				}
+				for _, chunk := range s.chunks(keys) {
+					in, inVars := clause.In(s.quote(rel.JoinForeignKey), chunk...)
+					if _, err = s.clone().Raw(fmt.Sprintf("DELETE FROM %s WHERE %s", s.quote(rel.JoinTable), in),
+						inVars...).Exec(); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		var err error
+		affected, err = s.delete(table)
+		return err
+	})
+	return
+}
+
+// pluck queries values of column from table matched by predicate desc
+func (s *Session) pluck(table *schema.Schema, column, desc string, vars []any) ([]any, error) {
+	q := s.clone().Model(table.Model).Select(column)
+	q.unscoped = s.unscoped
+	if desc != "" {
+		q.Where(desc, vars...)
+	}
+	sql, sqlVars := q.buildSelect(table)
+	rows, err := q.Raw(sql, sqlVars...).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []any
+	for rows.Next() {
+		var value any
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+func cascadeSave(table *schema.Schema) bool {
+	for _, rel := range table.Relationships {
+		if rel.CascadeSave {
+			return true
+		}
+	}
+	return false
+}
+
+func cascadeDelete(table *schema.Schema) bool {
+	for _, rel := range table.Relationships {
+		if rel.CascadeDelete && rel.Kind != schema.BelongsTo {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceField returns the field named by references, primary key by default
+func referenceField(table *schema.Schema, references string) (*schema.Field, error) {
+	if references == "" {
+		if table.PrimaryKey == nil {
+			return nil, fmt.Errorf("association of %s: primary key not found", table.Name)
+		}
+		return table.PrimaryKey, nil
+	}
+	if field := table.FieldByName(references); field != nil {
+		return field, nil
+	}
+	return nil, fmt.Errorf("association of %s: references %s not found", table.Name, references)
+}
+
+// structValues returns addressable structs held by v, which is a struct, pointer or slice
+func structValues(v reflect.Value) []reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		return structValues(v.Elem())
+	case reflect.Slice:
+		values := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			values = append(values, structValues(v.Index(i))...)
+		}
+		return values
+	case reflect.Struct:
+		if v.IsZero() {
+			return nil
+		}
+		return []reflect.Value{v}
+	}
+	return nil
+}
+
+// fieldKeys returns distinct values of field in records
+func fieldKeys(records []reflect.Value, field *schema.Field) []any {
+	seen := map[string]bool{}
+	var keys []any
+	for _, record := range records {
+		v := record.FieldByIndex(field.Index)
+		if key := keyOf(v); !seen[key] && !v.IsZero() {
+			seen[key] = true
+			keys = append(keys, v.Interface())
+		}
+	}
+	return keys
+}
+
+func groupBy(records []reflect.Value, field *schema.Field) map[string][]reflect.Value {
+	groups := map[string][]reflect.Value{}
+	for _, record := range records {
+		key := keyOf(record.FieldByIndex(field.Index))
+		groups[key] = append(groups[key], record)
+	}
+	return groups
+}
+
+// keyOf normalizes a key value, so that int and int64 or string and []byte are matched
+func keyOf(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if b, ok := v.Interface().([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// setKey sets a key value into field, integers of different types are converted,
+// and a pointer field is allocated
+func setKey(field, value reflect.Value) error {
+	if value.Type().AssignableTo(field.Type()) {
+		field.Set(value)
+		return nil
+	}
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			field.Set(reflect.Zero(field.Type()))
+			return nil
+		}
+		return setKey(field, value.Elem())
+	}
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setKey(ptr.Elem(), value); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if id, ok := toInt64(value.Interface()); ok {
+		switch field.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			setInt(field, id)
+			return nil
+		}
+	} else if field.Kind() == value.Kind() && value.Type().ConvertibleTo(field.Type()) {
+		field.Set(value.Convert(field.Type()))
+		return nil
+	}
+	return fmt.Errorf("can't set %s into %s", value.Type(), field.Type())
+}
+
+// setRelated sets records into field, which is a struct, pointer or slice of them
+func setRelated(field reflect.Value, records []reflect.Value) {
+	typ := field.Type()
+	if typ.Kind() == reflect.Slice {
+		slice := reflect.MakeSlice(typ, 0, len(records))
+		for _, record := range records {
+			slice = reflect.Append(slice, fitType(record, typ.Elem()))
+		}
+		field.Set(slice)
+		return
+	}
+
+	if len(records) == 0 {
+		field.Set(reflect.Zero(typ))
+		return
+	}
+	field.Set(fitType(records[0], typ))
+}
+
+func fitType(record reflect.Value, typ reflect.Type) reflect.Value {
+	if typ.Kind() == reflect.Ptr {
+		ptr := reflect.New(typ.Elem())
+		ptr.Elem().Set(record)
+		return ptr
+	}
+	return record
+}
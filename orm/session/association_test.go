@@ -0,0 +1,206 @@
+package session
+
+import (
+	"database/sql"
+	"sort"
+	"testing"
+
+	"github.com/pedrogao/orm/dialect"
+)
+
+type Publisher struct {
+	ID   int64
+	Name string
+}
+
+type Book struct {
+	ID          int
+	AuthorID    int // the primary key of Author is int64
+	PublisherID int32
+	Title       string
+	Publisher   *Publisher `orm:"belongs_to;cascade:save"`
+}
+
+type Tag struct {
+	ID   int
+	Name string
+}
+
+type Author struct {
+	ID    int64
+	Name  string
+	Books []Book `orm:"has_many;cascade:save,delete"`
+	Tags  []*Tag `orm:"many2many:author_tags;cascade:save,delete"`
+}
+
+// smallDialect limits placeholders, so that keys are queried in chunks
+type smallDialect struct {
+	dialect.Dialect
+}
+
+func (smallDialect) MaxPlaceholders() int { return 2 }
+
+func newAssociationSession(t *testing.T) *Session {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, smallDialect{d})
+	for _, model := range []any{&Publisher{}, &Book{}, &Tag{}, &Author{}} {
+		if err = s.Model(model).CreateTable(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = s.Model(&Author{}).CreateJoinTables(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSaveAssociations(t *testing.T) {
+	s := newAssociationSession(t)
+	author := &Author{
+		Name:  "Tom",
+		Books: []Book{{Title: "Go", Publisher: &Publisher{Name: "Press"}}, {Title: "SQL"}},
+		Tags:  []*Tag{{Name: "tech"}},
+	}
+	if _, err := s.Insert(author); err != nil {
+		t.Fatal(err)
+	}
+	if author.ID == 0 || author.Tags[0].ID == 0 {
+		t.Fatalf("primary keys aren't written back: %+v", author)
+	}
+	for _, book := range author.Books {
+		if book.ID == 0 || int64(book.AuthorID) != author.ID {
+			t.Fatalf("book %+v, want AuthorID %d", book, author.ID)
+		}
+	}
+	if book := author.Books[0]; book.Publisher.ID == 0 || int64(book.PublisherID) != book.Publisher.ID {
+		t.Fatalf("book %+v, want PublisherID %d", book, book.Publisher.ID)
+	}
+	var pairs int
+	if err := s.Raw("SELECT COUNT(*) FROM author_tags").ScanOne(&pairs); err != nil || pairs != 1 {
+		t.Fatalf("join rows = %d, %v, want 1", pairs, err)
+	}
+}
+
+type Note struct {
+	ID       int
+	ShelfKey string
+}
+
+type Shelf struct {
+	ID    int
+	Notes []Note `orm:"has_many;foreign_key:ShelfKey;cascade:save"`
+}
+
+func TestSaveUnconvertibleForeignKey(t *testing.T) {
+	s := newAssociationSession(t)
+	for _, model := range []any{&Note{}, &Shelf{}} {
+		if err := s.Model(model).CreateTable(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.Insert(&Shelf{Notes: []Note{{}}}); err == nil {
+		t.Fatal("insert with an int key into a string foreign key should fail")
+	}
+	// the owner is rolled back with associations
+	if n, err := s.Model(&Shelf{}).Count(); err != nil || n != 0 {
+		t.Fatalf("shelves = %d, %v, want 0", n, err)
+	}
+}
+
+func insertAuthors(t *testing.T, s *Session, n int) []*Author {
+	t.Helper()
+	tags := []*Tag{{Name: "go"}, {Name: "sql"}, {Name: "rpc"}}
+	var authors []*Author
+	for i := 0; i < n; i++ {
+		author := &Author{
+			Name: string(rune('A' + i)),
+			Books: []Book{
+				{Title: "first", Publisher: &Publisher{Name: "Press"}},
+				{Title: "second"},
+			},
+			Tags: []*Tag{tags[i%len(tags)], tags[(i+1)%len(tags)]},
+		}
+		if _, err := s.Insert(author); err != nil {
+			t.Fatal(err)
+		}
+		authors = append(authors, author)
+	}
+	return authors
+}
+
+func TestPreload(t *testing.T) {
+	s := newAssociationSession(t)
+	authors := insertAuthors(t, s, 5)
+
+	// five authors are more than the placeholders of one statement
+	var found []Author
+	if err := s.Preload("Books.Publisher").Preload("Tags").OrderBy("ID").Find(&found); err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != len(authors) {
+		t.Fatalf("found %d authors, want %d", len(found), len(authors))
+	}
+	for i, author := range found {
+		if len(author.Books) != 2 {
+			t.Fatalf("author %s has books %+v, want 2", author.Name, author.Books)
+		}
+		sort.Slice(author.Books, func(i, j int) bool { return author.Books[i].ID < author.Books[j].ID })
+		if p := author.Books[0].Publisher; p == nil || p.ID != authors[i].Books[0].Publisher.ID {
+			t.Fatalf("author %s book publisher = %+v", author.Name, p)
+		}
+		if author.Books[1].Publisher != nil {
+			t.Fatalf("author %s book without publisher = %+v", author.Name, author.Books[1].Publisher)
+		}
+		var names []string
+		for _, tag := range author.Tags {
+			names = append(names, tag.Name)
+		}
+		sort.Strings(names)
+		want := []string{authors[i].Tags[0].Name, authors[i].Tags[1].Name}
+		sort.Strings(want)
+		if len(names) != 2 || names[0] != want[0] || names[1] != want[1] {
+			t.Fatalf("author %s tags = %v, want %v", author.Name, names, want)
+		}
+	}
+
+	if err := s.Preload("Missing").Find(&found); err == nil {
+		t.Fatal("preload of a missing association should fail")
+	}
+}
+
+func TestCascadeDelete(t *testing.T) {
+	s := newAssociationSession(t)
+	authors := insertAuthors(t, s, 5)
+
+	n, err := s.Model(&Author{}).Where("ID <> ?", authors[0].ID).Delete()
+	if err != nil || n != 4 {
+		t.Fatalf("delete = %d, %v, want 4", n, err)
+	}
+	var books []Book
+	if err = s.Find(&books); err != nil || len(books) != 2 {
+		t.Fatalf("books after cascade = %v, %v, want 2", books, err)
+	}
+	for _, book := range books {
+		if int64(book.AuthorID) != authors[0].ID {
+			t.Fatalf("book %+v of deleted author is kept", book)
+		}
+	}
+	var pairs int
+	if err = s.Raw("SELECT COUNT(*) FROM author_tags").ScanOne(&pairs); err != nil || pairs != 2 {
+		t.Fatalf("join rows = %d, %v, want 2", pairs, err)
+	}
+	// related records of many to many and belongs to are kept
+	if n, err := s.Model(&Tag{}).Count(); err != nil || n != 3 {
+		t.Fatalf("tags = %d, %v, want 3", n, err)
+	}
+	if n, err := s.Model(&Publisher{}).Count(); err != nil || n != 5 {
+		t.Fatalf("publishers = %d, %v, want 5", n, err)
+	}
+}
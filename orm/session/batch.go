@@ -0,0 +1,358 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/orm/clause"
+	"github.com/pedrogao/orm/schema"
+)
+
+// DefaultUpdateBatchSize is the number of records updated in one statement by UpdateBatch
+const DefaultUpdateBatchSize = 200
+
+// InsertBatch inserts a slice of models in batches of batchSize in a transaction,
+// batches are split further to respect the placeholder limit of dialect
+func (s *Session) InsertBatch(values any, batchSize int) (int64, error) {
+	defer s.Clear()
+	objs, err := sliceValues(values)
+	if err != nil || len(objs) == 0 {
+		return 0, err
+	}
+
+	table, err := s.Model(objs[0]).Table()
+	if err != nil {
+		return 0, err
+	}
+	size := s.batchSize(batchSize, len(table.Fields))
+	var affected int64
+	err = s.Transaction(func(s *Session) error {
+		for start := 0; start < len(objs); start += size {
+			end := start + size
+			if end > len(objs) {
+				end = len(objs)
+			}
+			n, err := s.Insert(objs[start:end]...)
+			if err != nil {
+				return err
+			}
+			affected += n
+		}
+		return nil
+	})
+	return affected, err
+}
+
+// Upsert inserts values of the same model, rows conflicting on columns of conflicts are
+// updated by the inserted values of columns in updates, or ignored if updates is empty.
+// UpdatedAt is updated too if model has it.
+func (s *Session) Upsert(conflicts, updates []string, values ...any) (int64, error) {
+	defer s.Clear()
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	table, err := s.Model(values[0]).Table()
+	if err != nil {
+		return 0, err
+	}
+	conflicts = columnNames(table, conflicts)
+	updates = columnNames(table, updates)
+	if f := table.UpdatedAt; f != nil && len(updates) > 0 && !contains(updates, f.Name) {
+		updates = append(updates, f.Name)
+	}
+
+	sql, vars, _, err := s.buildInsert(table, values)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := s.exec(sql+" "+s.dialect.UpsertSQL(conflicts, updates), vars)
+	if err != nil {
+		return 0, err
+	}
+	return affected, s.afterInsert(values)
+}
+
+// UpdateBatch updates columns of a slice of models by their primary keys in a transaction,
+// each batch of batchSize is one statement of CASE expressions, eg.
+//
+//	UPDATE "User" SET "Name" = CASE "ID" WHEN ? THEN ? WHEN ? THEN ? ELSE "Name" END WHERE "ID" IN (?, ?)
+//
+// all fields except the primary key are updated if no column is given, UpdatedAt is set to now,
+// a non-zero Version is checked and bumped like Update, ErrStaleObject is returned and nothing
+// is updated if any record doesn't match. CASE is evaluated linearly by most databases,
+// so batches are kept small, DefaultUpdateBatchSize if batchSize isn't positive.
+// UpdatedAt and Version of models are written back only if all batches are committed.
+// Models of the same primary key are rejected, as only one of them could be applied.
+func (s *Session) UpdateBatch(values any, batchSize int, columns ...string) (int64, error) {
+	defer s.Clear()
+	objs, err := sliceValues(values)
+	if err != nil || len(objs) == 0 {
+		return 0, err
+	}
+
+	table, err := s.Model(objs[0]).Table()
+	if err != nil {
+		return 0, err
+	}
+	pk := table.PrimaryKey
+	if pk == nil {
+		return 0, fmt.Errorf("update batch of %s: model needs primary key", table.Name)
+	}
+	seen := make(map[string]bool, len(objs))
+	for _, obj := range objs {
+		id := reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(pk.Index)
+		key := keyOf(id)
+		if seen[key] {
+			return 0, fmt.Errorf("update batch of %s: duplicate primary key %v", table.Name, id.Interface())
+		}
+		seen[key] = true
+	}
+
+	fields, err := updateFields(table, columns)
+	if err != nil {
+		return 0, err
+	}
+	if len(fields) == 0 {
+		return 0, nil
+	}
+
+	// UpdatedAt is set before statements which bind it, and reverted on failure
+	var restore func()
+	if f := table.UpdatedAt; f != nil {
+		restore = touchBatch(objs, f, time.Now())
+	}
+
+	// soft deleted records are skipped unless unscoped, captured before statements clear it
+	scoped := s.softDelete(table)
+	// each row binds its primary key once per column and once in WHERE, with its version if any
+	placeholders := 2*len(fields) + 1
+	if table.Version != nil {
+		placeholders++
+	}
+	if batchSize <= 0 {
+		batchSize = DefaultUpdateBatchSize
+	}
+	size := s.batchSize(batchSize, placeholders)
+	var affected int64
+	err = s.Transaction(func(s *Session) error {
+		for start := 0; start < len(objs); start += size {
+			end := start + size
+			if end > len(objs) {
+				end = len(objs)
+			}
+			n, err := s.updateBatch(table, fields, objs[start:end], scoped)
+			if err != nil {
+				return err
+			}
+			affected += n
+		}
+		return nil
+	})
+	if err != nil {
+		if restore != nil {
+			restore()
+		}
+		return 0, err
+	}
+
+	if f := table.Version; f != nil {
+		for _, obj := range objs {
+			if v := reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(f.Index); v.CanSet() && !v.IsZero() {
+				current, _ := toInt64(v.Interface())
+				setInt(v, current+1)
+			}
+		}
+	}
+	return affected, nil
+}
+
+// touchBatch sets field of objs to now, and returns the function restoring previous values
+func touchBatch(objs []any, field *schema.Field, now time.Time) func() {
+	previous := make([]reflect.Value, len(objs))
+	for i, obj := range objs {
+		if v := reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(field.Index); v.CanSet() {
+			previous[i] = reflect.New(v.Type()).Elem()
+			previous[i].Set(v)
+			schema.SetTime(v, now)
+		}
+	}
+	return func() {
+		for i, obj := range objs {
+			if previous[i].IsValid() {
+				reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(field.Index).Set(previous[i])
+			}
+		}
+	}
+}
+
+// updateBatch updates objs in one statement, ErrStaleObject is returned if any
+// object with non-zero version doesn't match its record
+func (s *Session) updateBatch(table *schema.Schema, fields []*schema.Field, objs []any, scoped bool) (int64, error) {
+	pk := table.PrimaryKey
+	for _, obj := range objs {
+		if err := s.callHook(beforeUpdate, obj); err != nil {
+			return 0, err
+		}
+	}
+
+	var (
+		sets []string
+		vars []any
+		ids  = make([]any, 0, len(objs))
+	)
+	for _, obj := range objs {
+		ids = append(ids, reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(pk.Index).Interface())
+	}
+	for _, field := range fields {
+		var sb strings.Builder
+		column := s.quote(field.Name)
+		fmt.Fprintf(&sb, "%s = CASE %s", column, s.quote(pk.Name))
+		for i, obj := range objs {
+			sb.WriteString(" WHEN ? THEN ?")
+			vars = append(vars, ids[i], reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(field.Index).Interface())
+		}
+		fmt.Fprintf(&sb, " ELSE %s END", column)
+		sets = append(sets, sb.String())
+	}
+
+	desc, condVars, checked := s.batchConditions(table, objs, ids)
+	if f := table.Version; f != nil {
+		column := s.quote(f.Name)
+		sets = append(sets, fmt.Sprintf("%s = %s + 1", column, column))
+	}
+	if scoped {
+		desc = "(" + desc + ") AND " + s.quote(table.DeletedAt.Name) + " IS NULL"
+	}
+	sql := fmt.Sprintf("UPDATE %s SET %s WHERE %s", s.quote(table.Name), strings.Join(sets, ", "), desc)
+	affected, err := s.exec(sql, append(vars, condVars...))
+	if err != nil {
+		return 0, err
+	}
+	if checked && affected < int64(len(objs)) {
+		return 0, ErrStaleObject
+	}
+
+	for _, obj := range objs {
+		if err = s.callHook(afterUpdate, obj); err != nil {
+			return affected, err
+		}
+	}
+	return affected, nil
+}
+
+// batchConditions matches records of objs by primary keys, and by versions too for
+// objects with non-zero version, eg. "ID" IN (?, ?) OR ("ID" = ? AND "Version" = ?)
+func (s *Session) batchConditions(table *schema.Schema, objs []any, ids []any) (string, []any, bool) {
+	f := table.Version
+	if f == nil {
+		desc, vars := clause.In(s.quote(table.PrimaryKey.Name), ids...)
+		return desc, vars, false
+	}
+
+	var (
+		unchecked []any
+		conds     []string
+		vars      []any
+	)
+	for i, obj := range objs {
+		v := reflect.Indirect(reflect.ValueOf(obj)).FieldByIndex(f.Index)
+		if v.IsZero() {
+			unchecked = append(unchecked, ids[i])
+			continue
+		}
+		current, _ := toInt64(v.Interface())
+		conds = append(conds, fmt.Sprintf("(%s = ? AND %s = ?)", s.quote(table.PrimaryKey.Name), s.quote(f.Name)))
+		vars = append(vars, ids[i], current)
+	}
+	if len(unchecked) > 0 {
+		desc, inVars := clause.In(s.quote(table.PrimaryKey.Name), unchecked...)
+		conds = append([]string{desc}, conds...)
+		vars = append(inVars, vars...)
+	}
+	return strings.Join(conds, " OR "), vars, len(unchecked) < len(objs)
+}
+
+// batchSize returns the number of rows in one statement, limited by
+// the placeholder limit of dialect, n is placeholders of each row
+func (s *Session) batchSize(size, n int) int {
+	limit := s.dialect.MaxPlaceholders() / n
+	if size <= 0 || size > limit {
+		size = limit
+	}
+	if size <= 0 {
+		size = 1
+	}
+	return size
+}
+
+// updateFields returns fields of columns, all fields except the primary key,
+// Version and UpdatedAt if no column is given, UpdatedAt is appended if model has it
+func updateFields(table *schema.Schema, columns []string) ([]*schema.Field, error) {
+	var fields []*schema.Field
+	if len(columns) == 0 {
+		for _, field := range table.Fields {
+			if field != table.PrimaryKey && field != table.Version && field != table.UpdatedAt {
+				fields = append(fields, field)
+			}
+		}
+	} else {
+		for _, column := range columns {
+			field := table.FieldByName(column)
+			if field == nil {
+				return nil, fmt.Errorf("update batch of %s: column %s not found", table.Name, column)
+			}
+			if field != table.UpdatedAt {
+				fields = append(fields, field)
+			}
+		}
+	}
+	if len(fields) > 0 && table.UpdatedAt != nil {
+		fields = append(fields, table.UpdatedAt)
+	}
+	return fields, nil
+}
+
+// sliceValues returns elements of a slice as pointers, so that generated values can be written back
+func sliceValues(values any) ([]any, error) {
+	v := reflect.ValueOf(values)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("batch of %T: must be a slice", values)
+	}
+
+	objs := make([]any, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		elem := v.Index(i)
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		}
+		objs = append(objs, elem.Interface())
+	}
+	return objs, nil
+}
+
+// columnNames maps go field names to column names, unknown names are kept
+func columnNames(table *schema.Schema, names []string) []string {
+	columns := make([]string, 0, len(names))
+	for _, name := range names {
+		if field := table.FieldByName(name); field != nil {
+			name = field.Name
+		}
+		columns = append(columns, name)
+	}
+	return columns
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+type Item struct {
+	ID        int
+	Name      string
+	Version   int
+	UpdatedAt time.Time
+}
+
+func newItems(t testing.TB, s *Session, n int) []Item {
+	t.Helper()
+	if err := s.Model(&Item{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{Name: fmt.Sprintf("item%d", i), Version: 1}
+	}
+	if _, err := s.InsertBatch(items, 0); err != nil {
+		t.Fatal(err)
+	}
+	var found []Item
+	if err := s.OrderBy("ID").Find(&found); err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestUpdateBatchVersion(t *testing.T) {
+	s := newTestSession(t)
+	items := newItems(t, s, 3)
+
+	for i := range items {
+		items[i].Name += "!"
+	}
+	if n, err := s.UpdateBatch(items, 2); err != nil || n != 3 {
+		t.Fatalf("UpdateBatch = %d, %v, want 3", n, err)
+	}
+	for _, item := range items {
+		if item.Version != 2 {
+			t.Fatalf("version of %d = %d, want 2", item.ID, item.Version)
+		}
+	}
+
+	// the second batch is stale, so the first batch is rolled back too
+	stale := append([]Item(nil), items...)
+	stale[2].Version = 1
+	before := stale[0].UpdatedAt
+	for i := range stale {
+		stale[i].Name = "stale"
+	}
+	if _, err := s.UpdateBatch(stale, 2); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("UpdateBatch of stale version err = %v, want ErrStaleObject", err)
+	}
+	if stale[0].Version != 2 || !stale[0].UpdatedAt.Equal(before) {
+		t.Fatalf("failed batch changed models: %+v", stale[0])
+	}
+	if n, _ := s.Model(&Item{}).Where("Name = ?", "stale").Count(); n != 0 {
+		t.Fatalf("records updated by failed batch = %d, want 0", n)
+	}
+}
+
+func TestUpdateBatchDuplicateKeys(t *testing.T) {
+	s := newTestSession(t)
+	items := newItems(t, s, 2)
+
+	dup := []Item{items[0], items[1], items[0]}
+	dup[2].Name = "again"
+	if _, err := s.UpdateBatch(dup, 0); err == nil {
+		t.Fatal("UpdateBatch of duplicate primary keys should fail")
+	}
+	if dup[0].Version != 1 || !dup[0].UpdatedAt.Equal(items[0].UpdatedAt) {
+		t.Fatalf("rejected batch changed models: %+v", dup[0])
+	}
+	if n, _ := s.Model(&Item{}).Where("Name = ?", "again").Count(); n != 0 {
+		t.Fatalf("records updated by rejected batch = %d, want 0", n)
+	}
+}
+
+func BenchmarkInsertBatch(b *testing.B) {
+	s := newTestSession(b)
+	if err := s.Model(&Item{}).CreateTable(); err != nil {
+		b.Fatal(err)
+	}
+	items := make([]Item, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range items {
+			items[j] = Item{Name: "item"}
+		}
+		if _, err := s.InsertBatch(items, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsertOneByOne(b *testing.B) {
+	s := newTestSession(b)
+	if err := s.Model(&Item{}).CreateTable(); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := s.Transaction(func(s *Session) error {
+			for j := 0; j < 100; j++ {
+				if _, err := s.Insert(&Item{Name: "item"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateBatch(b *testing.B) {
+	s := newTestSession(b)
+	items := newItems(b, s, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := s.UpdateBatch(items, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUpdateOneByOne(b *testing.B) {
+	s := newTestSession(b)
+	items := newItems(b, s, 100)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := s.Transaction(func(s *Session) error {
+			for j := range items {
+				if _, err := s.Update(&items[j]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
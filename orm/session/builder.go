@@ -0,0 +1,249 @@
+package session
+
+import (
+	"errors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/pedrogao/orm/clause"
+)
+
+// ErrSelfSubquery is the error of embedding a session in itself, directly or through other
+// sessions, which would be built endlessly. It's returned by the following statement.
+var ErrSelfSubquery = errors.New("session is embedded in itself")
+
+// checkSubquery reports whether values can be embedded into the session, a subquery must be
+// another session, eg. engine.NewSession(), which doesn't embed the session either.
+// ErrSelfSubquery is recorded otherwise, and values should be dropped.
+func (s *Session) checkSubquery(values []any) bool {
+	if s.embedded(values, map[*Session]bool{}) {
+		if s.err == nil {
+			s.err = ErrSelfSubquery
+		}
+		return false
+	}
+	return true
+}
+
+// embedded reports whether the session is reachable from values, sessions visited are skipped
+func (s *Session) embedded(values []any, visited map[*Session]bool) bool {
+	for _, v := range values {
+		switch v := v.(type) {
+		case *Session:
+			if v == s {
+				return true
+			}
+			if !visited[v] {
+				visited[v] = true
+				if s.embedded(v.subqueries(), visited) {
+					return true
+				}
+			}
+		case clause.Expr:
+			if s.embedded(v.Vars, visited) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// subqueries returns vars which are built with the session, vars of raw sql are expanded already
+func (s *Session) subqueries() []any {
+	_, where := s.where.Build()
+	_, having := s.having.Build()
+	vars := append(append([]any{}, where...), having...)
+	for _, join := range s.joins {
+		vars = append(vars, join.Vars...)
+	}
+	for _, cte := range s.ctes {
+		vars = append(vars, cte.query)
+	}
+	return vars
+}
+
+// Where appends a predicate joined by AND, eg. Where("Name = ?", "Tom")
+func (s *Session) Where(desc string, args ...any) *Session {
+	if s.checkSubquery(args) {
+		s.where.And(desc, args...)
+	}
+	return s
+}
+
+// Or appends a predicate joined by OR
+func (s *Session) Or(desc string, args ...any) *Session {
+	if s.checkSubquery(args) {
+		s.where.Or(desc, args...)
+	}
+	return s
+}
+
+// Not appends a negated predicate joined by AND
+func (s *Session) Not(desc string, args ...any) *Session {
+	if s.checkSubquery(args) {
+		s.where.Not(desc, args...)
+	}
+	return s
+}
+
+// In appends predicate `column IN (...)`, a single slice of values is expanded
+func (s *Session) In(column string, values ...any) *Session {
+	desc, vars := clause.In(s.quote(column), expandSlice(values)...)
+	s.where.And(desc, vars...)
+	return s
+}
+
+// OrderBy appends an order, eg. OrderBy("Age DESC")
+func (s *Session) OrderBy(desc string) *Session {
+	s.orders = append(s.orders, desc)
+	return s
+}
+
+func (s *Session) Limit(num int) *Session {
+	s.clause.Set(clause.LIMIT, num)
+	return s
+}
+
+func (s *Session) Offset(num int) *Session {
+	s.clause.Set(clause.OFFSET, num)
+	return s
+}
+
+func (s *Session) GroupBy(columns ...string) *Session {
+	s.groups = append(s.groups, columns...)
+	return s
+}
+
+// Having appends a predicate of groups joined by AND
+func (s *Session) Having(desc string, args ...any) *Session {
+	if s.checkSubquery(args) {
+		s.having.And(desc, args...)
+	}
+	return s
+}
+
+// Select sets the columns or expressions to query, all fields of model are queried by default
+func (s *Session) Select(columns ...string) *Session {
+	s.selects = append(s.selects, columns...)
+	return s
+}
+
+// Expr returns a sql expression with vars, which is composed in place of its placeholder,
+// eg. Update(map[string]any{"Count": Expr("Count + ?", 1)})
+func Expr(sql string, vars ...any) clause.Expr {
+	return clause.Expr{SQL: sql, Vars: vars}
+}
+
+// Joins appends a join, eg. Joins("LEFT JOIN Orders ON Orders.UserID = User.ID"),
+// fields of model are qualified by table name if no columns are selected
+func (s *Session) Joins(desc string, args ...any) *Session {
+	if s.checkSubquery(args) {
+		s.joins = append(s.joins, clause.Expr{SQL: desc, Vars: args})
+	}
+	return s
+}
+
+// cte is a common table expression named in WITH
+type cte struct {
+	name  string
+	query clause.Builder
+}
+
+// With appends a common table expression, query is another *Session or Expr, eg.
+// With("Paid", engine.NewSession().Model(&Order{}).Where("Paid = ?", true))
+func (s *Session) With(name string, query clause.Builder) *Session {
+	if s.checkSubquery([]any{query}) {
+		s.ctes = append(s.ctes, cte{name: name, query: query})
+	}
+	return s
+}
+
+// Build builds the query of session, so that a session is embedded as a subquery,
+// eg. Where("ID IN (?)", sub). The raw sql is used if any, otherwise a SELECT of model.
+// The session is kept as is, so it can be embedded again.
+func (s *Session) Build() (string, []any) {
+	if s.sql.Len() > 0 {
+		return strings.TrimSpace(s.sql.String()), append([]any{}, s.sqlVars...)
+	}
+	table := s.RefTable()
+	if table == nil {
+		return "", nil
+	}
+	where, c := s.where, s.clause.Clone()
+	defer func() { s.where, s.clause = where, c }()
+	return s.buildSelect(table)
+}
+
+// buildSources sets WITH and JOIN parts of clause
+func (s *Session) buildSources() {
+	if len(s.ctes) > 0 {
+		names := make([]string, 0, len(s.ctes))
+		vars := make([]any, 0, len(s.ctes))
+		for _, cte := range s.ctes {
+			names = append(names, s.quote(cte.name))
+			vars = append(vars, cte.query)
+		}
+		s.clause.Set(clause.WITH, append([]any{names}, vars...)...)
+	}
+	if len(s.joins) > 0 {
+		descs := make([]string, 0, len(s.joins))
+		var vars []any
+		for _, join := range s.joins {
+			descs = append(descs, join.SQL)
+			vars = append(vars, join.Vars...)
+		}
+		s.clause.Set(clause.JOIN, append([]any{descs}, vars...)...)
+	}
+}
+
+// buildConditions sets WHERE, GROUP BY, HAVING and ORDER BY parts of clause
+func (s *Session) buildConditions() {
+	if !s.where.Empty() {
+		desc, vars := s.where.Build()
+		s.clause.Set(clause.WHERE, append([]any{desc}, vars...)...)
+	}
+	if len(s.groups) > 0 {
+		s.clause.Set(clause.GROUPBY, s.quoteAll(s.groups))
+	}
+	if !s.having.Empty() {
+		desc, vars := s.having.Build()
+		s.clause.Set(clause.HAVING, append([]any{desc}, vars...)...)
+	}
+	if len(s.orders) > 0 {
+		s.clause.Set(clause.ORDERBY, strings.Join(s.orders, ", "))
+	}
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// quote quotes plain identifiers only, expressions like count(*) are kept
+func (s *Session) quote(name string) string {
+	if !identifierRe.MatchString(name) {
+		return name
+	}
+	return s.dialect.Quote(name)
+}
+
+func (s *Session) quoteAll(names []string) []string {
+	quoted := make([]string, 0, len(names))
+	for _, name := range names {
+		quoted = append(quoted, s.quote(name))
+	}
+	return quoted
+}
+
+func expandSlice(values []any) []any {
+	if len(values) != 1 {
+		return values
+	}
+	v := reflect.ValueOf(values[0])
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+	expanded := make([]any, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		expanded = append(expanded, v.Index(i).Interface())
+	}
+	return expanded
+}
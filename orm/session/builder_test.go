@@ -0,0 +1,79 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSubqueryReused(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}, &User{Name: "Sam", Age: 20}, &User{Name: "Amy", Age: 30}); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := New(s.db, s.dialect).Model(&User{}).Select("ID").Where("Age > ?", 18).Limit(5)
+	want, wantVars := sub.Build()
+	for i := 0; i < 2; i++ {
+		var users []User
+		if err := s.Where("ID IN (?)", sub).OrderBy("ID").Find(&users); err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 2 || users[0].Name != "Sam" || users[1].Name != "Amy" {
+			t.Fatalf("find #%d = %v", i, users)
+		}
+	}
+	if got, vars := sub.Build(); got != want || len(vars) != len(wantVars) {
+		t.Fatalf("subquery after reuse = %q %v, want %q %v", got, vars, want, wantVars)
+	}
+
+	raw := New(s.db, s.dialect).Raw("SELECT ID FROM User WHERE Name = ?", "Tom")
+	for i := 0; i < 2; i++ {
+		var users []User
+		if err := s.With("Picked", raw).Where("ID IN (SELECT ID FROM Picked)").Find(&users); err != nil {
+			t.Fatal(err)
+		}
+		if len(users) != 1 || users[0].Name != "Tom" {
+			t.Fatalf("find with cte #%d = %v", i, users)
+		}
+	}
+}
+
+func TestSelfSubquery(t *testing.T) {
+	s := newTestSession(t)
+	var users []User
+	tests := map[string]func() error{
+		"With":  func() error { return s.With("Self", s).Find(&users) },
+		"Where": func() error { return s.Where("ID IN (?)", s).Find(&users) },
+		"Expr":  func() error { return s.Where("ID IN (?)", Expr("SELECT ID FROM (?)", s)).Find(&users) },
+		"Raw":   func() error { _, err := s.Raw("SELECT * FROM (?)", s).Exec(); return err },
+		"Count": func() error { _, err := s.Model(&User{}).Joins("JOIN (?) AS u", s).Count(); return err },
+	}
+	for name, f := range tests {
+		if err := f(); !errors.Is(err, ErrSelfSubquery) {
+			t.Fatalf("%s of the session itself err = %v, want ErrSelfSubquery", name, err)
+		}
+	}
+	// the error is cleared by the statement
+	if err := s.Find(&users); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSubqueryCycle(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+	a := New(s.db, s.dialect).Model(&User{}).Select("ID")
+	b := New(s.db, s.dialect).Model(&User{}).Select("ID").Where("ID IN (?)", a)
+	c := New(s.db, s.dialect).Model(&User{}).Select("ID").With("B", b)
+
+	var users []User
+	if err := a.Where("ID IN (?)", c).Find(&users); !errors.Is(err, ErrSelfSubquery) {
+		t.Fatalf("find of a cycle err = %v, want ErrSelfSubquery", err)
+	}
+	// b and c are kept, and still embed a
+	if err := s.Where("ID IN (?)", c).Find(&users); err != nil || len(users) != 1 {
+		t.Fatalf("find = %v, %v, want Tom", users, err)
+	}
+}
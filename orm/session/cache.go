@@ -0,0 +1,150 @@
+package session
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/orm/cache"
+)
+
+// WithCache caches results of Find, First and Count by c, results are cached for ttl
+// by default, or only if the query is marked by Cache if ttl is zero
+func WithCache(c cache.Cache, ttl time.Duration) Option {
+	return func(s *Session) {
+		s.cache = c
+		s.cacheTTL = ttl
+	}
+}
+
+// Cache caches the result of the following query for ttl, never expires if ttl isn't positive
+func (s *Session) Cache(ttl time.Duration) *Session {
+	s.queryCache = 1
+	s.queryTTL = ttl
+	return s
+}
+
+// NoCache skips the cache for the following query
+func (s *Session) NoCache() *Session {
+	s.queryCache = -1
+	return s
+}
+
+// cached returns the ttl to cache query, false if it shouldn't be cached, queries in
+// transactions aren't cached as they may read uncommitted data, nor queries reading other
+// tables by joins, CTEs or subqueries, as results are invalidated by the table of model only
+func (s *Session) cached(query string) (time.Duration, bool) {
+	switch {
+	case s.cache == nil || s.tx != nil || s.queryCache < 0 || s.err != nil:
+		return 0, false
+	case len(s.joins) > 0 || len(s.ctes) > 0 || len(selectRe.FindAllStringIndex(query, 2)) > 1:
+		return 0, false
+	case s.queryCache > 0:
+		return s.queryTTL, true
+	}
+	return s.cacheTTL, s.cacheTTL > 0
+}
+
+var selectRe = regexp.MustCompile(`(?i)\bSELECT\b`)
+
+// cacheKey returns the key of query result decoded into typ,
+// pointers of vars are dereferenced, so that keys of equal values are equal
+func cacheKey(typ reflect.Type, query string, vars []any) string {
+	var sb strings.Builder
+	sb.WriteString(typ.String())
+	sb.WriteString("|")
+	sb.WriteString(strings.Join(strings.Fields(query), " "))
+	for _, v := range vars {
+		rv := reflect.ValueOf(v)
+		for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+			rv = rv.Elem()
+		}
+		switch {
+		case !rv.IsValid() || rv.Kind() == reflect.Ptr:
+			sb.WriteString("|nil")
+		case rv.Type() == timeType:
+			// monotonic clock and location don't change the value
+			fmt.Fprintf(&sb, "|time.Time(%s)", rv.Interface().(time.Time).UTC().Format(time.RFC3339Nano))
+		default:
+			fmt.Fprintf(&sb, "|%#v", rv.Interface())
+		}
+	}
+	return sb.String()
+}
+
+// writeRe matches the table written by a statement
+var writeRe = regexp.MustCompile(`(?is)^\s*(?:INSERT\s+(?:OR\s+\w+\s+)?INTO|REPLACE\s+INTO|UPDATE|DELETE\s+FROM|` +
+	`(?:CREATE|DROP|ALTER|TRUNCATE)\s+TABLE(?:\s+IF\s+(?:NOT\s+)?EXISTS)?)\s+([^\s(]+)`)
+
+// writeKeywordRe matches keywords of writes, which may follow WITH
+var writeKeywordRe = regexp.MustCompile(`(?i)\b(?:INSERT|UPDATE|DELETE|REPLACE)\b`)
+
+// readOnly reports whether query only reads, eg. SELECT, or WITH without writes
+func readOnly(query string) bool {
+	query = strings.ToUpper(strings.TrimSpace(query))
+	return strings.HasPrefix(query, "SELECT") ||
+		strings.HasPrefix(query, "WITH") && !writeKeywordRe.MatchString(query)
+}
+
+// allTables is recorded in transactions for writes whose table is unknown
+const allTables = "*"
+
+// invalidate removes cached results of the table written by query, all results
+// are removed if the table is unknown, eg. raw statements, reads are ignored
+func (s *Session) invalidate(query string) {
+	if s.cache == nil || readOnly(query) {
+		return
+	}
+
+	table := allTables
+	if m := writeRe.FindStringSubmatch(query); m != nil {
+		table = tableTag(unquote(m[1]))
+	}
+	if s.txTables != nil {
+		// readers may cache data before commit, invalidated again on commit
+		s.txTables[table] = struct{}{}
+	}
+	s.invalidateTables(table)
+}
+
+func (s *Session) invalidateTables(tables ...string) {
+	for _, table := range tables {
+		if table == allTables {
+			s.cache.Clear()
+			return
+		}
+	}
+	s.cache.Invalidate(tables...)
+}
+
+// tableTag returns the cache tag of table, table names are case-insensitive in sql
+func tableTag(table string) string {
+	return strings.ToLower(table)
+}
+
+// unquote strips quotes of a table name, schema is dropped, eg. "public"."User" to User
+func unquote(name string) string {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.Trim(name, "\"`[]")
+}
+
+// cloneSlice returns a copy of slice, pointed structs are copied too,
+// so that results cached aren't changed by callers
+func cloneSlice(slice reflect.Value) reflect.Value {
+	clone := reflect.MakeSlice(slice.Type(), slice.Len(), slice.Len())
+	reflect.Copy(clone, slice)
+	if slice.Type().Elem().Kind() == reflect.Ptr {
+		for i := 0; i < clone.Len(); i++ {
+			if elem := clone.Index(i); !elem.IsNil() {
+				copied := reflect.New(elem.Type().Elem())
+				copied.Elem().Set(elem.Elem())
+				elem.Set(copied)
+			}
+		}
+	}
+	return clone
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/orm/cache"
+)
+
+func TestCacheKey(t *testing.T) {
+	typ := reflect.TypeOf([]User{})
+	a, b := 18, 18
+	if cacheKey(typ, "SELECT ?", []any{&a}) != cacheKey(typ, "SELECT ?", []any{&b}) {
+		t.Error("keys of pointers to equal values differ")
+	}
+	if cacheKey(typ, "SELECT ?", []any{&a}) != cacheKey(typ, "SELECT  ?", []any{18}) {
+		t.Error("keys of pointer and value differ")
+	}
+	b = 20
+	if cacheKey(typ, "SELECT ?", []any{&a}) == cacheKey(typ, "SELECT ?", []any{&b}) {
+		t.Error("keys of different values are equal")
+	}
+	now := time.Now()
+	if cacheKey(typ, "SELECT ?", []any{now}) != cacheKey(typ, "SELECT ?", []any{now.Round(0).In(time.FixedZone("X", 3600))}) {
+		t.Error("keys of equal times differ")
+	}
+	var nilInt *int
+	if cacheKey(typ, "SELECT ?", []any{nilInt}) != cacheKey(typ, "SELECT ?", []any{nil}) {
+		t.Error("keys of nil differ")
+	}
+}
+
+func TestCacheSkipsOtherTables(t *testing.T) {
+	s := newTestSession(t)
+	lru := cache.NewLRU(0)
+	WithCache(lru, time.Minute)(s)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+
+	var users []User
+	queries := []func() error{
+		func() error { return s.Where("Age > ?", 10).Find(&users) },
+		func() error {
+			return s.Joins("JOIN User AS u ON u.ID = User.ID").Find(&users)
+		},
+		func() error {
+			return s.With("Adult", Expr("SELECT * FROM User WHERE Age > ?", 10)).Find(&users)
+		},
+		func() error {
+			return s.Where("ID IN (?)", Expr("SELECT ID FROM User WHERE Age > ?", 10)).Find(&users)
+		},
+	}
+	for _, query := range queries {
+		if err := query(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size := lru.Stats().Size; size != 1 {
+		t.Fatalf("cached results = %d, want 1 of the query without other tables", size)
+	}
+}
+
+func TestCacheInvalidateIgnoresCase(t *testing.T) {
+	s := newTestSession(t)
+	lru := cache.NewLRU(0)
+	WithCache(lru, time.Minute)(s)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, write := range []string{
+		"UPDATE user SET Age = 20",
+		`UPDATE "USER" SET Age = 20`,
+		"INSERT INTO main.User (Name, Age) VALUES ('Sam', 20)",
+	} {
+		var users []User
+		if err := s.Find(&users); err != nil {
+			t.Fatal(err)
+		}
+		if size := lru.Stats().Size; size != 1 {
+			t.Fatalf("cached results = %d, want 1", size)
+		}
+		if _, err := s.Raw(write).Exec(); err != nil {
+			t.Fatal(err)
+		}
+		if size := lru.Stats().Size; size != 0 {
+			t.Fatalf("cached results after %q = %d, want 0", write, size)
+		}
+	}
+}
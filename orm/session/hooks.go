@@ -0,0 +1,102 @@
+package session
+
+import (
+	"github.com/pedrogao/log"
+)
+
+// Hooks are detected on model values and called around each operation,
+// the operation is aborted if a Before hook returns an error.
+// The session passed to hooks shares the transaction of the caller.
+
+type BeforeQuery interface {
+	BeforeQuery(s *Session) error
+}
+
+type AfterQuery interface {
+	AfterQuery(s *Session) error
+}
+
+type BeforeInsert interface {
+	BeforeInsert(s *Session) error
+}
+
+type AfterInsert interface {
+	AfterInsert(s *Session) error
+}
+
+type BeforeUpdate interface {
+	BeforeUpdate(s *Session) error
+}
+
+type AfterUpdate interface {
+	AfterUpdate(s *Session) error
+}
+
+type BeforeDelete interface {
+	BeforeDelete(s *Session) error
+}
+
+type AfterDelete interface {
+	AfterDelete(s *Session) error
+}
+
+type hookType int
+
+const (
+	beforeQuery hookType = iota
+	afterQuery
+	beforeInsert
+	afterInsert
+	beforeUpdate
+	afterUpdate
+	beforeDelete
+	afterDelete
+)
+
+// callHook calls hook of value if implemented
+func (s *Session) callHook(hook hookType, value any) (err error) {
+	if value == nil {
+		return nil
+	}
+
+	hs := s.clone()
+	switch hook {
+	case beforeQuery:
+		if h, ok := value.(BeforeQuery); ok {
+			err = h.BeforeQuery(hs)
+		}
+	case afterQuery:
+		if h, ok := value.(AfterQuery); ok {
+			err = h.AfterQuery(hs)
+		}
+	case beforeInsert:
+		if h, ok := value.(BeforeInsert); ok {
+			err = h.BeforeInsert(hs)
+		}
+	case afterInsert:
+		if h, ok := value.(AfterInsert); ok {
+			err = h.AfterInsert(hs)
+		}
+	case beforeUpdate:
+		if h, ok := value.(BeforeUpdate); ok {
+			err = h.BeforeUpdate(hs)
+		}
+	case afterUpdate:
+		if h, ok := value.(AfterUpdate); ok {
+			err = h.AfterUpdate(hs)
+		}
+	case beforeDelete:
+		if h, ok := value.(BeforeDelete); ok {
+			err = h.BeforeDelete(hs)
+		}
+	case afterDelete:
+		if h, ok := value.(AfterDelete); ok {
+			err = h.AfterDelete(hs)
+		}
+	}
+
+	if err != nil {
+		log.Errorf("call hook %T err: %s", value, err)
+	}
+	return
+}
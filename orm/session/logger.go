@@ -0,0 +1,117 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pedrogao/log"
+)
+
+// QueryInfo describes an executed statement
+type QueryInfo struct {
+	SQL          string
+	Args         []any
+	Start        time.Time
+	Duration     time.Duration
+	RowsAffected int64 // -1 if unknown, eg. queries
+	Err          error
+}
+
+// QueryLogger logs executed statements
+type QueryLogger interface {
+	LogQuery(ctx context.Context, info *QueryInfo)
+}
+
+// Interceptor observes statements around execution, eg. metrics and tracing,
+// the context returned by Before is used to execute the statement and passed to After
+type Interceptor interface {
+	Before(ctx context.Context, info *QueryInfo) context.Context
+	After(ctx context.Context, info *QueryInfo)
+}
+
+// InterceptorFuncs adapts functions to Interceptor, nil functions are skipped
+type InterceptorFuncs struct {
+	BeforeFunc func(ctx context.Context, info *QueryInfo) context.Context
+	AfterFunc  func(ctx context.Context, info *QueryInfo)
+}
+
+func (f InterceptorFuncs) Before(ctx context.Context, info *QueryInfo) context.Context {
+	if f.BeforeFunc == nil {
+		return ctx
+	}
+	return f.BeforeFunc(ctx, info)
+}
+
+func (f InterceptorFuncs) After(ctx context.Context, info *QueryInfo) {
+	if f.AfterFunc != nil {
+		f.AfterFunc(ctx, info)
+	}
+}
+
+// DefaultQueryLogger logs statements by github.com/pedrogao/log,
+// statements failed are logged at error level, slow statements at warn level
+type DefaultQueryLogger struct {
+	Level         log.Level     // level of normal statements, debug by default
+	SlowThreshold time.Duration // statements slower are logged at warn level, disabled if zero
+	ShowArgs      bool          // argument values are redacted unless ShowArgs
+}
+
+var _ QueryLogger = (*DefaultQueryLogger)(nil)
+
+func (l *DefaultQueryLogger) LogQuery(_ context.Context, info *QueryInfo) {
+	args := l.args(info.Args)
+	switch {
+	case info.Err != nil:
+		log.Errorf("sql: %s %s, err: %s", info.SQL, args, info.Err)
+	case l.SlowThreshold > 0 && info.Duration >= l.SlowThreshold:
+		log.Warnf("slow sql: %s %s, duration: %s, rows: %d", info.SQL, args, info.Duration, info.RowsAffected)
+	default:
+		format := "sql: %s %s, duration: %s, rows: %d"
+		switch l.Level {
+		case log.DebugLevel:
+			log.Debugf(format, info.SQL, args, info.Duration, info.RowsAffected)
+		case log.InfoLevel:
+			log.Infof(format, info.SQL, args, info.Duration, info.RowsAffected)
+		default:
+			log.Warnf(format, info.SQL, args, info.Duration, info.RowsAffected)
+		}
+	}
+}
+
+func (l *DefaultQueryLogger) args(args []any) string {
+	if l.ShowArgs {
+		return fmt.Sprintf("%+v", args)
+	}
+	return fmt.Sprintf("[%d redacted]", len(args))
+}
+
+// before starts to trace a statement by interceptors
+func (s *Session) before(ctx context.Context, query string) (context.Context, *QueryInfo) {
+	info := &QueryInfo{
+		SQL:          query,
+		Args:         s.sqlVars,
+		Start:        time.Now(),
+		RowsAffected: -1,
+	}
+	for _, interceptor := range s.interceptors {
+		ctx = interceptor.Before(ctx, info)
+	}
+	return ctx, info
+}
+
+// after finishes tracing a statement by interceptors in reverse order, then logs it,
+// cached results of the table written by a successful statement are invalidated
+func (s *Session) after(ctx context.Context, info *QueryInfo, err error) {
+	info.Duration = time.Since(info.Start)
+	info.Err = err
+	for i := len(s.interceptors) - 1; i >= 0; i-- {
+		s.interceptors[i].After(ctx, info)
+	}
+	if s.logger != nil {
+		s.logger.LogQuery(ctx, info)
+	}
+	if err == nil {
+		s.invalidate(info.SQL)
+	}
+}
@@ -0,0 +1,133 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/dialect"
+)
+
+// captureLog writes logs of all levels into the returned buffer until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	log.SetOptions(log.WithOutput(buf), log.WithLevel(log.DebugLevel))
+	t.Cleanup(func() { log.SetOptions(log.WithOutput(os.Stderr), log.WithLevel(log.ErrorLevel)) })
+	return buf
+}
+
+func TestDefaultQueryLogger(t *testing.T) {
+	buf := captureLog(t)
+	ctx := context.Background()
+	info := &QueryInfo{SQL: "SELECT * FROM User WHERE Name = ?", Args: []any{"secret"}, Duration: time.Millisecond}
+
+	(&DefaultQueryLogger{}).LogQuery(ctx, info)
+	if out := buf.String(); !strings.Contains(out, "DEBUG") || !strings.Contains(out, "[1 redacted]") ||
+		strings.Contains(out, "secret") {
+		t.Fatalf("log = %q, want args redacted at debug level", out)
+	}
+
+	buf.Reset()
+	(&DefaultQueryLogger{Level: log.InfoLevel, ShowArgs: true}).LogQuery(ctx, info)
+	if out := buf.String(); !strings.Contains(out, "INFO") || !strings.Contains(out, "secret") {
+		t.Fatalf("log = %q, want args shown at info level", out)
+	}
+
+	slow := &DefaultQueryLogger{SlowThreshold: 10 * time.Millisecond}
+	buf.Reset()
+	slow.LogQuery(ctx, info)
+	if out := buf.String(); strings.Contains(out, "slow sql") {
+		t.Fatalf("log = %q, statement under the threshold isn't slow", out)
+	}
+	buf.Reset()
+	slow.LogQuery(ctx, &QueryInfo{SQL: info.SQL, Args: info.Args, Duration: 20 * time.Millisecond})
+	if out := buf.String(); !strings.Contains(out, "WARN") || !strings.Contains(out, "slow sql") {
+		t.Fatalf("log = %q, want slow sql at warn level", out)
+	}
+
+	buf.Reset()
+	slow.LogQuery(ctx, &QueryInfo{SQL: info.SQL, Err: errors.New("no such table")})
+	if out := buf.String(); !strings.Contains(out, "ERROR") || !strings.Contains(out, "no such table") {
+		t.Fatalf("log = %q, want the error at error level", out)
+	}
+}
+
+type ctxKey struct{}
+
+// recordLogger records statements instead of logging them
+type recordLogger struct {
+	infos []QueryInfo
+}
+
+func (l *recordLogger) LogQuery(_ context.Context, info *QueryInfo) {
+	l.infos = append(l.infos, *info)
+}
+
+func TestInterceptors(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+
+	var order []string
+	var after []QueryInfo
+	traced := InterceptorFuncs{
+		BeforeFunc: func(ctx context.Context, info *QueryInfo) context.Context {
+			order = append(order, "before")
+			return context.WithValue(ctx, ctxKey{}, info.SQL)
+		},
+		AfterFunc: func(ctx context.Context, info *QueryInfo) {
+			order = append(order, "after")
+			if ctx.Value(ctxKey{}) != info.SQL {
+				t.Errorf("context of Before isn't passed to After of %s", info.SQL)
+			}
+			after = append(after, *info)
+		},
+	}
+	outer := InterceptorFuncs{
+		BeforeFunc: func(ctx context.Context, _ *QueryInfo) context.Context {
+			order = append(order, "outer before")
+			return ctx
+		},
+		AfterFunc: func(context.Context, *QueryInfo) { order = append(order, "outer after") },
+	}
+	logger := &recordLogger{}
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d, WithInterceptors(outer, traced), WithQueryLogger(logger))
+	if err = s.Model(&User{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	order, after = nil, nil
+	if _, err = s.Insert(&User{Name: "Tom"}, &User{Name: "Sam"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "outer before,before,after,outer after"; strings.Join(order, ",") != want {
+		t.Fatalf("interceptors run in %v, want %s", order, want)
+	}
+	if len(after) != 1 || !strings.HasPrefix(after[0].SQL, "INSERT INTO") || len(after[0].Args) != 4 ||
+		after[0].RowsAffected != 2 || after[0].Duration <= 0 || after[0].Err != nil {
+		t.Fatalf("after insert = %+v", after)
+	}
+
+	after = nil
+	if _, err = s.Raw("SELECT * FROM Missing").Exec(); err == nil {
+		t.Fatal("query of a missing table should fail")
+	}
+	if len(after) != 1 || after[0].Err == nil || after[0].RowsAffected != -1 {
+		t.Fatalf("after failed statement = %+v", after)
+	}
+
+	if n := len(logger.infos); n == 0 || logger.infos[n-1].Err == nil {
+		t.Fatalf("logged statements = %+v, want the failed statement last", logger.infos)
+	}
+}
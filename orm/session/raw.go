@@ -1,61 +1,318 @@
 package session
 
 import (
+	"context"
 	"database/sql"
 	"strings"
+	"time"
 
 	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/cache"
+	"github.com/pedrogao/orm/clause"
+	"github.com/pedrogao/orm/dialect"
+	"github.com/pedrogao/orm/schema"
 )
 
 type Session struct {
 	db      *sql.DB
-	sql     strings.Builder
-	sqlVars []any
+	tx      *sql.Tx
+	txDepth int // depth of nested transactions, mapped to savepoints
+	ctx     context.Context
+	timeout time.Duration // default timeout of each statement
+	stmts   *StmtCache
+	logger  QueryLogger
+	// interceptors observe statements in order
+	interceptors []Interceptor
+	resolver     ReadResolver
+	primary      bool // statements are forced to the primary
+	unscoped     bool // soft deleted records are included
+	strict       bool // unmapped columns fail scanning
+	global       bool // Update and Delete without predicates are allowed
+	cache        cache.Cache
+	cacheTTL     time.Duration // default ttl of cached queries, only marked queries are cached if zero
+	queryCache   int8          // 1 to cache the following query for queryTTL, -1 not to, 0 by default
+	queryTTL     time.Duration
+	txTables     map[string]struct{} // tables written in transaction, shared by nested sessions
+	dialect      dialect.Dialect
+	refTable     *schema.Schema
+	modelErr     error // error of parsing the model set by Model
+	err          error // error of building the statement, returned by it, eg. ErrSelfSubquery
+	clause       clause.Clause
+	where        clause.Conditions
+	having       clause.Conditions
+	selects      []string
+	groups       []string
+	orders       []string
+	preloads     []string
+	joins        []clause.Expr
+	ctes         []cte
+	sql          strings.Builder
+	sqlVars      []any
 }
 
-func New(db *sql.DB) *Session {
-	return &Session{db: db}
+// CommonDB is the minimal function set of db, implemented by *sql.DB and *sql.Tx
+type CommonDB interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+var _ CommonDB = (*sql.DB)(nil)
+var _ CommonDB = (*sql.Tx)(nil)
+
+// Option of session
+type Option func(*Session)
+
+// WithTimeout sets the default timeout of each statement, no timeout if zero
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Session) {
+		s.timeout = timeout
+	}
+}
+
+// WithStmtCache executes statements by prepared statements of cache
+func WithStmtCache(stmts *StmtCache) Option {
+	return func(s *Session) {
+		s.stmts = stmts
+	}
+}
+
+// WithQueryLogger logs statements by logger, nothing is logged if logger is nil
+func WithQueryLogger(logger QueryLogger) Option {
+	return func(s *Session) {
+		s.logger = logger
+	}
+}
+
+// WithInterceptors appends interceptors of statements
+func WithInterceptors(interceptors ...Interceptor) Option {
+	return func(s *Session) {
+		s.interceptors = append(s.interceptors, interceptors...)
+	}
+}
+
+func New(db *sql.DB, dialect dialect.Dialect, opts ...Option) *Session {
+	s := &Session{db: db, dialect: dialect}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// clone returns a session sharing db, transaction and options, without any pending sql
+func (s *Session) clone() *Session {
+	return &Session{
+		db:       s.db,
+		tx:       s.tx,
+		txDepth:  s.txDepth,
+		ctx:      s.ctx,
+		timeout:  s.timeout,
+		stmts:    s.stmts,
+		logger:   s.logger,
+		resolver: s.resolver,
+		primary:  s.primary,
+		cache:    s.cache,
+		cacheTTL: s.cacheTTL,
+		txTables: s.txTables,
+		dialect:  s.dialect,
+
+		interceptors: s.interceptors,
+	}
+}
+
+// WithContext sets the context of all following operations of session
+func (s *Session) WithContext(ctx context.Context) *Session {
+	s.ctx = ctx
+	return s
+}
+
+// Context returns the context of session, background if not set
+func (s *Session) Context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
 }
 
 func (s *Session) Clear() {
 	s.sql.Reset()
 	s.sqlVars = nil
+	s.clause.Reset()
+	s.where.Reset()
+	s.having.Reset()
+	s.selects = nil
+	s.groups = nil
+	s.orders = nil
+	s.preloads = nil
+	s.joins = nil
+	s.ctes = nil
+	s.unscoped = false
+	s.strict = false
+	s.global = false
+	s.queryCache = 0
+	s.queryTTL = 0
+	s.err = nil
 }
 
-func (s *Session) DB() *sql.DB {
+// DB returns the transaction if active, otherwise the db
+func (s *Session) DB() CommonDB {
+	if s.tx != nil {
+		return s.tx
+	}
 	return s.db
 }
 
+func (s *Session) Dialect() dialect.Dialect {
+	return s.dialect
+}
+
+// SQL returns the accumulated sql with placeholders rebound for the dialect
+func (s *Session) SQL() string {
+	return s.dialect.Rebind(s.sql.String())
+}
+
+// Raw appends sql and values, values of clause.Builder, eg. Expr and another *Session, are expanded in place
 func (s *Session) Raw(sql string, values ...any) *Session {
+	if !s.checkSubquery(values) {
+		return s
+	}
+	sql, values = clause.Expand(sql, values)
 	s.sql.WriteString(sql)
 	s.sql.WriteString(" ")
 	s.sqlVars = append(s.sqlVars, values...)
 	return s
 }
 
-func (s *Session) Exec() (result sql.Result, err error) {
+func (s *Session) Exec() (sql.Result, error) {
+	return s.ExecContext(s.Context())
+}
+
+func (s *Session) ExecContext(ctx context.Context) (result sql.Result, err error) {
 	defer s.Clear()
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
 
-	log.Infof("exec: %s %+v", s.sql.String(), s.sqlVars)
-	if result, err = s.DB().Exec(s.sql.String(), s.sqlVars...); err != nil {
-		log.Errorf("exec err: %s", err)
+	query := s.SQL()
+	ctx, info := s.before(ctx, query)
+	if stmt, release := s.prepared(ctx, query); stmt != nil {
+		result, err = stmt.ExecContext(ctx, s.sqlVars...)
+		release()
+		s.stmts.check(query, err)
+	} else {
+		result, err = s.DB().ExecContext(ctx, query, s.sqlVars...)
 	}
+	if err == nil {
+		info.RowsAffected, _ = result.RowsAffected()
+	}
+	s.after(ctx, info, err)
 	return
 }
 
 func (s *Session) QueryRow() *sql.Row {
+	return s.QueryRowContext(s.Context())
+}
+
+// QueryRowContext queries a row, the statement timeout applies until the row is scanned.
+// The statement isn't executed if building it failed, eg. by ErrSelfSubquery, the row fails then.
+func (s *Session) QueryRowContext(ctx context.Context) *sql.Row {
 	defer s.Clear()
 
-	log.Infof("query row: %s %+v", s.sql.String(), s.sqlVars)
-	return s.DB().QueryRow(s.sql.String(), s.sqlVars...)
+	if s.err != nil {
+		// a row can't carry the error, the row fails by a canceled context instead of executing
+		log.Errorf("query row err: %s", s.err)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(ctx)
+		cancel()
+	}
+	if s.timeout > 0 {
+		// the row is scanned after return, so ctx is released by the timeout only
+		ctx = newRowsContext(ctx, s.timeout)
+	}
+	query := s.SQL()
+	ctx, info := s.before(ctx, query)
+	var row *sql.Row
+	if db, done := s.reader(query); db != nil {
+		row = db.QueryRowContext(ctx, query, s.sqlVars...)
+		done(time.Since(info.Start))
+	} else if stmt, release := s.prepared(ctx, query); stmt != nil {
+		// the row keeps stmt open until it's scanned, even if stmt is evicted meanwhile
+		row = stmt.QueryRowContext(ctx, s.sqlVars...)
+		release()
+		s.stmts.check(query, row.Err())
+	} else {
+		row = s.DB().QueryRowContext(ctx, query, s.sqlVars...)
+	}
+	s.after(ctx, info, row.Err())
+	return row
 }
 
-func (s *Session) QueryRows() (rows *sql.Rows, err error) {
+func (s *Session) QueryRows() (*Rows, error) {
+	return s.QueryRowsContext(s.Context())
+}
+
+// QueryRowsContext queries rows, the statement timeout applies until the first row arrives,
+// and rows must be closed to release the context
+func (s *Session) QueryRowsContext(ctx context.Context) (*Rows, error) {
 	defer s.Clear()
+	if s.err != nil {
+		return nil, s.err
+	}
 
-	log.Infof("query rows: %s %+v", s.sql.String(), s.sqlVars)
-	if rows, err = s.DB().Query(s.sql.String(), s.sqlVars...); err != nil {
-		log.Errorf("query rows err: %s", err)
+	rc := newRowsContext(ctx, s.timeout)
+	rows, err := s.queryRows(rc)
+	if err != nil {
+		rc.arrived()
+		rc.cancel()
+		return nil, err
 	}
+	return &Rows{Rows: rows, ctx: rc}, nil
+}
+
+func (s *Session) queryRows(ctx context.Context) (rows *sql.Rows, err error) {
+	query := s.SQL()
+	ctx, info := s.before(ctx, query)
+	if db, done := s.reader(query); db != nil {
+		// statements on replicas aren't cached, the cache prepares on the primary
+		rows, err = db.QueryContext(ctx, query, s.sqlVars...)
+		done(time.Since(info.Start))
+		s.after(ctx, info, err)
+		return
+	}
+	if stmt, release := s.prepared(ctx, query); stmt != nil {
+		// rows keep stmt open until they're closed, even if stmt is evicted meanwhile
+		rows, err = stmt.QueryContext(ctx, s.sqlVars...)
+		release()
+		s.stmts.check(query, err)
+	} else {
+		rows, err = s.DB().QueryContext(ctx, query, s.sqlVars...)
+	}
+	s.after(ctx, info, err)
 	return
 }
+
+// prepared returns the cached statement of query, nil if the cache is disabled,
+// query isn't cacheable or fails to prepare. Statements of a transaction aren't cached,
+// as they're prepared on the db, which waits for a free connection besides the one
+// of the transaction. release must be called once stmt is used.
+func (s *Session) prepared(ctx context.Context, query string) (stmt *sql.Stmt, release func()) {
+	if s.stmts == nil || s.tx != nil || !cacheable(query) {
+		return nil, nil
+	}
+
+	stmt, release, err := s.stmts.Get(ctx, query)
+	if err != nil {
+		return nil, nil
+	}
+	return stmt, release
+}
+
+func (s *Session) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.timeout)
+}
@@ -0,0 +1,518 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/clause"
+	"github.com/pedrogao/orm/schema"
+)
+
+var ErrRecordNotFound = errors.New("record not found")
+
+// ErrMissingWhereClause is returned by Update and Delete without predicates unless AllowGlobal
+var ErrMissingWhereClause = errors.New("update or delete without predicates")
+
+// AllowGlobal allows the following Update or Delete to affect all records
+func (s *Session) AllowGlobal() *Session {
+	s.global = true
+	return s
+}
+
+// Insert inserts values of the same model in one statement, eg. Insert(&u1, &u2),
+// the auto increment primary key is written back if only one value is inserted.
+// Values are inserted one by one in a transaction if any association cascades on save.
+func (s *Session) Insert(values ...any) (int64, error) {
+	defer s.Clear()
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	table, err := s.Model(values[0]).Table()
+	if err != nil {
+		return 0, err
+	}
+	if cascadeSave(table) {
+		return s.insertWithAssociations(table, values)
+	}
+	return s.insert(table, values)
+}
+
+func (s *Session) insert(table *schema.Schema, values []any) (int64, error) {
+	sql, vars, fields, err := s.buildInsert(table, values)
+	if err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	pk := table.PrimaryKey
+	if len(values) == 1 && pk != nil && pk.AutoIncrement && len(fields) < len(table.Fields) {
+		affected, err = s.insertReturning(sql, vars, pk, values[0])
+	} else {
+		affected, err = s.exec(sql, vars)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return affected, s.afterInsert(values)
+}
+
+// buildInsert calls BeforeInsert hooks of values and builds the INSERT statement
+func (s *Session) buildInsert(table *schema.Schema, values []any) (string, []any, []*schema.Field, error) {
+	modelType := reflect.Indirect(reflect.ValueOf(table.Model)).Type()
+	for _, value := range values {
+		if reflect.Indirect(reflect.ValueOf(value)).Type() != modelType {
+			return "", nil, nil, fmt.Errorf("insert %T into %s: mixed models", value, table.Name)
+		}
+	}
+
+	now := time.Now()
+	for _, value := range values {
+		if err := s.callHook(beforeInsert, value); err != nil {
+			return "", nil, nil, err
+		}
+		touch(table, value, now)
+	}
+
+	fields := insertFields(table, values)
+	recordValues := make([]any, 0, len(values))
+	for _, value := range values {
+		recordValues = append(recordValues, fieldValues(value, fields))
+	}
+
+	s.clause.Set(clause.INSERT, s.quote(table.Name), s.quoteAll(fieldNames(fields)))
+	s.clause.Set(clause.VALUES, recordValues...)
+	sql, vars := s.clause.Build(clause.INSERT, clause.VALUES)
+	return sql, vars, fields, nil
+}
+
+func (s *Session) afterInsert(values []any) error {
+	for _, value := range values {
+		if err := s.callHook(afterInsert, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertReturning inserts a value and writes the generated primary key back
+func (s *Session) insertReturning(sql string, vars []any, pk *schema.Field, value any) (int64, error) {
+	dest := reflect.Indirect(reflect.ValueOf(value))
+	if !dest.CanAddr() {
+		return s.exec(sql, vars)
+	}
+
+	field := dest.FieldByIndex(pk.Index)
+	if returning := s.dialect.ReturningSQL([]string{pk.Name}); returning != "" {
+		if err := s.Raw(sql+" "+returning, vars...).QueryRow().Scan(field.Addr().Interface()); err != nil {
+			log.Errorf("insert returning err: %s", err)
+			return 0, err
+		}
+		return 1, nil
+	}
+
+	result, err := s.Raw(sql, vars...).Exec()
+	if err != nil {
+		return 0, err
+	}
+	if id, err := result.LastInsertId(); err == nil {
+		setInt(field, id)
+	}
+	return result.RowsAffected()
+}
+
+// Find queries records into a pointer of slice, eg. Find(&users), the slice is
+// replaced by the records found, associations set by Preload are loaded after records
+func (s *Session) Find(values any) error {
+	defer s.Clear()
+	destSlice := reflect.Indirect(reflect.ValueOf(values))
+	if destSlice.Kind() != reflect.Slice || !destSlice.CanSet() {
+		return fmt.Errorf("find into %T: must be a pointer of slice", values)
+	}
+
+	destType := destSlice.Type().Elem()
+	elemType := destType
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	table, err := s.Model(reflect.New(elemType).Interface()).Table()
+	if err != nil {
+		return err
+	}
+	if err = s.callHook(beforeQuery, table.Model); err != nil {
+		return err
+	}
+
+	preloads, strict := s.preloads, s.strict
+	sql, vars := s.buildSelect(table)
+	// results with associations aren't cached, as writes to associations can't invalidate them
+	ttl, cached := s.cached(sql)
+	cached = cached && len(preloads) == 0
+	key := cacheKey(destSlice.Type(), sql, vars)
+	if cached {
+		if found, ok := s.cache.Get(key); ok {
+			destSlice.Set(cloneSlice(reflect.ValueOf(found)))
+			return nil
+		}
+	}
+
+	rows, err := s.Raw(sql, vars...).QueryRows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	found := reflect.MakeSlice(destSlice.Type(), 0, 0)
+	reported := false
+	for rows.Next() {
+		dest := reflect.New(elemType).Elem()
+		addrs, unmapped := scanDest(table, dest, columns)
+		if len(unmapped) > 0 && !reported {
+			if strict {
+				return &UnmappedColumnsError{Type: elemType, Columns: unmapped}
+			}
+			log.Warnf("columns %s not mapped to %s", strings.Join(unmapped, ", "), elemType)
+			reported = true
+		}
+		if err = rows.Scan(addrs...); err != nil {
+			log.Errorf("scan row err: %s", err)
+			return err
+		}
+		if err = s.callHook(afterQuery, dest.Addr().Interface()); err != nil {
+			return err
+		}
+		if destType.Kind() == reflect.Ptr {
+			dest = dest.Addr()
+		}
+		found = reflect.Append(found, dest)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	// close rows before loading associations, a transaction owns only one connection
+	_ = rows.Close()
+
+	if cached {
+		s.cache.Set(key, cloneSlice(found).Interface(), ttl, tableTag(table.Name))
+	}
+	destSlice.Set(found)
+
+	if len(preloads) > 0 {
+		return s.preload(table, structValues(destSlice), preloads)
+	}
+	return nil
+}
+
+// First queries the first record into a pointer of struct
+func (s *Session) First(value any) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		s.Clear()
+		return fmt.Errorf("first into %T: must be a non-nil pointer", value)
+	}
+	dest := v.Elem()
+	destSlice := reflect.New(reflect.SliceOf(dest.Type()))
+	if err := s.Limit(1).Find(destSlice.Interface()); err != nil {
+		return err
+	}
+	if destSlice.Elem().Len() == 0 {
+		return ErrRecordNotFound
+	}
+	dest.Set(destSlice.Elem().Index(0))
+	return nil
+}
+
+// Update updates records by a map of columns, or by the non-zero fields of a struct,
+// a struct with non-zero primary key updates itself if no predicate is given.
+// UpdatedAt is set to now unless given by map, and a non-zero Version is checked and
+// bumped, ErrStaleObject is returned if no record matches the version.
+// ErrMissingWhereClause is returned without predicates unless AllowGlobal.
+func (s *Session) Update(value any) (int64, error) {
+	defer s.Clear()
+	var (
+		columns []string
+		vars    []any
+		model   = value
+		now     = time.Now()
+		version *reflect.Value // version field of struct, bumped after update
+		updated *reflect.Value // updated time field of struct, set after update
+		checked bool           // whether version is checked
+	)
+	switch kv := value.(type) {
+	case map[string]any:
+		table, err := s.Table()
+		if err != nil {
+			return 0, err
+		}
+		// hooks are called on the model set by Model for map
+		model = table.Model
+		if err = s.callHook(beforeUpdate, model); err != nil {
+			return 0, err
+		}
+
+		for column := range kv {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for i, column := range columns {
+			v := kv[column]
+			if f := table.Version; f != nil && table.FieldByName(column) == f {
+				// zero version isn't checked, like struct
+				if current, ok := toInt64(v); ok && current != 0 {
+					s.Where(s.quote(f.Name)+" = ?", current)
+					v, checked = current+1, true
+				}
+				columns[i] = f.Name
+			}
+			vars = append(vars, v)
+		}
+		if f := table.UpdatedAt; f != nil && kv[f.Name] == nil && kv[f.FieldName] == nil {
+			columns = append(columns, f.Name)
+			vars = append(vars, schema.TimeValue(f.GoType, now))
+		}
+	default:
+		table, err := s.Model(value).Table()
+		if err != nil {
+			return 0, err
+		}
+		if err = s.callHook(beforeUpdate, value); err != nil {
+			return 0, err
+		}
+		dest := reflect.Indirect(reflect.ValueOf(value))
+		for _, field := range table.Fields {
+			v := dest.FieldByIndex(field.Index)
+			if field.PrimaryKey || field == table.UpdatedAt || field == table.Version || v.IsZero() {
+				continue
+			}
+			columns = append(columns, field.Name)
+			vars = append(vars, v.Interface())
+		}
+		if pk := table.PrimaryKey; pk != nil && s.where.Empty() {
+			if id := dest.FieldByIndex(pk.Index); !id.IsZero() {
+				s.Where(s.quote(pk.Name)+" = ?", id.Interface())
+			}
+		}
+		if f := table.Version; f != nil && len(columns) > 0 {
+			if v := dest.FieldByIndex(f.Index); !v.IsZero() {
+				current, _ := toInt64(v.Interface())
+				s.Where(s.quote(f.Name)+" = ?", current)
+				columns = append(columns, f.Name)
+				vars = append(vars, current+1)
+				version, checked = &v, true
+			}
+		}
+		if f := table.UpdatedAt; f != nil && len(columns) > 0 {
+			v := dest.FieldByIndex(f.Index)
+			updated = &v
+			columns = append(columns, f.Name)
+			vars = append(vars, schema.TimeValue(f.GoType, now))
+		}
+	}
+
+	if len(columns) == 0 {
+		return 0, nil
+	}
+	if s.where.Empty() && !s.global {
+		return 0, ErrMissingWhereClause
+	}
+
+	table := s.RefTable()
+	s.scope(table)
+	s.clause.Set(clause.UPDATE, s.quote(table.Name), s.quoteAll(columns), vars)
+	s.buildConditions()
+	sql, vars := s.clause.Build(clause.UPDATE, clause.WHERE)
+	affected, err := s.exec(sql, vars)
+	if err != nil {
+		return 0, err
+	}
+	if checked && affected == 0 {
+		return 0, ErrStaleObject
+	}
+	if version != nil && version.CanSet() {
+		current, _ := toInt64(version.Interface())
+		setInt(*version, current+1)
+	}
+	if updated != nil && updated.CanSet() {
+		schema.SetTime(*updated, now)
+	}
+	if err = s.callHook(afterUpdate, model); err != nil {
+		return affected, err
+	}
+	return affected, nil
+}
+
+// Delete deletes records of model matched by predicates, records are soft deleted
+// by setting DeletedAt if model has it unless Unscoped, associations
+// cascading on delete are deleted in a transaction before records.
+// ErrMissingWhereClause is returned without predicates unless AllowGlobal.
+func (s *Session) Delete() (int64, error) {
+	defer s.Clear()
+	table, err := s.Table()
+	if err != nil {
+		return 0, err
+	}
+	if s.where.Empty() && !s.global {
+		return 0, ErrMissingWhereClause
+	}
+
+	if cascadeDelete(table) {
+		return s.deleteWithAssociations(table)
+	}
+	return s.delete(table)
+}
+
+func (s *Session) delete(table *schema.Schema) (int64, error) {
+	if err := s.callHook(beforeDelete, table.Model); err != nil {
+		return 0, err
+	}
+
+	var (
+		sql  string
+		vars []any
+	)
+	if s.softDelete(table) {
+		s.scope(table)
+		deletedAt := table.DeletedAt
+		s.clause.Set(clause.UPDATE, s.quote(table.Name), s.quoteAll([]string{deletedAt.Name}),
+			[]any{schema.TimeValue(deletedAt.GoType, time.Now())})
+		s.buildConditions()
+		sql, vars = s.clause.Build(clause.UPDATE, clause.WHERE)
+	} else {
+		s.clause.Set(clause.DELETE, s.quote(table.Name))
+		s.buildConditions()
+		sql, vars = s.clause.Build(clause.DELETE, clause.WHERE)
+	}
+	affected, err := s.exec(sql, vars)
+	if err != nil {
+		return 0, err
+	}
+	if err = s.callHook(afterDelete, table.Model); err != nil {
+		return affected, err
+	}
+	return affected, nil
+}
+
+// Count counts records of model matched by predicates
+func (s *Session) Count() (int64, error) {
+	defer s.Clear()
+	table, err := s.Table()
+	if err != nil {
+		return 0, err
+	}
+
+	s.scope(table)
+	s.clause.Set(clause.COUNT, s.quote(table.Name))
+	s.buildSources()
+	s.buildConditions()
+	sql, vars := clause.Expand(s.clause.Build(clause.WITH, clause.COUNT, clause.JOIN, clause.WHERE))
+	if s.err != nil {
+		return 0, s.err
+	}
+	var count int64
+	ttl, cached := s.cached(sql)
+	key := cacheKey(reflect.TypeOf(count), sql, vars)
+	if cached {
+		if v, ok := s.cache.Get(key); ok {
+			return v.(int64), nil
+		}
+	}
+	if err := s.Raw(sql, vars...).QueryRow().Scan(&count); err != nil {
+		log.Errorf("count err: %s", err)
+		return 0, err
+	}
+	if cached {
+		s.cache.Set(key, count, ttl, tableTag(table.Name))
+	}
+	return count, nil
+}
+
+// exec executes sql and returns the number of affected rows
+func (s *Session) exec(sql string, vars []any) (int64, error) {
+	result, err := s.Raw(sql, vars...).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (s *Session) buildSelect(table *schema.Schema) (string, []any) {
+	columns := s.selects
+	if len(columns) == 0 {
+		columns = table.FieldNames
+		if len(s.joins) > 0 {
+			columns = qualify(table.Name, columns)
+		}
+	}
+	s.scope(table)
+	s.clause.Set(clause.SELECT, s.quote(table.Name), s.quoteAll(columns))
+	s.buildSources()
+	s.buildConditions()
+	return clause.Expand(s.clause.Build(clause.WITH, clause.SELECT, clause.JOIN, clause.WHERE,
+		clause.GROUPBY, clause.HAVING, clause.ORDERBY, clause.LIMIT, clause.OFFSET))
+}
+
+// qualify prefixes columns with table name
+func qualify(table string, columns []string) []string {
+	qualified := make([]string, 0, len(columns))
+	for _, column := range columns {
+		qualified = append(qualified, table+"."+column)
+	}
+	return qualified
+}
+
+// insertFields returns fields to insert, the auto increment primary key
+// is skipped if it's zero in all values, so that database generates it
+func insertFields(table *schema.Schema, values []any) []*schema.Field {
+	pk := table.PrimaryKey
+	if pk == nil || !pk.AutoIncrement {
+		return table.Fields
+	}
+	for _, value := range values {
+		if !reflect.Indirect(reflect.ValueOf(value)).FieldByIndex(pk.Index).IsZero() {
+			return table.Fields
+		}
+	}
+
+	fields := make([]*schema.Field, 0, len(table.Fields)-1)
+	for _, field := range table.Fields {
+		if field != pk {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+func fieldNames(fields []*schema.Field) []string {
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	return names
+}
+
+func fieldValues(value any, fields []*schema.Field) []any {
+	dest := reflect.Indirect(reflect.ValueOf(value))
+	values := make([]any, 0, len(fields))
+	for _, field := range fields {
+		values = append(values, dest.FieldByIndex(field.Index).Interface())
+	}
+	return values
+}
+
+func setInt(field reflect.Value, id int64) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		field.SetUint(uint64(id))
+	}
+}
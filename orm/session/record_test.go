@@ -0,0 +1,172 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/dialect"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOptions(log.WithLevel(log.ErrorLevel)) // statements aren't logged
+	os.Exit(m.Run())
+}
+
+type User struct {
+	ID   int
+	Name string
+	Age  int
+}
+
+func newTestSession(t testing.TB) *Session {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1) // every connection of :memory: is a new database
+	t.Cleanup(func() { _ = db.Close() })
+	d, _ := dialect.GetDialect("sqlite3")
+	s := New(db, d)
+	if err = s.Model(&User{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestUpdateDeleteWithoutPredicates(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}, &User{Name: "Sam", Age: 20}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Update(&User{Age: 30}); !errors.Is(err, ErrMissingWhereClause) {
+		t.Fatalf("update without predicates err = %v, want ErrMissingWhereClause", err)
+	}
+	if _, err := s.Model(&User{}).Delete(); !errors.Is(err, ErrMissingWhereClause) {
+		t.Fatalf("delete without predicates err = %v, want ErrMissingWhereClause", err)
+	}
+	if n, _ := s.Model(&User{}).Count(); n != 2 {
+		t.Fatalf("count = %d, want 2", n)
+	}
+
+	if n, err := s.Update(&User{ID: 1, Age: 30}); err != nil || n != 1 {
+		t.Fatalf("update by primary key = %d, %v, want 1", n, err)
+	}
+	if n, err := s.AllowGlobal().Update(&User{Age: 40}); err != nil || n != 2 {
+		t.Fatalf("global update = %d, %v, want 2", n, err)
+	}
+	if n, err := s.Model(&User{}).AllowGlobal().Delete(); err != nil || n != 2 {
+		t.Fatalf("global delete = %d, %v, want 2", n, err)
+	}
+}
+
+func TestInsertMixedModels(t *testing.T) {
+	s := newTestSession(t)
+	type Other struct{ X int }
+	if _, err := s.Insert(&User{Name: "Tom"}, &Other{X: 1}); err == nil {
+		t.Fatal("insert of mixed models should fail")
+	}
+	// the session is cleared after failure
+	if n, err := s.Model(&User{}).Count(); err != nil || n != 0 {
+		t.Fatalf("count = %d, %v, want 0", n, err)
+	}
+}
+
+func TestFindNonSlice(t *testing.T) {
+	s := newTestSession(t)
+	var u User
+	if err := s.Where("Name = ?", "Tom").Find(&u); err == nil {
+		t.Fatal("find into non-slice should fail")
+	}
+	var users []User
+	if err := s.Model(&User{}).Find(&users); err != nil {
+		t.Fatalf("find after failure: %v", err)
+	}
+}
+
+func TestFindReplacesSlice(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}, &User{Name: "Sam", Age: 20}); err != nil {
+		t.Fatal(err)
+	}
+	users := []User{{Name: "Stale"}}
+	if err := s.OrderBy("ID").Find(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Name != "Tom" || users[1].Name != "Sam" {
+		t.Fatalf("find = %v, want Tom and Sam only", users)
+	}
+	if err := s.Where("Name = ?", "Nobody").Find(&users); err != nil || len(users) != 0 {
+		t.Fatalf("find nothing = %v, %v, want empty", users, err)
+	}
+}
+
+func TestFirstNonPointer(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom"}); err != nil {
+		t.Fatal(err)
+	}
+	var nilUser *User
+	for _, dest := range []any{User{}, nilUser, nil} {
+		if err := s.Where("Name = ?", "Tom").First(dest); err == nil {
+			t.Fatalf("first into %T should fail", dest)
+		}
+	}
+	var u User
+	if err := s.First(&u); err != nil || u.Name != "Tom" {
+		t.Fatalf("first after failure = %v, %v", u, err)
+	}
+}
+
+func TestFindUnmappedColumns(t *testing.T) {
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}); err != nil {
+		t.Fatal(err)
+	}
+	var users []User
+	err := s.Select("Name", "Age * 2 AS Double").Strict().Find(&users)
+	var unmapped *UnmappedColumnsError
+	if !errors.As(err, &unmapped) || len(unmapped.Columns) != 1 || unmapped.Columns[0] != "Double" {
+		t.Fatalf("strict find = %v, want unmapped Double", err)
+	}
+	// unmapped columns are discarded unless strict
+	if err = s.Select("Name", "Age * 2 AS Double").Find(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].Name != "Tom" {
+		t.Fatalf("find = %v", users)
+	}
+}
+
+type Locked struct {
+	ID   int
+	Name string
+}
+
+func (l *Locked) BeforeUpdate(s *Session) error {
+	return errors.New("locked")
+}
+
+func TestClearOnHookError(t *testing.T) {
+	s := newTestSession(t)
+	if err := s.Model(&Locked{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Insert(&Locked{Name: "Tom"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Where("Name = ?", "Sam").Update(&Locked{Name: "Jack"}); err == nil {
+		t.Fatal("update should fail by hook")
+	}
+	// predicates of the failed update don't leak into the next statement
+	var list []Locked
+	if err := s.Find(&list); err != nil || len(list) != 1 {
+		t.Fatalf("find = %v, %v, want 1 record", list, err)
+	}
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// ReadResolver routes read statements, eg. to replicas of the primary
+type ReadResolver interface {
+	// Read returns the database to query and a callback reporting the duration of the query
+	Read() (db *sql.DB, done func(time.Duration))
+}
+
+// WithReadResolver routes statements reading outside transactions by resolver
+func WithReadResolver(resolver ReadResolver) Option {
+	return func(s *Session) {
+		s.resolver = resolver
+	}
+}
+
+// Primary forces all following statements of session to the primary,
+// eg. to read data just written without replication lag
+func (s *Session) Primary() *Session {
+	s.primary = true
+	return s
+}
+
+// reader returns the database to execute query and a callback reporting its duration,
+// nil if query should be executed on the primary or the active transaction
+func (s *Session) reader(query string) (*sql.DB, func(time.Duration)) {
+	if s.resolver == nil || s.primary || s.tx != nil || !isRead(query) {
+		return nil, nil
+	}
+	return s.resolver.Read()
+}
+
+// isRead reports whether query only reads, that's a SELECT, or a WITH whose statement
+// is SELECT and which has no INSERT, UPDATE, DELETE or MERGE in any expression.
+// Locking reads stay on the primary.
+func isRead(query string) bool {
+	q := strings.ToUpper(strings.TrimSpace(query))
+	if strings.Contains(q, " FOR UPDATE") || strings.Contains(q, " FOR SHARE") {
+		return false
+	}
+	if strings.HasPrefix(q, "SELECT") {
+		return true
+	}
+	if !strings.HasPrefix(q, "WITH") {
+		return false
+	}
+
+	// the first keyword out of parentheses starts the statement, eg. REPLACE INTO t SELECT,
+	// words in parentheses are of expressions
+	depth, start, statement := 0, -1, ""
+	for i := 0; i <= len(q); i++ {
+		if i < len(q) && isWordByte(q[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			switch word := q[start:i]; word {
+			case "INSERT", "UPDATE", "DELETE", "MERGE":
+				return false
+			case "SELECT", "REPLACE", "VALUES":
+				if depth == 0 && statement == "" {
+					statement = word
+				}
+			}
+			start = -1
+		}
+		if i < len(q) {
+			switch q[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+		}
+	}
+	return statement == "SELECT"
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,29 @@
+package session
+
+import "testing"
+
+func TestIsRead(t *testing.T) {
+	tests := map[string]bool{
+		"SELECT * FROM User":                              true,
+		"  select * from User":                            true,
+		"SELECT * FROM User FOR UPDATE":                   false,
+		"SELECT * FROM User FOR SHARE":                    false,
+		"INSERT INTO User (Name) VALUES (?)":              false,
+		"UPDATE User SET Name = ?":                        false,
+		"DELETE FROM User":                                false,
+		"WITH t AS (SELECT ID FROM User) SELECT * FROM t": true,
+		"WITH RECURSIVE t(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM t WHERE n < 3) SELECT n FROM t": true,
+		"with t as (select ID from User) select replace(Name, 'a', 'b') from User":                    true,
+		"WITH t AS (SELECT ID FROM User) DELETE FROM User WHERE ID IN (SELECT ID FROM t)":             false,
+		"WITH t AS (SELECT ID FROM User) UPDATE User SET Age = 1 WHERE ID IN (SELECT ID FROM t)":      false,
+		"WITH t AS (SELECT ID FROM User) INSERT INTO Archive SELECT * FROM t":                         false,
+		"WITH t AS (SELECT ID FROM User) REPLACE INTO Archive SELECT * FROM t":                        false,
+		"WITH d AS (DELETE FROM User RETURNING *) SELECT * FROM d":                                    false,
+		"WITH t AS (SELECT ID FROM User) SELECT * FROM t FOR UPDATE":                                  false,
+	}
+	for query, want := range tests {
+		if got := isRead(query); got != want {
+			t.Errorf("isRead(%q) = %v, want %v", query, got, want)
+		}
+	}
+}
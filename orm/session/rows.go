@@ -0,0 +1,65 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"sync/atomic"
+	"time"
+)
+
+// Rows are sql.Rows whose context is released once rows are closed or exhausted
+type Rows struct {
+	*sql.Rows
+	ctx *rowsContext
+}
+
+// Next prepares the next row, the statement timeout stops once the first row arrives
+func (r *Rows) Next() bool {
+	next := r.Rows.Next()
+	r.ctx.arrived()
+	if !next {
+		r.ctx.cancel() // rows are closed by sql.Rows
+	}
+	return next
+}
+
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	r.ctx.cancel()
+	return err
+}
+
+// rowsContext is canceled by its owner, or expired by the statement timeout unless
+// the first row arrives in time, expiration is reported as context.DeadlineExceeded
+type rowsContext struct {
+	context.Context
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired int32
+}
+
+func newRowsContext(ctx context.Context, timeout time.Duration) *rowsContext {
+	c := &rowsContext{}
+	c.Context, c.cancel = context.WithCancel(ctx)
+	if timeout > 0 {
+		c.timer = time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&c.expired, 1)
+			c.cancel()
+		})
+	}
+	return c
+}
+
+func (c *rowsContext) Err() error {
+	if err := c.Context.Err(); err != nil && atomic.LoadInt32(&c.expired) == 1 {
+		return context.DeadlineExceeded
+	}
+	return c.Context.Err()
+}
+
+// arrived stops the statement timeout
+func (c *rowsContext) arrived() {
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+}
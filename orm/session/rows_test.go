@@ -0,0 +1,73 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/orm/dialect"
+)
+
+func newTimeoutSession(t *testing.T, timeout time.Duration) *Session {
+	t.Helper()
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	d, _ := dialect.GetDialect("sqlite3")
+	return New(db, d, WithTimeout(timeout))
+}
+
+const countSQL = "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < ?) SELECT x FROM c"
+
+func TestRowsTimeoutUntilFirstRow(t *testing.T) {
+	s := newTimeoutSession(t, 50*time.Millisecond)
+	rows, err := s.Raw(countSQL, 3).QueryRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		n++
+		time.Sleep(60 * time.Millisecond) // slow consumers outlive the statement timeout
+	}
+	if err = rows.Err(); err != nil || n != 3 {
+		t.Fatalf("rows = %d, %v, want 3", n, err)
+	}
+}
+
+func TestRowsTimeoutExpired(t *testing.T) {
+	s := newTimeoutSession(t, 20*time.Millisecond)
+	rows, err := s.Raw("SELECT max(x) FROM ("+countSQL+")", 1<<40).QueryRows()
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		_ = rows.Close()
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+	if s.Raw("SELECT 1").QueryRow().Scan(new(int)) != nil {
+		t.Fatal("session isn't usable after expiration")
+	}
+}
+
+func TestRowsCloseCancels(t *testing.T) {
+	s := newTimeoutSession(t, 0)
+	rows, err := s.Raw(countSQL, 10).QueryRows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(rows.ctx.Err(), context.Canceled) {
+		t.Fatalf("ctx err after close = %v, want context.Canceled", rows.ctx.Err())
+	}
+}
@@ -0,0 +1,349 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/schema"
+)
+
+// UnmappedColumnsError reports columns of result which aren't mapped to any field
+type UnmappedColumnsError struct {
+	Type    reflect.Type
+	Columns []string
+}
+
+func (e *UnmappedColumnsError) Error() string {
+	return fmt.Sprintf("columns %s not mapped to %s", strings.Join(e.Columns, ", "), e.Type)
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+)
+
+// Strict makes the following scan fail with *UnmappedColumnsError
+// if any column isn't mapped, unmapped columns are only logged by default
+func (s *Session) Strict() *Session {
+	s.strict = true
+	return s
+}
+
+// ScanOne queries and scans the first row into dest, a pointer of struct or a pointer
+// of scalar for one column, ErrRecordNotFound is returned if no row
+func (s *Session) ScanOne(dest any) error {
+	defer s.Clear()
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("scan into %T: must be a non-nil pointer", dest)
+	}
+
+	found := false
+	err := s.each(v.Elem().Type(), func(row reflect.Value) error {
+		v.Elem().Set(row)
+		found = true
+		return errStop
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// ScanAll queries and scans all rows into dest, a pointer of slice whose element
+// is struct, pointer of struct or scalar for one column, the slice is replaced by the rows
+func (s *Session) ScanAll(dest any) error {
+	defer s.Clear()
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("scan into %T: must be a pointer of slice", dest)
+	}
+
+	slice := v.Elem()
+	slice.Set(reflect.MakeSlice(slice.Type(), 0, 0))
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr && !isScalar(elemType)
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	return s.each(elemType, func(row reflect.Value) error {
+		if isPtr {
+			row = row.Addr()
+		}
+		slice.Set(reflect.Append(slice, row))
+		return nil
+	})
+}
+
+// ScanMap queries and returns rows as maps keyed by column
+func (s *Session) ScanMap() ([]map[string]any, error) {
+	defer s.Clear()
+	s.query()
+	rows, err := s.QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var result []map[string]any
+	for rows.Next() {
+		values := make([]any, len(columns))
+		addrs := make([]any, len(columns))
+		for i := range values {
+			addrs[i] = &values[i]
+		}
+		if err = rows.Scan(addrs...); err != nil {
+			log.Errorf("scan row err: %s", err)
+			return nil, err
+		}
+
+		m := make(map[string]any, len(columns))
+		for i, column := range columns {
+			m[column] = values[i]
+		}
+		result = append(result, m)
+	}
+	return result, rows.Err()
+}
+
+// Each queries and calls fn of type func(T) error with each row in streaming,
+// T is struct, pointer of struct or scalar for one column.
+// Iteration stops at the first error returned by fn.
+func (s *Session) Each(fn any) error {
+	defer s.Clear()
+	f := reflect.ValueOf(fn)
+	t := f.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.NumOut() != 1 || t.Out(0) != errorType {
+		return fmt.Errorf("each with %T: must be func(T) error", fn)
+	}
+
+	elemType := t.In(0)
+	isPtr := elemType.Kind() == reflect.Ptr && !isScalar(elemType)
+	if isPtr {
+		elemType = elemType.Elem()
+	}
+	return s.each(elemType, func(row reflect.Value) error {
+		if isPtr {
+			row = row.Addr()
+		}
+		if err, _ := f.Call([]reflect.Value{row})[0].Interface().(error); err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// query builds the select of model unless raw sql is given, so that a query with
+// joins or selected columns is scanned into any struct
+func (s *Session) query() {
+	if s.sql.Len() == 0 && s.refTable != nil {
+		sql, vars := s.buildSelect(s.refTable)
+		s.Raw(sql, vars...)
+	}
+}
+
+var (
+	errorType = reflect.TypeOf((*error)(nil)).Elem()
+	errStop   = errors.New("stop scanning")
+)
+
+// each scans rows of raw sql into values of typ and calls fn with them,
+// iteration stops without error if fn returns errStop
+func (s *Session) each(typ reflect.Type, fn func(row reflect.Value) error) error {
+	strict := s.strict
+	// columns of outer joins are NULL if not matched
+	joined := len(s.joins) > 0
+	s.query()
+	rows, err := s.QueryRows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	var table *schema.Schema
+	if isScalar(typ) {
+		if len(columns) != 1 {
+			return fmt.Errorf("scan %d columns into %s: must be one column", len(columns), typ)
+		}
+	} else if typ.Kind() == reflect.Struct {
+		var err error
+		if table, err = s.schemaOf(typ); err != nil {
+			return err
+		}
+	} else {
+		return fmt.Errorf("scan into %s: must be struct or scalar", typ)
+	}
+
+	reported := false
+	for rows.Next() {
+		dest := reflect.New(typ).Elem()
+		var addrs []any
+		if table == nil {
+			addrs = []any{scanAddr(dest)}
+		} else {
+			var unmapped []string
+			addrs, unmapped = scanDest(table, dest, columns)
+			if len(unmapped) > 0 && !reported {
+				if strict {
+					return &UnmappedColumnsError{Type: typ, Columns: unmapped}
+				}
+				log.Warnf("columns %s not mapped to %s", strings.Join(unmapped, ", "), typ)
+				reported = true
+			}
+		}
+		var nulls []nullField
+		if joined {
+			nulls = nullable(addrs)
+		}
+		if err = rows.Scan(addrs...); err != nil {
+			log.Errorf("scan row err: %s", err)
+			return err
+		}
+		for _, null := range nulls {
+			null.set()
+		}
+
+		if err = fn(dest); err == errStop {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// scanDest returns addresses of fields in dest by columns, and columns not mapped to any field,
+// values of unmapped columns are discarded
+func scanDest(table *schema.Schema, dest reflect.Value, columns []string) ([]any, []string) {
+	var unmapped []string
+	addrs := make([]any, 0, len(columns))
+	for _, column := range columns {
+		if field := fieldOf(table, column); field != nil {
+			addrs = append(addrs, scanAddr(dest.FieldByIndex(field.Index)))
+		} else {
+			addrs = append(addrs, new(any))
+			unmapped = append(unmapped, column)
+		}
+	}
+	return addrs, unmapped
+}
+
+// fieldOf returns the field mapped to column by column name or go field name,
+// case-insensitive and ignoring underscores if not matched exactly, eg. created_at to CreatedAt
+func fieldOf(table *schema.Schema, column string) *schema.Field {
+	if field := table.FieldByName(column); field != nil {
+		return field
+	}
+	name := strings.ReplaceAll(column, "_", "")
+	for _, field := range table.Fields {
+		if strings.EqualFold(name, strings.ReplaceAll(field.Name, "_", "")) ||
+			strings.EqualFold(name, field.FieldName) {
+			return field
+		}
+	}
+	return nil
+}
+
+// scanAddr returns the scan destination of v, time.Time is scanned by timeScanner
+// which also accepts text and unix seconds returned by expressions
+func scanAddr(v reflect.Value) any {
+	if v.Type() == timeType {
+		return &timeScanner{dest: v.Addr().Interface().(*time.Time)}
+	}
+	return v.Addr().Interface()
+}
+
+// nullField is a value scanned by pointer, so that NULL is scanned as zero value
+type nullField struct {
+	value reflect.Value
+	ptr   reflect.Value
+}
+
+func (f nullField) set() {
+	if p := f.ptr.Elem(); p.IsNil() {
+		f.value.Set(reflect.Zero(f.value.Type()))
+	} else {
+		f.value.Set(p.Elem())
+	}
+}
+
+// nullable replaces addresses of values which don't accept NULL with pointers of them,
+// values are set by the returned fields after scan
+func nullable(addrs []any) []nullField {
+	var fields []nullField
+	for i, addr := range addrs {
+		v := reflect.ValueOf(addr).Elem()
+		if _, ok := addr.(sql.Scanner); ok || v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+			continue
+		}
+		ptr := reflect.New(v.Addr().Type())
+		addrs[i] = ptr.Interface()
+		fields = append(fields, nullField{value: v, ptr: ptr})
+	}
+	return fields
+}
+
+// isScalar reports whether typ is scanned from one column
+func isScalar(typ reflect.Type) bool {
+	if typ.Kind() == reflect.Ptr {
+		return isScalar(typ.Elem())
+	}
+	return typ.Kind() != reflect.Struct || typ == timeType || reflect.PtrTo(typ).Implements(scannerType)
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+type timeScanner struct {
+	dest *time.Time
+}
+
+func (t *timeScanner) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*t.dest = time.Time{}
+	case time.Time:
+		*t.dest = v
+	case int64:
+		*t.dest = time.Unix(v, 0)
+	case []byte:
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
+	default:
+		return fmt.Errorf("scan %T into time.Time", src)
+	}
+	return nil
+}
+
+func (t *timeScanner) parse(s string) error {
+	for _, layout := range timeLayouts {
+		if v, err := time.Parse(layout, s); err == nil {
+			*t.dest = v
+			return nil
+		}
+	}
+	return fmt.Errorf("parse time %q", s)
+}
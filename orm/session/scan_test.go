@@ -0,0 +1,152 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func newUsers(t *testing.T) *Session {
+	t.Helper()
+	s := newTestSession(t)
+	if _, err := s.Insert(&User{Name: "Tom", Age: 18}, &User{Name: "Sam", Age: 20}, &User{Name: "Amy", Age: 20}); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScanOne(t *testing.T) {
+	s := newUsers(t)
+	var u User
+	if err := s.Raw("SELECT name, age FROM User WHERE Name = ?", "Sam").ScanOne(&u); err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "Sam" || u.Age != 20 {
+		t.Fatalf("scan one = %+v", u)
+	}
+
+	var n int
+	if err := s.Raw("SELECT COUNT(*) FROM User").ScanOne(&n); err != nil || n != 3 {
+		t.Fatalf("scan count = %d, %v, want 3", n, err)
+	}
+	// the model is queried without raw sql
+	if err := s.Model(&User{}).Where("Age = ?", 18).ScanOne(&u); err != nil || u.Name != "Tom" {
+		t.Fatalf("scan model = %+v, %v", u, err)
+	}
+
+	if err := s.Raw("SELECT * FROM User WHERE Name = ?", "Nobody").ScanOne(&u); !errors.Is(err, ErrRecordNotFound) {
+		t.Fatalf("scan of no rows err = %v, want ErrRecordNotFound", err)
+	}
+	if err := s.Raw("SELECT * FROM User").ScanOne(u); err == nil {
+		t.Fatal("scan into non-pointer should fail")
+	}
+	if err := s.Raw("SELECT Name, Age FROM User").ScanOne(&n); err == nil {
+		t.Fatal("scan of two columns into scalar should fail")
+	}
+}
+
+type ageGroup struct {
+	Age   int
+	Total int
+}
+
+func TestScanAll(t *testing.T) {
+	s := newUsers(t)
+	groups := []ageGroup{{Age: 1}}
+	if err := s.Raw("SELECT Age, COUNT(*) AS total FROM User GROUP BY Age ORDER BY Age").ScanAll(&groups); err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 || groups[0] != (ageGroup{18, 1}) || groups[1] != (ageGroup{20, 2}) {
+		t.Fatalf("scan all = %+v, want the rows only", groups)
+	}
+
+	var users []*User
+	if err := s.Raw("SELECT * FROM User ORDER BY ID").ScanAll(&users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 3 || users[2].Name != "Amy" {
+		t.Fatalf("scan all pointers = %v", users)
+	}
+
+	var names []string
+	if err := s.Raw("SELECT Name FROM User WHERE Age = ? ORDER BY Name", 20).ScanAll(&names); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names[0] != "Amy" || names[1] != "Sam" {
+		t.Fatalf("scan all names = %v", names)
+	}
+
+	if err := s.Raw("SELECT Name FROM User").ScanAll(&User{}); err == nil {
+		t.Fatal("scan all into non-slice should fail")
+	}
+}
+
+func TestScanMap(t *testing.T) {
+	s := newUsers(t)
+	rows, err := s.Raw("SELECT Name, Age * 2 AS Double FROM User ORDER BY ID").ScanMap()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("scan map = %v, want 3 rows", rows)
+	}
+	if name, _ := rows[0]["Name"].(string); name != "Tom" || rows[0]["Double"] != int64(36) {
+		t.Fatalf("first row = %v", rows[0])
+	}
+	if rows, err = s.Raw("SELECT * FROM User WHERE Age > 100").ScanMap(); err != nil || len(rows) != 0 {
+		t.Fatalf("scan map of no rows = %v, %v", rows, err)
+	}
+}
+
+func TestEach(t *testing.T) {
+	s := newUsers(t)
+	var names []string
+	err := s.Raw("SELECT * FROM User ORDER BY ID").Each(func(u *User) error {
+		names = append(names, u.Name)
+		return nil
+	})
+	if err != nil || len(names) != 3 || names[0] != "Tom" {
+		t.Fatalf("each = %v, %v", names, err)
+	}
+
+	// iteration stops at the error of fn
+	errStopped := errors.New("stopped")
+	var ages []int
+	err = s.Raw("SELECT Age FROM User ORDER BY ID").Each(func(age int) error {
+		ages = append(ages, age)
+		if len(ages) == 2 {
+			return errStopped
+		}
+		return nil
+	})
+	if !errors.Is(err, errStopped) || len(ages) != 2 {
+		t.Fatalf("each stopped = %v, %v, want 2 ages and the error of fn", ages, err)
+	}
+
+	if err = s.Raw("SELECT * FROM User").Each(func(u User) {}); err == nil {
+		t.Fatal("each with a func without error should fail")
+	}
+}
+
+func TestStrict(t *testing.T) {
+	s := newUsers(t)
+	query := "SELECT Name, Age * 2 AS Double FROM User ORDER BY ID"
+
+	var users []User
+	err := s.Raw(query).Strict().ScanAll(&users)
+	var unmapped *UnmappedColumnsError
+	if !errors.As(err, &unmapped) || len(unmapped.Columns) != 1 || unmapped.Columns[0] != "Double" {
+		t.Fatalf("strict scan all err = %v, want unmapped Double", err)
+	}
+	var u User
+	if err = s.Raw(query).Strict().ScanOne(&u); !errors.As(err, &unmapped) {
+		t.Fatalf("strict scan one err = %v, want *UnmappedColumnsError", err)
+	}
+
+	// strict applies to one statement, unmapped columns are discarded by default
+	if err = s.Raw(query).ScanAll(&users); err != nil || len(users) != 3 || users[0].Name != "Tom" {
+		t.Fatalf("scan all = %v, %v", users, err)
+	}
+	if err = s.Raw("SELECT Name, Age FROM User").Strict().ScanAll(&users); err != nil {
+		t.Fatalf("strict scan of mapped columns: %v", err)
+	}
+}
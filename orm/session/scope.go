@@ -0,0 +1,74 @@
+package session
+
+import (
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/pedrogao/orm/schema"
+)
+
+// ErrStaleObject is returned by Update if the version of record was changed by others
+var ErrStaleObject = errors.New("stale object")
+
+// Unscoped includes soft deleted records in the following statement,
+// and deletes records permanently
+func (s *Session) Unscoped() *Session {
+	s.unscoped = true
+	return s
+}
+
+// HardDelete deletes records permanently even if model supports soft delete
+func (s *Session) HardDelete() (int64, error) {
+	return s.Unscoped().Delete()
+}
+
+// scope excludes soft deleted records of table unless unscoped
+func (s *Session) scope(table *schema.Schema) {
+	if table.DeletedAt != nil && !s.unscoped {
+		column := table.DeletedAt.Name
+		if len(s.joins) > 0 {
+			column = table.Name + "." + column
+		}
+		s.where.And(s.quote(column) + " IS NULL")
+	}
+}
+
+// softDelete reports whether records of table are deleted by setting DeletedAt
+func (s *Session) softDelete(table *schema.Schema) bool {
+	return table.DeletedAt != nil && !s.unscoped
+}
+
+// touch sets timestamps and version of value before insert
+func touch(table *schema.Schema, value any, now time.Time) {
+	dest := reflect.Indirect(reflect.ValueOf(value))
+	if !dest.CanAddr() {
+		return
+	}
+
+	for _, field := range []*schema.Field{table.CreatedAt, table.UpdatedAt} {
+		if field == nil {
+			continue
+		}
+		if v := dest.FieldByIndex(field.Index); v.IsZero() {
+			schema.SetTime(v, now)
+		}
+	}
+	if table.Version != nil {
+		if v := dest.FieldByIndex(table.Version.Index); v.IsZero() {
+			setInt(v, 1)
+		}
+	}
+}
+
+// toInt64 converts an integer of any kind to int64
+func toInt64(value any) (int64, bool) {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
@@ -0,0 +1,150 @@
+package session
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type Post struct {
+	ID        int
+	Title     string
+	Version   int
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt *time.Time
+}
+
+func newPosts(t *testing.T, titles ...string) *Session {
+	t.Helper()
+	s := newTestSession(t)
+	if err := s.Model(&Post{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	for _, title := range titles {
+		if _, err := s.Insert(&Post{Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func TestSoftDelete(t *testing.T) {
+	s := newPosts(t, "a", "b", "c")
+
+	if n, err := s.Model(&Post{}).Where("Title = ?", "a").Delete(); err != nil || n != 1 {
+		t.Fatalf("soft delete = %d, %v, want 1", n, err)
+	}
+	if n, err := s.Model(&Post{}).Count(); err != nil || n != 2 {
+		t.Fatalf("count = %d, %v, want 2", n, err)
+	}
+	var posts []Post
+	if err := s.OrderBy("ID").Find(&posts); err != nil || len(posts) != 2 || posts[0].Title != "b" {
+		t.Fatalf("find = %v, %v, want b and c", posts, err)
+	}
+	// deleted records aren't deleted again
+	if n, err := s.Model(&Post{}).Where("Title = ?", "a").Delete(); err != nil || n != 0 {
+		t.Fatalf("delete of deleted record = %d, %v, want 0", n, err)
+	}
+
+	if n, err := s.Model(&Post{}).Unscoped().Count(); err != nil || n != 3 {
+		t.Fatalf("unscoped count = %d, %v, want 3", n, err)
+	}
+	if err := s.Unscoped().OrderBy("ID").Find(&posts); err != nil || len(posts) != 3 {
+		t.Fatalf("unscoped find = %v, %v, want 3", posts, err)
+	}
+	if posts[0].DeletedAt == nil || posts[1].DeletedAt != nil {
+		t.Fatalf("DeletedAt = %v, %v, want only a deleted", posts[0].DeletedAt, posts[1].DeletedAt)
+	}
+
+	// unscoped delete removes records permanently
+	if n, err := s.Model(&Post{}).Unscoped().Where("Title IN (?, ?)", "a", "b").Delete(); err != nil || n != 2 {
+		t.Fatalf("unscoped delete = %d, %v, want 2", n, err)
+	}
+	if n, err := s.Model(&Post{}).Unscoped().Count(); err != nil || n != 1 {
+		t.Fatalf("unscoped count after hard delete = %d, %v, want 1", n, err)
+	}
+}
+
+func TestStaleUpdate(t *testing.T) {
+	s := newPosts(t, "a")
+	var mine, theirs Post
+	if err := s.First(&mine); err != nil {
+		t.Fatal(err)
+	}
+	theirs = mine
+	if mine.Version != 1 {
+		t.Fatalf("version after insert = %d, want 1", mine.Version)
+	}
+
+	theirs.Title = "theirs"
+	if _, err := s.Update(&theirs); err != nil {
+		t.Fatal(err)
+	}
+	if theirs.Version != 2 {
+		t.Fatalf("version after update = %d, want 2", theirs.Version)
+	}
+
+	mine.Title = "mine"
+	updatedAt := mine.UpdatedAt
+	if _, err := s.Update(&mine); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("stale update err = %v, want ErrStaleObject", err)
+	}
+	if mine.Version != 1 || !mine.UpdatedAt.Equal(updatedAt) {
+		t.Fatalf("stale object after failure = %+v", mine)
+	}
+	var got Post
+	if err := s.First(&got); err != nil || got.Title != "theirs" || got.Version != 2 {
+		t.Fatalf("record = %+v, %v, want the update of theirs", got, err)
+	}
+
+	// the map of a stale version doesn't update either
+	_, err := s.Model(&Post{}).Where("ID = ?", got.ID).Update(map[string]any{"Title": "map", "Version": 1})
+	if !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("stale map update err = %v, want ErrStaleObject", err)
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	s := newPosts(t)
+	before := time.Now()
+	post := &Post{Title: "a"}
+	if _, err := s.Insert(post); err != nil {
+		t.Fatal(err)
+	}
+	if post.CreatedAt.Before(before) || !post.UpdatedAt.Equal(post.CreatedAt) {
+		t.Fatalf("timestamps after insert = %s, %s", post.CreatedAt, post.UpdatedAt)
+	}
+	created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := s.Insert(&Post{Title: "b", CreatedAt: created}); err != nil {
+		t.Fatal(err)
+	}
+	var b Post
+	if err := s.Where("Title = ?", "b").First(&b); err != nil || !b.CreatedAt.Equal(created) {
+		t.Fatalf("given CreatedAt = %s, %v, want %s", b.CreatedAt, err, created)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	post.Title = "c"
+	if _, err := s.Update(post); err != nil {
+		t.Fatal(err)
+	}
+	if !post.UpdatedAt.After(post.CreatedAt) {
+		t.Fatalf("UpdatedAt after update = %s, want after %s", post.UpdatedAt, post.CreatedAt)
+	}
+	var got Post
+	if err := s.Where("ID = ?", post.ID).First(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.CreatedAt.Equal(post.CreatedAt) || !got.UpdatedAt.Equal(post.UpdatedAt) {
+		t.Fatalf("stored timestamps = %s, %s, want %s, %s", got.CreatedAt, got.UpdatedAt, post.CreatedAt, post.UpdatedAt)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if _, err := s.Model(&Post{}).Where("ID = ?", post.ID).Update(map[string]any{"Title": "d"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Where("ID = ?", post.ID).First(&got); err != nil || !got.UpdatedAt.After(post.UpdatedAt) {
+		t.Fatalf("UpdatedAt after map update = %s, %v, want after %s", got.UpdatedAt, err, post.UpdatedAt)
+	}
+}
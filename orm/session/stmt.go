@@ -0,0 +1,176 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/pedrogao/log"
+)
+
+// StmtCache is a LRU cache of prepared statements keyed by sql, statements are
+// removed on eviction, reset and connection errors, and closed once they're released
+type StmtCache struct {
+	mu       sync.Mutex
+	db       *sql.DB
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	stats    StmtCacheStats
+}
+
+type StmtCacheStats struct {
+	Size          int
+	Hits          uint64
+	Misses        uint64
+	Evictions     uint64
+	Invalidations uint64
+}
+
+type stmtEntry struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int  // users of stmt, protected by mu of cache
+	removed bool // stmt is closed once it's released by all users
+}
+
+func NewStmtCache(db *sql.DB, capacity int) *StmtCache {
+	return &StmtCache{
+		db:       db,
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the prepared statement of query, prepares it on miss. The statement
+// isn't closed until release is called, even if it's removed from cache meanwhile.
+func (c *StmtCache) Get(ctx context.Context, query string) (stmt *sql.Stmt, release func(), err error) {
+	c.mu.Lock()
+	if e, ok := c.items[query]; ok {
+		c.ll.MoveToFront(e)
+		c.stats.Hits++
+		entry := c.acquire(e)
+		c.mu.Unlock()
+		return entry.stmt, func() { c.release(entry) }, nil
+	}
+	c.stats.Misses++
+	c.mu.Unlock()
+
+	// prepare without lock, the statement prepared later is dropped if raced
+	stmt, err = c.db.PrepareContext(ctx, query)
+	if err != nil {
+		log.Errorf("prepare stmt err: %s", err)
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[query]
+	if ok {
+		_ = stmt.Close()
+	} else {
+		e = c.ll.PushFront(&stmtEntry{query: query, stmt: stmt})
+		c.items[query] = e
+	}
+	// acquired before eviction, so that the statement isn't closed before use
+	entry := c.acquire(e)
+	for c.capacity > 0 && c.ll.Len() > c.capacity {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+	return entry.stmt, func() { c.release(entry) }, nil
+}
+
+func (c *StmtCache) acquire(e *list.Element) *stmtEntry {
+	entry := e.Value.(*stmtEntry)
+	entry.refs++
+	return entry
+}
+
+func (c *StmtCache) release(entry *stmtEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refs--
+	if entry.removed && entry.refs == 0 {
+		closeStmt(entry.stmt)
+	}
+}
+
+// Invalidate closes and removes the statement of query
+func (c *StmtCache) Invalidate(query string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[query]; ok {
+		c.removeElement(e)
+		c.stats.Invalidations++
+	}
+}
+
+// Reset closes and removes all statements
+func (c *StmtCache) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for e := c.ll.Front(); e != nil; e = c.ll.Front() {
+		c.removeElement(e)
+	}
+}
+
+func (c *StmtCache) Stats() StmtCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Size = c.ll.Len()
+	return stats
+}
+
+// removeElement removes the statement, which is closed now or once it's released
+func (c *StmtCache) removeElement(e *list.Element) {
+	entry := c.ll.Remove(e).(*stmtEntry)
+	delete(c.items, entry.query)
+	entry.removed = true
+	if entry.refs == 0 {
+		closeStmt(entry.stmt)
+	}
+}
+
+// closeStmt closes stmt, rows of stmt still open keep it until they're closed
+func closeStmt(stmt *sql.Stmt) {
+	if err := stmt.Close(); err != nil {
+		log.Errorf("close stmt err: %s", err)
+	}
+}
+
+// check invalidates the statement of query if err is a connection error
+func (c *StmtCache) check(query string, err error) {
+	if err != nil && (errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone)) {
+		c.Invalidate(query)
+	}
+}
+
+// cacheable reports whether query is a single DML or query statement,
+// DDL isn't worth caching and drivers may prepare only the first of many statements
+func cacheable(query string) bool {
+	query = strings.TrimSpace(query)
+	if i := strings.IndexByte(query, ';'); i >= 0 && i != len(query)-1 {
+		return false
+	}
+	keyword := query
+	if i := strings.IndexAny(query, " \t\n("); i >= 0 {
+		keyword = query[:i]
+	}
+	switch strings.ToUpper(keyword) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "WITH":
+		return true
+	}
+	return false
+}
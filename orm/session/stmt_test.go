@@ -0,0 +1,134 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/orm/dialect"
+)
+
+func TestStmtCacheEvictInUse(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	c := NewStmtCache(db, 1)
+	stmt, release, err := c.Get(ctx, "SELECT 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// evicts the statement in use
+	_, release2, err := c.Get(ctx, "SELECT 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release2()
+	if stats := c.Stats(); stats.Size != 1 || stats.Evictions != 1 {
+		t.Fatalf("stats = %+v, want 1 statement and 1 eviction", stats)
+	}
+
+	var n int
+	if err = stmt.QueryRowContext(ctx).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("query of evicted stmt in use = %d, %v", n, err)
+	}
+	release()
+	if err = stmt.QueryRowContext(ctx).Scan(&n); err == nil {
+		t.Fatal("evicted stmt isn't closed after release")
+	}
+
+	c.Reset()
+	if stats := c.Stats(); stats.Size != 0 {
+		t.Fatalf("size after reset = %d", stats.Size)
+	}
+}
+
+func TestStmtCacheConcurrent(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	d, _ := dialect.GetDialect("sqlite3")
+	stmts := NewStmtCache(db, 2)
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := New(db, d, WithStmtCache(stmts))
+			for j := 0; j < 100; j++ {
+				want := (i + j) % 5
+				var n int
+				// few slots of many queries, statements are evicted while others use them
+				if err := s.Raw(fmt.Sprintf("SELECT %d", want)).QueryRow().Scan(&n); err != nil || n != want {
+					errs <- fmt.Errorf("query %d = %d, %v", want, n, err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestStmtCacheInTransaction(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1) // the connection is held by the transaction
+
+	d, _ := dialect.GetDialect("sqlite3")
+	stmts := NewStmtCache(db, 4)
+	s := New(db, d, WithStmtCache(stmts))
+	if err = s.Model(&User{}).CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Transaction(func(s *Session) error {
+			if _, err := s.Raw("INSERT INTO User (Name, Age) VALUES (?, ?)", "Tom", 18).Exec(); err != nil {
+				return err
+			}
+			var n int
+			if err := s.Raw("SELECT COUNT(*) FROM User WHERE Age = ?", 18).QueryRow().Scan(&n); err != nil {
+				return err
+			}
+			if n != 1 {
+				return fmt.Errorf("count in transaction = %d, want 1", n)
+			}
+			return nil
+		})
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("statements in transaction wait for the connection held by the transaction")
+	}
+
+	// statements out of transaction are cached
+	var n int
+	if err = s.Raw("SELECT COUNT(*) FROM User WHERE Age = ?", 18).QueryRow().Scan(&n); err != nil || n != 1 {
+		t.Fatalf("count = %d, %v, want 1", n, err)
+	}
+	if stats := stmts.Stats(); stats.Size != 1 {
+		t.Fatalf("cached statements = %d, want 1", stats.Size)
+	}
+}
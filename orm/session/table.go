@@ -0,0 +1,232 @@
+package session
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/schema"
+)
+
+var ErrModelNotSet = errors.New("model is not set")
+
+// Model sets the model which is operated by session, statements of the session
+// fail if the model can't be parsed
+func (s *Session) Model(value any) *Session {
+	// parse again only if model changed
+	if s.refTable == nil || reflect.TypeOf(value) != reflect.TypeOf(s.refTable.Model) {
+		table, err := schema.Parse(value, s.dialect)
+		if err != nil {
+			log.Errorf("model err: %s", err)
+		}
+		s.refTable, s.modelErr = table, err
+	}
+	return s
+}
+
+func (s *Session) RefTable() *schema.Schema {
+	if s.refTable == nil {
+		log.Error(s.tableErr())
+	}
+	return s.refTable
+}
+
+// Table returns the schema of model, or the error of parsing it
+func (s *Session) Table() (*schema.Schema, error) {
+	if s.refTable == nil {
+		return nil, s.tableErr()
+	}
+	return s.refTable, nil
+}
+
+func (s *Session) tableErr() error {
+	if s.modelErr != nil {
+		return s.modelErr
+	}
+	return ErrModelNotSet
+}
+
+func (s *Session) CreateTable() error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	var columns []string
+	for _, field := range table.Fields {
+		columns = append(columns, s.columnSQL(field))
+	}
+	desc := strings.Join(columns, ", ")
+	if _, err = s.Raw(fmt.Sprintf("CREATE TABLE %s (%s);", s.dialect.Quote(table.Name), desc)).Exec(); err != nil {
+		return err
+	}
+
+	for _, index := range table.Indexes {
+		if err := s.CreateIndex(index); err != nil {
+			return err
+		}
+	}
+	return s.CreateJoinTables()
+}
+
+func (s *Session) DropTable() error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Raw(fmt.Sprintf("DROP TABLE IF EXISTS %s", s.dialect.Quote(table.Name))).Exec()
+	return err
+}
+
+// HasTable reports whether the table of model exists in database
+func (s *Session) HasTable() (bool, error) {
+	table, err := s.Table()
+	if err != nil {
+		return false, err
+	}
+
+	query, values := s.dialect.TableExistSQL(table.Name)
+	row := s.Raw(query, values...).QueryRow()
+	var tmp string
+	if err = row.Scan(&tmp); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return tmp == table.Name, nil
+}
+
+// Columns returns column names of the table in database
+func (s *Session) Columns() ([]string, error) {
+	table, err := s.Table()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.Raw(fmt.Sprintf("SELECT * FROM %s LIMIT 1", s.dialect.Quote(table.Name))).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return rows.Columns()
+}
+
+// Indexes returns index names of the table in database
+func (s *Session) Indexes() ([]string, error) {
+	table, err := s.Table()
+	if err != nil {
+		return nil, err
+	}
+
+	sql, values := s.dialect.IndexesSQL(table.Name)
+	rows, err := s.Raw(sql, values...).QueryRows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		indexes = append(indexes, name)
+	}
+	return indexes, rows.Err()
+}
+
+func (s *Session) AddColumn(field *schema.Field) error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Raw(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s",
+		s.dialect.Quote(table.Name), s.columnSQL(field))).Exec()
+	return err
+}
+
+func (s *Session) DropColumn(name string) error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Raw(fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s",
+		s.dialect.Quote(table.Name), s.dialect.Quote(name))).Exec()
+	return err
+}
+
+func (s *Session) RenameColumn(from, to string) error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Raw(fmt.Sprintf("ALTER TABLE %s RENAME COLUMN %s TO %s",
+		s.dialect.Quote(table.Name), s.dialect.Quote(from), s.dialect.Quote(to))).Exec()
+	return err
+}
+
+func (s *Session) CreateIndex(index *schema.Index) error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	columns := make([]string, 0, len(index.Columns))
+	for _, column := range index.Columns {
+		columns = append(columns, s.dialect.Quote(column))
+	}
+	unique := ""
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	_, err = s.Raw(fmt.Sprintf("CREATE %sINDEX %s ON %s (%s)", unique, s.dialect.Quote(index.Name),
+		s.dialect.Quote(table.Name), strings.Join(columns, ", "))).Exec()
+	return err
+}
+
+func (s *Session) DropIndex(name string) error {
+	table, err := s.Table()
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Raw(s.dialect.DropIndexSQL(table.Name, name)).Exec()
+	return err
+}
+
+// columnSQL returns definition of column, eg. "Name" text NOT NULL
+func (s *Session) columnSQL(field *schema.Field) string {
+	var sb strings.Builder
+	sb.WriteString(s.dialect.Quote(field.Name))
+	sb.WriteString(" ")
+	switch {
+	case field.PrimaryKey && field.AutoIncrement:
+		sb.WriteString(s.dialect.AutoIncrementSQL(field.Type))
+	case field.PrimaryKey:
+		sb.WriteString(field.Type)
+		sb.WriteString(" PRIMARY KEY")
+	default:
+		sb.WriteString(field.Type)
+	}
+	if field.NotNull {
+		sb.WriteString(" NOT NULL")
+	}
+	if field.Unique {
+		sb.WriteString(" UNIQUE")
+	}
+	if field.Default != "" {
+		sb.WriteString(" DEFAULT ")
+		sb.WriteString(field.Default)
+	}
+	return sb.String()
+}
@@ -0,0 +1,121 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/pedrogao/log"
+)
+
+var ErrNoTransaction = errors.New("no active transaction")
+
+// Begin starts a transaction, or a savepoint if a transaction is already active
+func (s *Session) Begin() (err error) {
+	if s.tx == nil {
+		log.Info("transaction begin")
+		// statement timeout isn't applied, the transaction is rolled back once ctx is done
+		if s.tx, err = s.db.BeginTx(s.Context(), nil); err != nil {
+			log.Errorf("transaction begin err: %s", err)
+			return
+		}
+		s.txDepth = 1
+		if s.cache != nil {
+			s.txTables = make(map[string]struct{})
+		}
+		return
+	}
+
+	if err = s.savepoint("SAVEPOINT %s"); err != nil {
+		return
+	}
+	s.txDepth++
+	return
+}
+
+// Commit commits the transaction, or releases the savepoint of a nested transaction
+func (s *Session) Commit() (err error) {
+	if s.tx == nil {
+		return ErrNoTransaction
+	}
+
+	s.txDepth--
+	if s.txDepth > 0 {
+		return s.savepoint("RELEASE SAVEPOINT %s")
+	}
+
+	log.Info("transaction commit")
+	if err = s.tx.Commit(); err != nil {
+		log.Errorf("transaction commit err: %s", err)
+	}
+	s.tx = nil
+	if len(s.txTables) > 0 {
+		tables := make([]string, 0, len(s.txTables))
+		for table := range s.txTables {
+			tables = append(tables, table)
+		}
+		s.invalidateTables(tables...)
+	}
+	s.txTables = nil
+	return
+}
+
+// Rollback rollbacks the transaction, or rollbacks to the savepoint of a nested transaction
+func (s *Session) Rollback() (err error) {
+	if s.tx == nil {
+		return ErrNoTransaction
+	}
+
+	s.txDepth--
+	if s.txDepth > 0 {
+		// the savepoint is still on the stack after rolled back to
+		if err = s.savepoint("ROLLBACK TO SAVEPOINT %s"); err != nil {
+			return
+		}
+		return s.savepoint("RELEASE SAVEPOINT %s")
+	}
+
+	log.Info("transaction rollback")
+	if err = s.tx.Rollback(); err != nil {
+		log.Errorf("transaction rollback err: %s", err)
+	}
+	s.tx = nil
+	s.txTables = nil
+	return
+}
+
+// InTransaction reports whether a transaction is active
+func (s *Session) InTransaction() bool {
+	return s.tx != nil
+}
+
+// Transaction runs f in a transaction, commits if f returns nil, otherwise
+// rollbacks on error or panic, nested calls are mapped to savepoints
+func (s *Session) Transaction(f func(*Session) error) (err error) {
+	if err = s.Begin(); err != nil {
+		return
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = s.Rollback()
+			panic(p) // re-throw panic after rollback
+		} else if err != nil {
+			_ = s.Rollback()
+		} else {
+			err = s.Commit()
+		}
+	}()
+
+	return f(s)
+}
+
+// savepoint executes a savepoint statement named by current depth
+func (s *Session) savepoint(format string) error {
+	sql := fmt.Sprintf(format, s.dialect.Quote(fmt.Sprintf("sp_%d", s.txDepth)))
+	log.Infof("transaction: %s", sql)
+	if _, err := s.tx.ExecContext(s.Context(), sql); err != nil {
+		log.Errorf("transaction savepoint err: %s", err)
+		return err
+	}
+	return nil
+}
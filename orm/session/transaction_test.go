@@ -0,0 +1,145 @@
+package session
+
+import (
+	"errors"
+	"testing"
+)
+
+func userNames(t *testing.T, s *Session) []string {
+	t.Helper()
+	var users []User
+	if err := s.OrderBy("ID").Find(&users); err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+func TestTransactionCommit(t *testing.T) {
+	s := newTestSession(t)
+	err := s.Transaction(func(s *Session) error {
+		if !s.InTransaction() {
+			t.Fatal("no transaction in Transaction")
+		}
+		_, err := s.Insert(&User{Name: "Tom"}, &User{Name: "Sam"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.InTransaction() {
+		t.Fatal("transaction is active after commit")
+	}
+	if names := userNames(t, s); len(names) != 2 {
+		t.Fatalf("users after commit = %v, want 2", names)
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	s := newTestSession(t)
+	errFailed := errors.New("failed")
+	err := s.Transaction(func(s *Session) error {
+		if _, err := s.Insert(&User{Name: "Tom"}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("transaction err = %v, want %v", err, errFailed)
+	}
+	if s.InTransaction() {
+		t.Fatal("transaction is active after rollback")
+	}
+	if names := userNames(t, s); len(names) != 0 {
+		t.Fatalf("users after rollback = %v, want none", names)
+	}
+
+	if err = s.Commit(); !errors.Is(err, ErrNoTransaction) {
+		t.Fatalf("commit without transaction = %v, want ErrNoTransaction", err)
+	}
+	if err = s.Rollback(); !errors.Is(err, ErrNoTransaction) {
+		t.Fatalf("rollback without transaction = %v, want ErrNoTransaction", err)
+	}
+}
+
+func TestTransactionPanic(t *testing.T) {
+	s := newTestSession(t)
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Fatalf("recovered %v, want the panic of f", p)
+			}
+		}()
+		_ = s.Transaction(func(s *Session) error {
+			if _, err := s.Insert(&User{Name: "Tom"}); err != nil {
+				return err
+			}
+			panic("boom")
+		})
+	}()
+	if s.InTransaction() {
+		t.Fatal("transaction is active after panic")
+	}
+	if names := userNames(t, s); len(names) != 0 {
+		t.Fatalf("users after panic = %v, want none", names)
+	}
+}
+
+func TestNestedTransaction(t *testing.T) {
+	s := newTestSession(t)
+	errFailed := errors.New("failed")
+	err := s.Transaction(func(s *Session) error {
+		if _, err := s.Insert(&User{Name: "Tom"}); err != nil {
+			return err
+		}
+		// the failed savepoint is rolled back to and released, the outer transaction goes on
+		err := s.Transaction(func(s *Session) error {
+			if _, err := s.Insert(&User{Name: "Sam"}); err != nil {
+				return err
+			}
+			return s.Transaction(func(s *Session) error {
+				if _, err := s.Insert(&User{Name: "Jack"}); err != nil {
+					return err
+				}
+				return errFailed
+			})
+		})
+		if !errors.Is(err, errFailed) {
+			t.Fatalf("nested transaction err = %v, want %v", err, errFailed)
+		}
+		if names := userNames(t, s); len(names) != 1 || names[0] != "Tom" {
+			t.Fatalf("users after nested rollback = %v, want Tom", names)
+		}
+
+		return s.Transaction(func(s *Session) error {
+			_, err := s.Insert(&User{Name: "Amy"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names := userNames(t, s); len(names) != 2 || names[0] != "Tom" || names[1] != "Amy" {
+		t.Fatalf("users after commit = %v, want Tom and Amy", names)
+	}
+
+	// releasing a savepoint keeps its changes until the outer transaction rollbacks
+	err = s.Transaction(func(s *Session) error {
+		if err := s.Transaction(func(s *Session) error {
+			_, err := s.Insert(&User{Name: "Bob"})
+			return err
+		}); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("transaction err = %v, want %v", err, errFailed)
+	}
+	if names := userNames(t, s); len(names) != 2 {
+		t.Fatalf("users after rollback = %v, want Tom and Amy", names)
+	}
+}
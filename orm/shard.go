@@ -0,0 +1,320 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/orm/schema"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// ErrCrossShard is returned if a statement in a transaction targets shards other than the transaction's
+var ErrCrossShard = errors.New("cross-shard transaction")
+
+// ErrZeroShardKey is returned if a record to insert has no shard key, which can't be routed
+var ErrZeroShardKey = errors.New("zero shard key")
+
+// Sharder maps a key to one of n shards
+type Sharder interface {
+	Shard(key any, n int) (int, error)
+}
+
+// HashSharder shards keys by FNV-1a hash of their text, so keys of any integer type are sharded alike
+type HashSharder struct{}
+
+func (HashSharder) Shard(key any, n int) (int, error) {
+	v := reflect.ValueOf(key)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.Kind() == reflect.Ptr {
+		return 0, fmt.Errorf("shard key %v: must not be nil", key)
+	}
+	h := fnv.New32a()
+	_, _ = fmt.Fprint(h, v.Interface())
+	return int(h.Sum32() % uint32(n)), nil
+}
+
+// RangeSharder shards keys by ascending Bounds, keys less than Bounds[i] belong to shard i,
+// and other keys to shard len(Bounds), eg. RangeSharder{Bounds: []any{1000, 2000}} for 3 shards
+type RangeSharder struct {
+	Bounds []any
+}
+
+func (r RangeSharder) Shard(key any, n int) (int, error) {
+	i := 0
+	for ; i < len(r.Bounds); i++ {
+		c, err := compareKeys(key, r.Bounds[i])
+		if err != nil {
+			return 0, err
+		}
+		if c < 0 {
+			break
+		}
+	}
+	if i >= n {
+		return 0, fmt.Errorf("shard key %v: range %d out of %d shards", key, i, n)
+	}
+	return i, nil
+}
+
+// compareKeys compares integers, floats or strings
+func compareKeys(a, b any) (int, error) {
+	x, y := reflect.Indirect(reflect.ValueOf(a)), reflect.Indirect(reflect.ValueOf(b))
+	if !x.IsValid() || !y.IsValid() {
+		return 0, fmt.Errorf("compare shard keys %v and %v: must not be nil", a, b)
+	}
+	if c, ok := compareValues(x, y); ok {
+		return c, nil
+	}
+	return 0, fmt.Errorf("compare shard keys %v and %v: incompatible types %s and %s", a, b, x.Type(), y.Type())
+}
+
+// compareValues compares numbers, strings, bools or times, ok is false if they aren't comparable
+func compareValues(x, y reflect.Value) (c int, ok bool) {
+	switch {
+	case isNumber(x.Kind()) && isNumber(y.Kind()):
+		if isFloat(x.Kind()) || isFloat(y.Kind()) {
+			return compareOrdered(toFloat(x), toFloat(y)), true
+		}
+		switch {
+		case isInt(x.Kind()) && isInt(y.Kind()):
+			return compareOrdered(x.Int(), y.Int()), true
+		case isUint(x.Kind()) && isUint(y.Kind()):
+			return compareOrdered(x.Uint(), y.Uint()), true
+		case isInt(x.Kind()):
+			// a negative int is less than any uint, compared exactly as uint64 otherwise
+			if x.Int() < 0 {
+				return -1, true
+			}
+			return compareOrdered(uint64(x.Int()), y.Uint()), true
+		}
+		if y.Int() < 0 {
+			return 1, true
+		}
+		return compareOrdered(x.Uint(), uint64(y.Int())), true
+	case x.Kind() == reflect.String && y.Kind() == reflect.String:
+		return compareOrdered(x.String(), y.String()), true
+	case x.Kind() == reflect.Bool && y.Kind() == reflect.Bool:
+		return compareOrdered(boolInt(x.Bool()), boolInt(y.Bool())), true
+	case x.Type() == timeType && y.Type() == timeType:
+		t, u := x.Interface().(time.Time), y.Interface().(time.Time)
+		switch {
+		case t.Before(u):
+			return -1, true
+		case t.After(u):
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func compareOrdered[T int | int64 | uint64 | float64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumber(k reflect.Kind) bool {
+	return isInt(k) || isUint(k) || isFloat(k)
+}
+
+func isInt(k reflect.Kind) bool {
+	return k >= reflect.Int && k <= reflect.Int64
+}
+
+func isUint(k reflect.Kind) bool {
+	return k >= reflect.Uint && k <= reflect.Uintptr
+}
+
+func isFloat(k reflect.Kind) bool {
+	return k == reflect.Float32 || k == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isInt(v.Kind()):
+		return float64(v.Int())
+	case isUint(v.Kind()):
+		return float64(v.Uint())
+	}
+	return v.Float()
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// ShardRule shards records of Model by the Key column, which is a column name or go field name
+type ShardRule struct {
+	Model   any
+	Key     string
+	Sharder Sharder
+}
+
+type shardRule struct {
+	key     *schema.Field
+	sharder Sharder
+}
+
+// shard returns the shard of key among n shards
+func (r *shardRule) shard(key any, n int) (int, error) {
+	i, err := r.sharder.Shard(key, n)
+	if err == nil && (i < 0 || i >= n) {
+		err = fmt.Errorf("shard key %v: shard %d out of %d shards", key, i, n)
+	}
+	return i, err
+}
+
+// ShardedEngine routes statements of sharded models to the engines of shards by their keys,
+// statements of other models go to the first shard
+type ShardedEngine struct {
+	shards []*Engine
+	rules  map[string]*shardRule // by table name
+}
+
+// NewShardedEngine returns an engine of shards, shards[i] is the engine of shard i
+func NewShardedEngine(shards []*Engine, rules ...ShardRule) (*ShardedEngine, error) {
+	if len(shards) == 0 {
+		return nil, errors.New("sharded engine: no shard")
+	}
+
+	e := &ShardedEngine{shards: shards, rules: map[string]*shardRule{}}
+	for _, rule := range rules {
+		table, err := schema.Parse(rule.Model, shards[0].Dialect())
+		if err != nil {
+			return nil, fmt.Errorf("sharded engine: %w", err)
+		}
+		key := table.FieldByName(rule.Key)
+		if key == nil {
+			return nil, fmt.Errorf("sharded engine: key %s not found in %s", rule.Key, table.Name)
+		}
+		if key.AutoIncrement {
+			// each shard generates its own ids, they're unknown when routing and collide across shards
+			return nil, fmt.Errorf("sharded engine: key %s of %s must not be auto increment", rule.Key, table.Name)
+		}
+		sharder := rule.Sharder
+		if sharder == nil {
+			sharder = HashSharder{}
+		}
+		e.rules[table.Name] = &shardRule{key: key, sharder: sharder}
+	}
+	return e, nil
+}
+
+// Shards returns engines of shards
+func (e *ShardedEngine) Shards() []*Engine {
+	return e.shards
+}
+
+// AutoMigrate migrates models on all shards
+func (e *ShardedEngine) AutoMigrate(models ...any) error {
+	for i, shard := range e.shards {
+		if err := shard.AutoMigrate(models...); err != nil {
+			log.Errorf("migrate shard %d err: %s", i, err)
+			return fmt.Errorf("migrate shard %d err: %s", i, err)
+		}
+	}
+	return nil
+}
+
+func (e *ShardedEngine) Close() (err error) {
+	for _, shard := range e.shards {
+		if closeErr := shard.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return
+}
+
+func (e *ShardedEngine) NewSession() *ShardSession {
+	return &ShardSession{engine: e, limit: -1}
+}
+
+// Transaction runs f in a transaction on the shard of the first statement, statements
+// targeting other shards fail with ErrCrossShard. It commits if f returns nil,
+// otherwise rollbacks on error or panic.
+func (e *ShardedEngine) Transaction(f func(*ShardSession) error) (err error) {
+	s := e.NewSession()
+	s.inTx = true
+	defer func() {
+		if s.tx == nil {
+			return
+		}
+		if p := recover(); p != nil {
+			_ = s.tx.Rollback()
+			panic(p) // re-throw panic after rollback
+		} else if err != nil {
+			_ = s.tx.Rollback()
+		} else {
+			err = s.tx.Commit()
+		}
+	}()
+
+	return f(s)
+}
+
+// rule returns the rule of table, nil if table isn't sharded
+func (e *ShardedEngine) rule(table *schema.Schema) *shardRule {
+	if table == nil {
+		return nil
+	}
+	return e.rules[table.Name]
+}
+
+// shardSet is a set of shard indexes, nil for all shards
+type shardSet map[int]bool
+
+func (s shardSet) intersect(o shardSet) shardSet {
+	if s == nil {
+		return o
+	}
+	if o == nil {
+		return s
+	}
+	r := shardSet{}
+	for i := range s {
+		if o[i] {
+			r[i] = true
+		}
+	}
+	return r
+}
+
+func (s shardSet) union(o shardSet) shardSet {
+	if s == nil || o == nil {
+		return nil
+	}
+	r := shardSet{}
+	for i := range s {
+		r[i] = true
+	}
+	for i := range o {
+		r[i] = true
+	}
+	return r
+}
+
+// list returns ascending indexes of set among n shards
+func (s shardSet) list(n int) []int {
+	var list []int
+	for i := 0; i < n; i++ {
+		if s == nil || s[i] {
+			list = append(list, i)
+		}
+	}
+	return list
+}
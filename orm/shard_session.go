@@ -0,0 +1,535 @@
+package orm
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pedrogao/orm/schema"
+	"github.com/pedrogao/orm/session"
+)
+
+// ShardSession routes statements to shards by the key of sharded model: statements restricting
+// the key by `Key = ?` or `Key IN (?)` go to their shards, and others fan out to all shards.
+// Reads fanned out are merged by OrderBy of model columns, then Offset and Limit are applied.
+// Writes fanned out aren't atomic, each shard commits its own statement, so a failure on one
+// shard leaves writes of other shards in place. Use Transaction to write a single shard atomically.
+type ShardSession struct {
+	engine *ShardedEngine
+	ctx    context.Context
+	model  any
+	// builder calls replayed on the session of each shard
+	ops    []func(*session.Session)
+	preds  []shardPred
+	orders []string
+	limit  int // -1 if not limited
+	offset int
+	// transaction bound to the shard of the first statement
+	inTx    bool
+	tx      *session.Session
+	txShard int
+}
+
+// shardPred is a predicate of WHERE, which restricts shards if it restricts the key
+type shardPred struct {
+	desc string
+	args []any
+	or   bool
+}
+
+func (s *ShardSession) WithContext(ctx context.Context) *ShardSession {
+	s.ctx = ctx
+	return s
+}
+
+func (s *ShardSession) Model(value any) *ShardSession {
+	s.model = value
+	return s
+}
+
+// Where appends a predicate joined by AND, eg. Where("UserID = ?", 1)
+func (s *ShardSession) Where(desc string, args ...any) *ShardSession {
+	s.preds = append(s.preds, shardPred{desc: desc, args: args})
+	s.ops = append(s.ops, func(ss *session.Session) { ss.Where(desc, args...) })
+	return s
+}
+
+// Or appends a predicate joined by OR
+func (s *ShardSession) Or(desc string, args ...any) *ShardSession {
+	s.preds = append(s.preds, shardPred{desc: desc, args: args, or: true})
+	s.ops = append(s.ops, func(ss *session.Session) { ss.Or(desc, args...) })
+	return s
+}
+
+// Not appends a negated predicate joined by AND, it doesn't restrict shards
+func (s *ShardSession) Not(desc string, args ...any) *ShardSession {
+	s.ops = append(s.ops, func(ss *session.Session) { ss.Not(desc, args...) })
+	return s
+}
+
+// In appends predicate `column IN (...)`, a single slice of values is expanded
+func (s *ShardSession) In(column string, values ...any) *ShardSession {
+	values = expandValues(values)
+	desc := column + " IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ") + ")"
+	s.preds = append(s.preds, shardPred{desc: desc, args: values})
+	s.ops = append(s.ops, func(ss *session.Session) { ss.In(column, values...) })
+	return s
+}
+
+func (s *ShardSession) Select(columns ...string) *ShardSession {
+	s.ops = append(s.ops, func(ss *session.Session) { ss.Select(columns...) })
+	return s
+}
+
+func (s *ShardSession) Unscoped() *ShardSession {
+	s.ops = append(s.ops, func(ss *session.Session) { ss.Unscoped() })
+	return s
+}
+
+func (s *ShardSession) AllowGlobal() *ShardSession {
+	s.ops = append(s.ops, func(ss *session.Session) { ss.AllowGlobal() })
+	return s
+}
+
+// OrderBy appends an order, eg. OrderBy("Age DESC"), reads fanned out are merged
+// by columns of orders
+func (s *ShardSession) OrderBy(desc string) *ShardSession {
+	s.orders = append(s.orders, desc)
+	s.ops = append(s.ops, func(ss *session.Session) { ss.OrderBy(desc) })
+	return s
+}
+
+func (s *ShardSession) Limit(num int) *ShardSession {
+	s.limit = num
+	return s
+}
+
+func (s *ShardSession) Offset(num int) *ShardSession {
+	s.offset = num
+	return s
+}
+
+func (s *ShardSession) clear() {
+	s.model = nil
+	s.ops = nil
+	s.preds = nil
+	s.orders = nil
+	s.limit = -1
+	s.offset = 0
+}
+
+// Insert inserts values into shards of their keys, values of several shards aren't inserted atomically
+func (s *ShardSession) Insert(values ...any) (int64, error) {
+	defer s.clear()
+	if len(values) == 0 {
+		return 0, nil
+	}
+
+	table, err := s.schema(values[0])
+	if err != nil {
+		return 0, err
+	}
+	groups := map[int][]any{}
+	if rule := s.engine.rule(table); rule == nil {
+		groups[0] = values
+	} else {
+		for _, value := range values {
+			key := reflect.Indirect(reflect.ValueOf(value)).FieldByIndex(rule.key.Index)
+			if key.IsZero() {
+				return 0, fmt.Errorf("insert %s: %w %s", table.Name, ErrZeroShardKey, rule.key.Name)
+			}
+			i, err := rule.shard(key.Interface(), len(s.engine.shards))
+			if err != nil {
+				return 0, err
+			}
+			groups[i] = append(groups[i], value)
+		}
+	}
+
+	shards := make(shardSet, len(groups))
+	for i := range groups {
+		shards[i] = true
+	}
+	return s.fanOut(shards, func(i int, ss *session.Session) (int64, error) {
+		return ss.Insert(groups[i]...)
+	})
+}
+
+// Find queries records of shards into a pointer of slice, eg. Find(&users)
+func (s *ShardSession) Find(values any) error {
+	defer s.clear()
+	destSlice := reflect.Indirect(reflect.ValueOf(values))
+	if destSlice.Kind() != reflect.Slice || !destSlice.CanSet() {
+		return fmt.Errorf("find into %T: must be a pointer of slice", values)
+	}
+	elemType := destSlice.Type().Elem()
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	table, err := s.schema(reflect.New(elemType).Interface())
+	if err != nil {
+		return err
+	}
+	shards, err := s.shards(table, nil)
+	if err != nil {
+		return err
+	}
+
+	list := shards.list(len(s.engine.shards))
+	if len(list) == 1 {
+		ss, err := s.session(list[0])
+		if err != nil {
+			return err
+		}
+		return s.page(ss, s.limit, s.offset).Find(values)
+	}
+
+	less, err := s.less(table)
+	if err != nil {
+		return err
+	}
+	// every shard returns rows up to the end of page, which are merged before paging
+	limit := -1
+	if s.limit >= 0 {
+		limit = s.offset + s.limit
+	}
+	parts := make([]reflect.Value, len(s.engine.shards))
+	_, err = s.fanOut(shards, func(i int, ss *session.Session) (int64, error) {
+		part := reflect.New(destSlice.Type())
+		if err := s.page(ss, limit, 0).Find(part.Interface()); err != nil {
+			return 0, err
+		}
+		parts[i] = part.Elem()
+		return 0, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	merged := reflect.MakeSlice(destSlice.Type(), 0, 0)
+	for _, i := range list {
+		merged = reflect.AppendSlice(merged, parts[i])
+	}
+	if less != nil {
+		sort.SliceStable(merged.Interface(), func(i, j int) bool {
+			return less(reflect.Indirect(merged.Index(i)), reflect.Indirect(merged.Index(j)))
+		})
+	}
+	start, end := s.offset, merged.Len()
+	if start > end {
+		start = end
+	}
+	if s.limit >= 0 && start+s.limit < end {
+		end = start + s.limit
+	}
+	destSlice.Set(merged.Slice(start, end))
+	return nil
+}
+
+// First queries the first record of shards into a pointer of struct
+func (s *ShardSession) First(value any) error {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		s.clear()
+		return fmt.Errorf("first into %T: must be a non-nil pointer", value)
+	}
+	dest := v.Elem()
+	destSlice := reflect.New(reflect.SliceOf(dest.Type()))
+	if err := s.Limit(1).Find(destSlice.Interface()); err != nil {
+		return err
+	}
+	if destSlice.Elem().Len() == 0 {
+		return session.ErrRecordNotFound
+	}
+	dest.Set(destSlice.Elem().Index(0))
+	return nil
+}
+
+// Count counts records of model in shards
+func (s *ShardSession) Count() (int64, error) {
+	defer s.clear()
+	table, err := s.schema(s.model)
+	if err != nil {
+		return 0, err
+	}
+	shards, err := s.shards(table, nil)
+	if err != nil {
+		return 0, err
+	}
+	return s.fanOut(shards, func(_ int, ss *session.Session) (int64, error) {
+		return ss.Count()
+	})
+}
+
+// Update updates records of shards like session.Update, a struct with non-zero key
+// updates its own shard if the key isn't restricted by predicates. Updates of several shards
+// aren't atomic.
+func (s *ShardSession) Update(value any) (int64, error) {
+	defer s.clear()
+	model := s.model
+	_, isMap := value.(map[string]any)
+	if !isMap {
+		model = value
+	}
+	table, err := s.schema(model)
+	if err != nil {
+		return 0, err
+	}
+
+	var keyed shardSet
+	if rule := s.engine.rule(table); rule != nil && !isMap {
+		if key := reflect.Indirect(reflect.ValueOf(value)).FieldByIndex(rule.key.Index); !key.IsZero() {
+			i, err := rule.shard(key.Interface(), len(s.engine.shards))
+			if err != nil {
+				return 0, err
+			}
+			keyed = shardSet{i: true}
+		}
+	}
+	shards, err := s.shards(table, keyed)
+	if err != nil {
+		return 0, err
+	}
+	return s.fanOut(shards, func(_ int, ss *session.Session) (int64, error) {
+		return ss.Update(value)
+	})
+}
+
+// Delete deletes records of model in shards, deletes of several shards aren't atomic
+func (s *ShardSession) Delete() (int64, error) {
+	defer s.clear()
+	table, err := s.schema(s.model)
+	if err != nil {
+		return 0, err
+	}
+	shards, err := s.shards(table, nil)
+	if err != nil {
+		return 0, err
+	}
+	return s.fanOut(shards, func(_ int, ss *session.Session) (int64, error) {
+		return ss.Delete()
+	})
+}
+
+// schema parses model, nil if model isn't set
+func (s *ShardSession) schema(model any) (*schema.Schema, error) {
+	if model == nil {
+		return nil, nil
+	}
+	return schema.Parse(model, s.engine.shards[0].Dialect())
+}
+
+// session returns the session of shard i with builder calls replayed,
+// which is the transaction if any
+func (s *ShardSession) session(i int) (*session.Session, error) {
+	ss := s.tx
+	if ss != nil && s.txShard != i {
+		return nil, fmt.Errorf("%w: shard %d in transaction of shard %d", ErrCrossShard, i, s.txShard)
+	}
+	if ss == nil {
+		ss = s.engine.shards[i].NewSession()
+		if s.ctx != nil {
+			ss.WithContext(s.ctx)
+		}
+		if s.inTx {
+			if err := ss.Begin(); err != nil {
+				return nil, err
+			}
+			s.tx, s.txShard = ss, i
+		}
+	}
+	if s.model != nil {
+		ss.Model(s.model)
+	}
+	for _, op := range s.ops {
+		op(ss)
+	}
+	return ss, nil
+}
+
+func (s *ShardSession) page(ss *session.Session, limit, offset int) *session.Session {
+	if limit >= 0 {
+		ss.Limit(limit)
+	}
+	if offset > 0 {
+		ss.Offset(offset)
+	}
+	return ss
+}
+
+// fanOut runs f with sessions of shards concurrently, and sums the results
+func (s *ShardSession) fanOut(shards shardSet, f func(i int, ss *session.Session) (int64, error)) (int64, error) {
+	list := shards.list(len(s.engine.shards))
+	if s.inTx && len(list) > 1 {
+		return 0, fmt.Errorf("%w: shards %v in one transaction", ErrCrossShard, list)
+	}
+	sessions := make([]*session.Session, len(list))
+	for j, i := range list {
+		ss, err := s.session(i)
+		if err != nil {
+			return 0, err
+		}
+		sessions[j] = ss
+	}
+	if len(list) == 1 {
+		return f(list[0], sessions[0])
+	}
+
+	var (
+		wg    sync.WaitGroup
+		sums  = make([]int64, len(list))
+		errs  = make([]error, len(list))
+		total int64
+	)
+	for j, i := range list {
+		wg.Add(1)
+		go func(j, i int) {
+			defer wg.Done()
+			sums[j], errs[j] = f(i, sessions[j])
+		}(j, i)
+	}
+	wg.Wait()
+	for j, err := range errs {
+		if err != nil {
+			return 0, fmt.Errorf("shard %d: %w", list[j], err)
+		}
+		total += sums[j]
+	}
+	return total, nil
+}
+
+var keyPredRe = regexp.MustCompile(`(?i)^\s*(?:[` + "`" + `"]?\w+[` + "`" + `"]?\.)?[` + "`" + `"]?(\w+)[` + "`" + `"]?\s*(?:=\s*\?|IN\s*\(\s*\?(?:\s*,\s*\?)*\s*\))\s*$`)
+
+// shards returns shards targeted by predicates, keyed restricts shards if the key isn't restricted.
+// Predicates are grouped from left to right like session, eg. ((a) OR (b)) AND (c).
+func (s *ShardSession) shards(table *schema.Schema, keyed shardSet) (shardSet, error) {
+	if table == nil {
+		return nil, session.ErrModelNotSet
+	}
+	rule := s.engine.rule(table)
+	if rule == nil {
+		return shardSet{0: true}, nil
+	}
+
+	var shards shardSet
+	for i, pred := range s.preds {
+		set, err := s.predShards(rule, pred)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case i == 0:
+			shards = set
+		case pred.or:
+			shards = shards.union(set)
+		default:
+			shards = shards.intersect(set)
+		}
+	}
+	if shards == nil {
+		return keyed, nil
+	}
+	return shards, nil
+}
+
+// predShards returns shards of the key restricted by pred, nil if pred doesn't restrict the key
+func (s *ShardSession) predShards(rule *shardRule, pred shardPred) (shardSet, error) {
+	m := keyPredRe.FindStringSubmatch(pred.desc)
+	if m == nil || !(strings.EqualFold(m[1], rule.key.Name) || strings.EqualFold(m[1], rule.key.FieldName)) {
+		return nil, nil
+	}
+	keys := pred.args
+	if strings.Count(pred.desc, "?") == 1 {
+		keys = expandValues(keys)
+	}
+	set := shardSet{}
+	for _, key := range keys {
+		i, err := rule.shard(key, len(s.engine.shards))
+		if err != nil {
+			return nil, err
+		}
+		set[i] = true
+	}
+	return set, nil
+}
+
+var orderDirRe = regexp.MustCompile(`(?i)\s+(ASC|DESC)$`)
+
+// less returns the order of records by orders, nil if no order
+func (s *ShardSession) less(table *schema.Schema) (func(a, b reflect.Value) bool, error) {
+	type key struct {
+		field *schema.Field
+		desc  bool
+	}
+	var keys []key
+	for _, order := range s.orders {
+		for _, term := range strings.Split(order, ",") {
+			term = strings.TrimSpace(term)
+			desc := false
+			if m := orderDirRe.FindStringSubmatch(term); m != nil {
+				desc = strings.EqualFold(m[1], "DESC")
+				term = strings.TrimSpace(term[:len(term)-len(m[0])])
+			}
+			name := term[strings.LastIndex(term, ".")+1:]
+			field := table.FieldByName(strings.Trim(name, "`\""))
+			if field == nil {
+				return nil, fmt.Errorf("order %q can't be merged across shards: not a column of %s", term, table.Name)
+			}
+			keys = append(keys, key{field: field, desc: desc})
+		}
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	return func(a, b reflect.Value) bool {
+		for _, k := range keys {
+			x, y := a.FieldByIndex(k.field.Index), b.FieldByIndex(k.field.Index)
+			c := compareNullable(x, y)
+			if k.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	}, nil
+}
+
+// compareNullable compares values, nil pointers are less than others like NULL
+func compareNullable(x, y reflect.Value) int {
+	if x.Kind() == reflect.Ptr || y.Kind() == reflect.Ptr {
+		switch {
+		case x.IsNil() && y.IsNil():
+			return 0
+		case x.IsNil():
+			return -1
+		case y.IsNil():
+			return 1
+		}
+		x, y = x.Elem(), y.Elem()
+	}
+	c, _ := compareValues(x, y)
+	return c
+}
+
+// expandValues expands a single slice of values
+func expandValues(values []any) []any {
+	if len(values) != 1 {
+		return values
+	}
+	v := reflect.ValueOf(values[0])
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return values
+	}
+	expanded := make([]any, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		expanded = append(expanded, v.Index(i).Interface())
+	}
+	return expanded
+}
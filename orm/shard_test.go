@@ -0,0 +1,195 @@
+package orm
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type Order struct {
+	ID     int
+	UserID int
+	Amount int
+}
+
+// newTestShardedEngine returns 3 shards of orders, which are ranged by UserID at 10 and 20
+func newTestShardedEngine(t *testing.T) *ShardedEngine {
+	t.Helper()
+	shards := []*Engine{newTestEngine(t), newTestEngine(t), newTestEngine(t)}
+	e, err := NewShardedEngine(shards, ShardRule{Model: &Order{}, Key: "UserID", Sharder: RangeSharder{Bounds: []any{10, 20}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = e.AutoMigrate(&Order{}); err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func shardCounts(t *testing.T, e *ShardedEngine) []int64 {
+	t.Helper()
+	var counts []int64
+	for _, shard := range e.Shards() {
+		n, err := shard.NewSession().Model(&Order{}).Count()
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts = append(counts, n)
+	}
+	return counts
+}
+
+func userIDs(orders []Order) []int {
+	ids := make([]int, 0, len(orders))
+	for _, order := range orders {
+		ids = append(ids, order.UserID)
+	}
+	return ids
+}
+
+func TestShardedEngineAutoIncrementKey(t *testing.T) {
+	if _, err := NewShardedEngine([]*Engine{newTestEngine(t)}, ShardRule{Model: &Order{}, Key: "ID"}); err == nil {
+		t.Fatal("sharding by an auto increment key succeeded")
+	}
+}
+
+func TestShardInsertZeroKey(t *testing.T) {
+	e := newTestShardedEngine(t)
+	if _, err := e.NewSession().Insert(&Order{UserID: 1}, &Order{Amount: 10}); !errors.Is(err, ErrZeroShardKey) {
+		t.Fatalf("insert without key err = %v, want ErrZeroShardKey", err)
+	}
+	if counts := shardCounts(t, e); !reflect.DeepEqual(counts, []int64{0, 0, 0}) {
+		t.Fatalf("shard counts = %v, want nothing inserted", counts)
+	}
+}
+
+func TestShardRouting(t *testing.T) {
+	e := newTestShardedEngine(t)
+	s := e.NewSession()
+	n, err := s.Insert(&Order{UserID: 1, Amount: 10}, &Order{UserID: 15, Amount: 20}, &Order{UserID: 25, Amount: 30},
+		&Order{UserID: 5, Amount: 40})
+	if err != nil || n != 4 {
+		t.Fatalf("insert = %d, %v", n, err)
+	}
+	if counts := shardCounts(t, e); !reflect.DeepEqual(counts, []int64{2, 1, 1}) {
+		t.Fatalf("shard counts = %v, want [2 1 1]", counts)
+	}
+
+	var orders []Order
+	if err = s.Where("UserID = ?", 15).Find(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if ids := userIDs(orders); !reflect.DeepEqual(ids, []int{15}) {
+		t.Fatalf("orders of user 15 = %v", ids)
+	}
+
+	orders = nil
+	if err = s.Where("UserID IN (?, ?)", 1, 25).OrderBy("UserID").Find(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if ids := userIDs(orders); !reflect.DeepEqual(ids, []int{1, 25}) {
+		t.Fatalf("orders of users 1 and 25 = %v", ids)
+	}
+
+	orders = nil
+	if err = s.In("UserID", []int{5, 15}).OrderBy("UserID").Find(&orders); err != nil {
+		t.Fatal(err)
+	}
+	if ids := userIDs(orders); !reflect.DeepEqual(ids, []int{5, 15}) {
+		t.Fatalf("orders of users 5 and 15 = %v", ids)
+	}
+
+	if n, err = s.Model(&Order{}).Where("UserID = ?", 5).Update(map[string]any{"Amount": 50}); err != nil || n != 1 {
+		t.Fatalf("update = %d, %v", n, err)
+	}
+	if n, err = s.Model(&Order{}).Where("UserID = ?", 25).Delete(); err != nil || n != 1 {
+		t.Fatalf("delete = %d, %v", n, err)
+	}
+	if counts := shardCounts(t, e); !reflect.DeepEqual(counts, []int64{2, 1, 0}) {
+		t.Fatalf("shard counts = %v, want [2 1 0]", counts)
+	}
+}
+
+func TestShardFanOutMerge(t *testing.T) {
+	e := newTestShardedEngine(t)
+	s := e.NewSession()
+	var values []any
+	for userID := 1; userID < 30; userID++ {
+		values = append(values, &Order{UserID: userID, Amount: userID % 7})
+	}
+	if _, err := s.Insert(values...); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Model(&Order{}).Count(); err != nil || n != 29 {
+		t.Fatalf("count = %d, %v, want 29", n, err)
+	}
+
+	var orders []Order
+	if err := s.Where("Amount >= ?", 5).OrderBy("Amount DESC, UserID").Offset(2).Limit(5).Find(&orders); err != nil {
+		t.Fatal(err)
+	}
+	// amount 6: users 6, 13, 20, 27, amount 5: users 5, 12, 19, 26
+	if ids := userIDs(orders); !reflect.DeepEqual(ids, []int{20, 27, 5, 12, 19}) {
+		t.Fatalf("merged page = %v", ids)
+	}
+
+	orders = nil
+	if err := s.OrderBy("Amount + 1").Find(&orders); err == nil {
+		t.Fatal("fan-out ordered by an expression succeeded")
+	}
+}
+
+func TestShardTransactionCrossShard(t *testing.T) {
+	e := newTestShardedEngine(t)
+	err := e.Transaction(func(s *ShardSession) error {
+		if _, err := s.Insert(&Order{UserID: 1, Amount: 10}); err != nil {
+			return err
+		}
+		_, err := s.Insert(&Order{UserID: 25, Amount: 30})
+		return err
+	})
+	if !errors.Is(err, ErrCrossShard) {
+		t.Fatalf("transaction err = %v, want ErrCrossShard", err)
+	}
+	if counts := shardCounts(t, e); !reflect.DeepEqual(counts, []int64{0, 0, 0}) {
+		t.Fatalf("shard counts = %v, want the transaction rolled back", counts)
+	}
+
+	err = e.Transaction(func(s *ShardSession) error {
+		_, err := s.Insert(&Order{UserID: 1, Amount: 10}, &Order{UserID: 2, Amount: 20})
+		if err != nil {
+			return err
+		}
+		var orders []Order
+		return s.Where("UserID = ?", 2).Find(&orders)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts := shardCounts(t, e); !reflect.DeepEqual(counts, []int64{2, 0, 0}) {
+		t.Fatalf("shard counts = %v, want [2 0 0]", counts)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		x, y any
+		want int
+	}{
+		{int64(1<<53 + 1), int64(1 << 53), 1},
+		{int64(-1 << 60), int64(-1<<60 + 1), -1},
+		{uint64(1<<63 + 1), uint64(1 << 63), 1},
+		{-1, uint64(1 << 63), -1},
+		{uint64(1<<53 + 1), int64(1<<53 + 1), 0},
+		{uint64(1<<53 + 1), int64(1 << 53), 1},
+		{int8(3), uint16(2), 1},
+		{1.5, 2, -1},
+		{"a", "b", -1},
+	}
+	for _, test := range tests {
+		c, ok := compareValues(reflect.ValueOf(test.x), reflect.ValueOf(test.y))
+		if !ok || c != test.want {
+			t.Errorf("compare %T(%v) and %T(%v) = %d, %v, want %d", test.x, test.x, test.y, test.y, c, ok, test.want)
+		}
+	}
+}
@@ -1,13 +1,15 @@
 package rpc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"strings"
 	"sync"
+	"time"
 
-	jsoniter "github.com/json-iterator/go"
 	"github.com/pedrogao/log"
 	"github.com/pedrogao/rpc/codec"
 )
@@ -50,6 +52,9 @@ func (c *Client) Close() error {
 	}
 
 	c.closing = true
+	if c.shutdown {
+		return nil // closed by receive
+	}
 	return c.cc.Close()
 }
 
@@ -115,13 +120,16 @@ func (c *Client) receive() {
 			err = c.cc.ReadBody(nil)
 			call.done()
 		default:
-			if err = c.cc.ReadBody(&call.Reply); err != nil {
-				call.Error = fmt.Errorf("read body err: %s", err)
+			// the body is read in whole with its frame, so the connection is still in sync
+			if bodyErr := c.cc.ReadBody(call.Reply); bodyErr != nil {
+				call.Error = fmt.Errorf("read body err: %s", bodyErr)
 			}
 			call.done()
 		}
 	}
 	c.terminateCalls(err)
+	// the connection is out of sync or closed by server
+	_ = c.cc.Close()
 }
 
 func (c *Client) send(call *Call) {
@@ -142,7 +150,7 @@ func (c *Client) send(call *Call) {
 	c.header.Seq = seq
 	c.header.Error = ""
 
-	if err = c.cc.Write(&c.header, &call.Args); err != nil {
+	if err = c.cc.Write(&c.header, call.Args); err != nil {
 		log.Errorf("write call body err: %s", err)
 
 		call = c.removeCall(seq)
@@ -171,25 +179,67 @@ func (c *Client) Go(serviceMethod string, args, reply any, done chan *Call) *Cal
 }
 
 func (c *Client) Call(serviceMethod string, args, reply any) error {
-	call := <-c.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
+	return c.CallContext(context.Background(), serviceMethod, args, reply)
+}
 
-	return call.Error
+// CallContext calls like Call, the call is removed from pending calls once ctx is done,
+// and its reply is discarded
+func (c *Client) CallContext(ctx context.Context, serviceMethod string, args, reply any) error {
+	call := c.Go(serviceMethod, args, reply, make(chan *Call, 1))
+	select {
+	case <-ctx.Done():
+		c.removeCall(call.Seq)
+		return fmt.Errorf("rpc client: call failed: %w", ctx.Err())
+	case call = <-call.Done:
+		return call.Error
+	}
 }
 
+// NewClient negotiates the codec of conn by offering codecs of opt, the server replies
+// the codec picked from offers
 func NewClient(conn net.Conn, opt *Option) (*Client, error) {
-	f := codec.NewCodecFuncMap[opt.CodeType]
-	if f == nil {
-		log.Errorf("invalid code type: %s", opt.CodeType)
-		return nil, fmt.Errorf("invalid code type: %s", opt.CodeType)
+	for _, t := range opt.offers() {
+		if codec.NewCodecFuncMap[t] == nil {
+			log.Errorf("invalid code type: %s", t)
+			_ = conn.Close()
+			return nil, fmt.Errorf("invalid code type: %s", t)
+		}
 	}
 
-	if err := jsoniter.NewEncoder(conn).Encode(opt); err != nil {
+	if err := WriteOption(conn, opt); err != nil {
 		log.Errorf("encode option err: %s", err)
 		_ = conn.Close()
 		return nil, err
 	}
 
-	return newClientCodec(f(conn), opt), nil
+	reply, err := ReadOption(conn)
+	if err != nil {
+		log.Errorf("decode option err: %s", err)
+		_ = conn.Close()
+		return nil, fmt.Errorf("decode option err: %w", err)
+	}
+	if !accepted(opt.offers(), reply.CodeType) {
+		_ = conn.Close()
+		return nil, fmt.Errorf("server accepts none of code types: %v", opt.offers())
+	}
+
+	negotiated := *opt
+	negotiated.CodeType = reply.CodeType
+	return newClientCodec(codec.NewCodecFuncMap[reply.CodeType](conn), &negotiated), nil
+}
+
+func accepted(offers []codec.Type, t codec.Type) bool {
+	for _, offer := range offers {
+		if offer == t && t != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeType returns the codec negotiated with server
+func (c *Client) CodeType() codec.Type {
+	return c.opt.CodeType
 }
 
 func newClientCodec(cc codec.Codec, opt *Option) *Client {
@@ -227,10 +277,43 @@ func Dial(network, address string, opts ...*Option) (*Client, error) {
 		return nil, err
 	}
 
-	conn, err := net.Dial(network, address)
+	start := time.Now()
+	conn, err := net.DialTimeout(network, address, opt.ConnectTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("dial net err: %s", err)
 	}
 
-	return NewClient(conn, opt)
+	type result struct {
+		client *Client
+		err    error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		client, err := NewClient(conn, opt)
+		ch <- result{client: client, err: err}
+	}()
+	if opt.ConnectTimeout <= 0 {
+		r := <-ch
+		return r.client, r.err
+	}
+
+	// the handshake is limited by the rest of ConnectTimeout
+	timer := time.NewTimer(time.Until(start.Add(opt.ConnectTimeout)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		_ = conn.Close() // unblocks the handshake
+		return nil, fmt.Errorf("rpc client: connect timeout: expect within %s", opt.ConnectTimeout)
+	case r := <-ch:
+		return r.client, r.err
+	}
+}
+
+// XDial dials rpcAddr of format protocol@addr, eg. "tcp@127.0.0.1:9999" or "unix@/tmp/rpc.sock"
+func XDial(rpcAddr string, opts ...*Option) (*Client, error) {
+	parts := strings.SplitN(rpcAddr, "@", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("rpc client err: wrong format '%s', expect protocol@addr", rpcAddr)
+	}
+	return Dial(parts[0], parts[1], opts...)
 }
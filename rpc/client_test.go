@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/rpc/codec"
+	"github.com/pedrogao/rpc/internal/rpctest"
+)
+
+func TestDialConnectTimeout(t *testing.T) {
+	// the listener accepts connections but never replies the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	start := time.Now()
+	_, err = Dial("tcp", l.Addr().String(), &Option{ConnectTimeout: 100 * time.Millisecond})
+	if err == nil || !strings.Contains(err.Error(), "connect timeout") {
+		t.Fatalf("dial err = %v, want connect timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("dial returned after %s", elapsed)
+	}
+}
+
+func TestCallContextCancel(t *testing.T) {
+	addr := startServer(t)
+	client, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var reply int
+	err = client.CallContext(ctx, "Foo.Sleep", 200*time.Millisecond, &reply)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call err = %v, want context.DeadlineExceeded", err)
+	}
+	client.mu.Lock()
+	pending := len(client.pending)
+	client.mu.Unlock()
+	if pending != 0 {
+		t.Fatalf("%d pending calls after cancellation, want 0", pending)
+	}
+
+	// the late reply is discarded, and the client is still usable
+	time.Sleep(200 * time.Millisecond)
+	if reply != 0 {
+		t.Fatalf("reply of the canceled call = %d, want discarded", reply)
+	}
+	if err = client.Call("Foo.Sum", rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("call after cancellation = %d, %v", reply, err)
+	}
+}
+
+// startJsonServer replies the handshake like a server supporting JSON only, and closes the connection
+func startJsonServer(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			opt, err := ReadOption(conn)
+			if err == nil {
+				reply := &Option{MagicNumber: MagicNumber}
+				if accepted(opt.offers(), codec.JsonType) {
+					reply.CodeType = codec.JsonType
+				}
+				_ = WriteOption(conn, reply)
+			}
+			_ = conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestNegotiate(t *testing.T) {
+	addr := startServer(t)
+	tests := []struct {
+		offers []codec.Type
+		want   codec.Type
+	}{
+		{[]codec.Type{codec.GobType, codec.MsgpackType}, codec.GobType},
+		{[]codec.Type{codec.MsgpackType, codec.GobType}, codec.MsgpackType},
+		{nil, codec.JsonType},
+	}
+	for _, test := range tests {
+		client, err := Dial("tcp", addr, &Option{CodecTypes: test.offers})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := client.CodeType(); got != test.want {
+			t.Errorf("codec negotiated of offers %v = %s, want %s", test.offers, got, test.want)
+		}
+		// a round trip through the codec negotiated
+		var reply int
+		if err = client.Call("Foo.SumPtr", &rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+			t.Errorf("call by %s = %d, %v", test.want, reply, err)
+		}
+		_ = client.Close()
+	}
+
+	addr = startJsonServer(t)
+	client, err := Dial("tcp", addr, &Option{CodecTypes: []codec.Type{codec.GobType, codec.JsonType}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := client.CodeType(); got != codec.JsonType {
+		t.Fatalf("codec picked by server = %s, want %s", got, codec.JsonType)
+	}
+	_ = client.Close()
+	_, err = Dial("tcp", addr, &Option{CodecTypes: []codec.Type{codec.GobType, codec.MsgpackType}})
+	if err == nil || !strings.Contains(err.Error(), "accepts none") {
+		t.Fatalf("dial of unsupported codecs err = %v, want accepts none", err)
+	}
+}
+
+func TestServerRejectsCodecs(t *testing.T) {
+	conn, err := net.Dial("tcp", startServer(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err = WriteOption(conn, &Option{MagicNumber: MagicNumber, CodecTypes: []codec.Type{"application/unknown"}}); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := ReadOption(conn)
+	if err != nil || reply.CodeType != "" {
+		t.Fatalf("reply of unknown codecs = %+v, %v, want no codec", reply, err)
+	}
+	if _, err = conn.Read(make([]byte, 1)); err == nil {
+		t.Fatal("server doesn't close the connection of unknown codecs")
+	}
+}
@@ -1,17 +1,29 @@
 package main
 
 import (
-	"fmt"
 	"net"
 	"time"
 
-	jsoniter "github.com/json-iterator/go"
 	"github.com/pedrogao/log"
 	"github.com/pedrogao/rpc"
 	"github.com/pedrogao/rpc/codec"
 )
 
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
 func startServer(addr chan string) {
+	var foo Foo
+	if err := rpc.Register(&foo); err != nil {
+		log.Fatalf("register err: %s", err)
+	}
+
 	l, err := net.Listen("tcp", "127.0.0.1:")
 	if err != nil {
 		log.Fatalf("network err: %s", err)
@@ -33,7 +45,9 @@ func main() {
 
 	time.Sleep(time.Second)
 	// write option
-	_ = jsoniter.NewEncoder(conn).Encode(rpc.DefaultOption)
+	_ = rpc.WriteOption(conn, rpc.DefaultOption)
+	// read the option replied
+	_, _ = rpc.ReadOption(conn)
 	// write data
 	cc := codec.NewJsonCodec(conn)
 	for i := 0; i < 5; i++ {
@@ -41,11 +55,11 @@ func main() {
 			ServiceMethod: "Foo.Sum",
 			Seq:           uint64(i),
 		}
-		_ = cc.Write(h, fmt.Sprintf("req: %d", h.Seq))
+		_ = cc.Write(h, &Args{Num1: i, Num2: i * i})
 
 		_ = cc.ReadeHeader(h)
-		var reply string
+		var reply int
 		_ = cc.ReadBody(&reply)
-		log.Infof("reply: %s", reply)
+		log.Infof("reply: %d", reply)
 	}
 }
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"net"
 	"sync"
 	"time"
@@ -10,7 +9,21 @@ import (
 	"github.com/pedrogao/rpc"
 )
 
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
 func startServer(addr chan string) {
+	var foo Foo
+	if err := rpc.Register(&foo); err != nil {
+		log.Fatalf("register err: %s", err)
+	}
+
 	l, err := net.Listen("tcp", "127.0.0.1:")
 	if err != nil {
 		log.Fatalf("network err: %s", err)
@@ -41,12 +54,12 @@ func main() {
 		go func(i int) {
 			defer wg.Done()
 
-			args := fmt.Sprintf("rpc req: %d", i)
-			var reply string
-			if err = client.Call("Foo.Sum", args, &reply); err != nil {
+			args := &Args{Num1: i, Num2: i * i}
+			var reply int
+			if err := client.Call("Foo.Sum", args, &reply); err != nil {
 				log.Errorf("call Foo.Sum err: %s", err)
 			} else {
-				log.Infof("req: %s, reply: %s", args, reply)
+				log.Infof("%d + %d = %d", args.Num1, args.Num2, reply)
 			}
 		}(i)
 	}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/rpc"
+)
+
+// Slow sleeps before replying
+type Slow int
+
+func (s Slow) Sleep(d time.Duration, reply *string) error {
+	time.Sleep(d)
+	*reply = "woke up after " + d.String()
+	return nil
+}
+
+func startServer(addr chan string) {
+	var slow Slow
+	if err := rpc.Register(&slow); err != nil {
+		log.Fatalf("register err: %s", err)
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		log.Fatalf("network err: %s", err)
+	}
+
+	log.Infof("start rpc server on: %s", l.Addr())
+	addr <- l.Addr().String()
+	rpc.Accept(l)
+}
+
+// startSilentServer accepts connections without handshake
+func startSilentServer(addr chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		log.Fatalf("network err: %s", err)
+	}
+
+	addr <- l.Addr().String()
+	var conns []net.Conn
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conns = append(conns, conn)
+	}
+}
+
+func main() {
+	addr := make(chan string)
+	go startServer(addr)
+	serverAddr := <-addr
+	go startSilentServer(addr)
+	silentAddr := <-addr
+
+	// connect timeout of handshake
+	_, err := rpc.Dial("tcp", silentAddr, &rpc.Option{ConnectTimeout: 500 * time.Millisecond})
+	log.Infof("dial silent server: %v", err)
+
+	client, err := rpc.Dial("tcp", serverAddr)
+	if err != nil {
+		log.Fatalf("rpc dial err: %s", err)
+	}
+	defer client.Close()
+
+	// call timeout of client
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var reply string
+	err = client.CallContext(ctx, "Slow.Sleep", time.Second, &reply)
+	log.Infof("call with context: %v", err)
+
+	// handle timeout of server
+	timed, err := rpc.Dial("tcp", serverAddr, &rpc.Option{HandleTimeout: 500 * time.Millisecond})
+	if err != nil {
+		log.Fatalf("rpc dial err: %s", err)
+	}
+	defer timed.Close()
+	err = timed.Call("Slow.Sleep", time.Second, &reply)
+	log.Infof("call with handle timeout: %v", err)
+
+	// the client is still available after timeouts
+	err = timed.Call("Slow.Sleep", 100*time.Millisecond, &reply)
+	log.Infof("call in time: %q, %v", reply, err)
+	err = client.Call("Slow.Sleep", 100*time.Millisecond, &reply)
+	log.Infof("call in time: %q, %v", reply, err)
+}
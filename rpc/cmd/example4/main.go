@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/rpc"
+	"github.com/pedrogao/rpc/registry"
+	"github.com/pedrogao/rpc/xclient"
+)
+
+type Foo struct {
+	Addr string
+}
+
+type Args struct{ Num1, Num2 int }
+
+type Reply struct {
+	Sum  int
+	Addr string // server replied
+}
+
+func (f *Foo) Sum(args Args, reply *Reply) error {
+	reply.Sum = args.Num1 + args.Num2
+	reply.Addr = f.Addr
+	return nil
+}
+
+func startRegistry(addr chan string) {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		log.Fatalf("network err: %s", err)
+	}
+
+	// expire servers without heartbeat in a second
+	registry.New(time.Second).HandleHTTP(registry.DefaultPath)
+	addr <- "http://" + l.Addr().String() + registry.DefaultPath
+	_ = http.Serve(l, nil)
+}
+
+// startServer starts a server sending heartbeats to registryAddr, and returns the stop of heartbeats
+func startServer(registryAddr string) func() {
+	l, err := net.Listen("tcp", "127.0.0.1:")
+	if err != nil {
+		log.Fatalf("network err: %s", err)
+	}
+
+	rpcAddr := "tcp@" + l.Addr().String()
+	server := rpc.NewServer()
+	if err = server.Register(&Foo{Addr: rpcAddr}); err != nil {
+		log.Fatalf("register err: %s", err)
+	}
+	stop, err := registry.Heartbeat(registryAddr, rpcAddr, 300*time.Millisecond)
+	if err != nil {
+		log.Fatalf("heartbeat err: %s", err)
+	}
+
+	log.Infof("start rpc server on: %s", rpcAddr)
+	go server.Accept(l)
+	return stop
+}
+
+func call(xc *xclient.XClient, mode string, n int) {
+	for i := 0; i < n; i++ {
+		var reply Reply
+		if err := xc.Call(context.Background(), "Foo.Sum", &Args{Num1: i % 2, Num2: 1}, &reply); err != nil {
+			log.Errorf("%s: call Foo.Sum err: %s", mode, err)
+			continue
+		}
+		log.Infof("%s: %d + %d = %d by %s", mode, i%2, 1, reply.Sum, reply.Addr)
+	}
+}
+
+func main() {
+	addr := make(chan string)
+	go startRegistry(addr)
+	registryAddr := <-addr
+
+	var stops []func()
+	for i := 0; i < 3; i++ {
+		stops = append(stops, startServer(registryAddr))
+	}
+
+	d := registry.NewRegistryDiscovery(registryAddr, 100*time.Millisecond)
+	for _, mode := range []struct {
+		name string
+		mode registry.SelectMode
+	}{
+		{"random", registry.RandomSelect},
+		{"round robin", registry.RoundRobinSelect},
+		{"consistent hash", registry.ConsistentHashSelect},
+	} {
+		xc := xclient.NewXClient(d, mode.mode, nil)
+		call(xc, mode.name, 4)
+		_ = xc.Close()
+	}
+
+	xc := xclient.NewXClient(d, registry.RoundRobinSelect, nil)
+	defer xc.Close()
+	var reply Reply
+	err := xc.Broadcast(context.Background(), "Foo.Sum", &Args{Num1: 1, Num2: 2}, &reply)
+	log.Infof("broadcast: %d by %s, %v", reply.Sum, reply.Addr, err)
+
+	// the server expires once its heartbeats stop
+	stops[0]()
+	time.Sleep(1500 * time.Millisecond)
+	servers, err := d.GetAll()
+	log.Infof("servers after expiry: %v, %v", servers, err)
+	call(xc, "round robin", 4)
+}
@@ -0,0 +1,120 @@
+package codec
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pedrogao/log"
+)
+
+// Marshaler marshals bodies of BinaryCodec, eg. MessagePack or protobuf
+type Marshaler interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// BinaryCodec writes each message as a frame, whose payload is the header followed by the body.
+// The header is encoded as uvarint Seq followed by uvarint length-prefixed ServiceMethod and Error,
+// and the body is marshaled by Marshaler. A malformed body doesn't desync the connection since
+// the frame has been read in whole.
+type BinaryCodec struct {
+	conn io.ReadWriteCloser
+	r    *bufio.Reader
+	buf  *bufio.Writer
+	m    Marshaler
+	id   byte
+	body []byte // body of the frame whose header is read
+}
+
+var _ Codec = (*BinaryCodec)(nil) // must implement Codec
+
+// NewBinaryCodec returns the constructor of BinaryCodec of t marshaling bodies by m
+func NewBinaryCodec(t Type, m Marshaler) NewCodecFunc {
+	return func(conn io.ReadWriteCloser) Codec {
+		return &BinaryCodec{
+			conn: conn,
+			r:    bufio.NewReader(conn),
+			buf:  bufio.NewWriter(conn),
+			m:    m,
+			id:   t.ID(),
+		}
+	}
+}
+
+func (c *BinaryCodec) Close() error {
+	return c.conn.Close()
+}
+
+func (c *BinaryCodec) ReadeHeader(header *Header) error {
+	_, frame, err := ReadFrame(c.r, c.id, MaxFrameSize)
+	if err != nil {
+		return err
+	}
+
+	seq, n := binary.Uvarint(frame)
+	if n <= 0 {
+		return fmt.Errorf("%w: invalid header seq", ErrCorruptFrame)
+	}
+	frame = frame[n:]
+	if header.ServiceMethod, frame, err = readString(frame); err != nil {
+		return err
+	}
+	if header.Error, frame, err = readString(frame); err != nil {
+		return err
+	}
+	header.Seq = seq
+	c.body = frame
+	return nil
+}
+
+// ReadBody unmarshals the body into body, the body is discarded if body is nil
+func (c *BinaryCodec) ReadBody(body any) error {
+	frame := c.body
+	c.body = nil
+	if body == nil {
+		return nil
+	}
+	return c.m.Unmarshal(frame, body)
+}
+
+func (c *BinaryCodec) Write(header *Header, body any) (err error) {
+	defer c.buf.Flush()
+
+	b, err := c.m.Marshal(body)
+	if err != nil {
+		log.Errorf("rpc codec: binary encoding body err: %s", err)
+		return err
+	}
+
+	frame := appendUvarint(nil, header.Seq)
+	frame = appendString(frame, header.ServiceMethod)
+	frame = appendString(frame, header.Error)
+	frame = append(frame, b...)
+	if err = WriteFrame(c.buf, c.id, 0, frame); err != nil {
+		log.Errorf("rpc codec: binary encoding frame err: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (string, []byte, error) {
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < size {
+		return "", nil, fmt.Errorf("%w: invalid header string", ErrCorruptFrame)
+	}
+	return string(b[n : n+int(size)]), b[n+int(size):], nil
+}
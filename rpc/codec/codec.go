@@ -22,13 +22,16 @@ type NewCodecFunc func(io.ReadWriteCloser) Codec
 type Type string
 
 const (
-	GobType  Type = "application/gob" // not implemented
-	JsonType Type = "application/json"
+	GobType     Type = "application/gob"
+	JsonType    Type = "application/json"
+	MsgpackType Type = "application/msgpack"
 )
 
 var NewCodecFuncMap map[Type]NewCodecFunc
 
 func init() {
 	NewCodecFuncMap = make(map[Type]NewCodecFunc)
+	NewCodecFuncMap[GobType] = NewGobCodec
 	NewCodecFuncMap[JsonType] = NewJsonCodec
+	NewCodecFuncMap[MsgpackType] = NewBinaryCodec(MsgpackType, Msgpack{})
 }
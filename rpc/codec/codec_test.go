@@ -0,0 +1,70 @@
+package codec
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// bufferConn is an in-memory connection, what's written is read back
+type bufferConn struct {
+	bytes.Buffer
+}
+
+func (c *bufferConn) Close() error {
+	return nil
+}
+
+type benchItem struct {
+	ID    int64
+	Name  string
+	Tags  []string
+	Price float64
+}
+
+type benchArgs struct {
+	Items []benchItem
+}
+
+// BenchmarkCodec writes and reads back a request of each codec
+func BenchmarkCodec(b *testing.B) {
+	args := benchArgs{}
+	for i := 0; i < 20; i++ {
+		args.Items = append(args.Items, benchItem{
+			ID:    int64(i),
+			Name:  strings.Repeat("n", i),
+			Tags:  []string{"a", "b"},
+			Price: float64(i) / 4,
+		})
+	}
+
+	codecs := []struct {
+		name string
+		t    Type
+	}{
+		{"json", JsonType},
+		{"gob", GobType},
+		{"msgpack", MsgpackType},
+	}
+	for _, c := range codecs {
+		b.Run(c.name, func(b *testing.B) {
+			cc := NewCodecFuncMap[c.t](&bufferConn{})
+			header := &Header{ServiceMethod: "Store.Total"}
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				header.Seq = uint64(i)
+				if err := cc.Write(header, &args); err != nil {
+					b.Fatal(err)
+				}
+				var h Header
+				if err := cc.ReadeHeader(&h); err != nil {
+					b.Fatal(err)
+				}
+				var body benchArgs
+				if err := cc.ReadBody(&body); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
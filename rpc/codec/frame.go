@@ -0,0 +1,119 @@
+package codec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Frame layout, all integers are big endian:
+//
+//	+-------+---------+-------+-------+--------+---------+
+//	| magic | version | codec | flags | length | payload |
+//	|  2B   |   1B    |  1B   |  2B   |   4B   | length  |
+//	+-------+---------+-------+-------+--------+---------+
+const (
+	FrameMagic      uint16 = 0x3bef
+	FrameVersion    byte   = 1
+	FrameHeaderSize        = 10
+)
+
+// Flag of frame
+type Flag uint16
+
+const (
+	// FlagHandshake marks frames of Option exchanged before messages, their payload is JSON
+	FlagHandshake Flag = 1 << iota
+
+	knownFlags = FlagHandshake
+)
+
+// MaxFrameSize limits the payload of frames both read and written, frames
+// larger than it are corrupt
+var MaxFrameSize = 16 << 20
+
+var (
+	ErrBadMagic      = errors.New("rpc codec: bad frame magic")
+	ErrBadVersion    = errors.New("rpc codec: unsupported frame version")
+	ErrFrameTooLarge = errors.New("rpc codec: frame too large")
+	ErrCorruptFrame  = errors.New("rpc codec: corrupt frame")
+)
+
+// FrameHeader is the fixed header of frame
+type FrameHeader struct {
+	Version byte
+	Codec   byte // ID of codec Type, zero for handshake
+	Flags   Flag
+	Length  uint32 // length of payload
+}
+
+// ID returns the codec byte of frames of t, zero if t isn't registered
+func (t Type) ID() byte {
+	return typeIDs[t]
+}
+
+var typeIDs = map[Type]byte{
+	JsonType:    1,
+	GobType:     2,
+	MsgpackType: 3,
+}
+
+// ReadFrame reads a frame of codec id from r, the payload is no larger than max.
+// Errors other than io.EOF mean r is out of sync and must be closed.
+func ReadFrame(r io.Reader, id byte, max int) (FrameHeader, []byte, error) {
+	var b [FrameHeaderSize]byte
+	if _, err := io.ReadFull(r, b[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: short header", ErrCorruptFrame)
+		}
+		return FrameHeader{}, nil, err
+	}
+
+	h := FrameHeader{
+		Version: b[2],
+		Codec:   b[3],
+		Flags:   Flag(binary.BigEndian.Uint16(b[4:6])),
+		Length:  binary.BigEndian.Uint32(b[6:10]),
+	}
+	switch {
+	case binary.BigEndian.Uint16(b[0:2]) != FrameMagic:
+		return h, nil, ErrBadMagic
+	case h.Version != FrameVersion:
+		return h, nil, fmt.Errorf("%w: %d", ErrBadVersion, h.Version)
+	case h.Codec != id:
+		return h, nil, fmt.Errorf("%w: codec %d, expect %d", ErrCorruptFrame, h.Codec, id)
+	case h.Flags&^knownFlags != 0:
+		return h, nil, fmt.Errorf("%w: unknown flags %#x", ErrCorruptFrame, h.Flags)
+	case uint64(h.Length) > uint64(max):
+		return h, nil, fmt.Errorf("%w: %d bytes, expect at most %d", ErrFrameTooLarge, h.Length, max)
+	}
+
+	payload := make([]byte, h.Length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("%w: short payload", ErrCorruptFrame)
+		}
+		return h, nil, err
+	}
+	return h, payload, nil
+}
+
+// WriteFrame writes payload as a frame of codec id
+func WriteFrame(w io.Writer, id byte, flags Flag, payload []byte) error {
+	if len(payload) > MaxFrameSize {
+		return fmt.Errorf("%w: %d bytes, expect at most %d", ErrFrameTooLarge, len(payload), MaxFrameSize)
+	}
+
+	var b [FrameHeaderSize]byte
+	binary.BigEndian.PutUint16(b[0:2], FrameMagic)
+	b[2] = FrameVersion
+	b[3] = id
+	binary.BigEndian.PutUint16(b[4:6], uint16(flags))
+	binary.BigEndian.PutUint32(b[6:10], uint32(len(payload)))
+	if _, err := w.Write(b[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
@@ -0,0 +1,93 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// message returns a valid frame of a request of t
+func message(t testing.TB, typ Type, seq uint64) []byte {
+	t.Helper()
+	c := &bufferConn{}
+	h := &Header{ServiceMethod: "Store.Total", Seq: seq}
+	args := &benchArgs{Items: []benchItem{{ID: int64(seq), Name: "n", Tags: []string{"a"}, Price: 0.25}}}
+	if err := NewCodecFuncMap[typ](c).Write(h, args); err != nil {
+		t.Fatal(err)
+	}
+	return c.Bytes()
+}
+
+var codecTypes = []Type{JsonType, GobType, MsgpackType}
+
+func TestFrameRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, 0, FlagHandshake, []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	h, payload, err := ReadFrame(&buf, 0, MaxFrameSize)
+	if err != nil || h.Flags != FlagHandshake || string(payload) != `{}` {
+		t.Fatalf("read frame = %+v, %q, %v", h, payload, err)
+	}
+	if _, _, err = ReadFrame(&buf, 0, MaxFrameSize); err != io.EOF {
+		t.Fatalf("read after the last frame err = %v, want io.EOF", err)
+	}
+
+	frame := message(t, MsgpackType, 1)
+	if _, _, err = ReadFrame(bytes.NewReader(frame), MsgpackType.ID(), 4); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("read large frame err = %v, want ErrFrameTooLarge", err)
+	}
+	if _, _, err = ReadFrame(bytes.NewReader(frame[:len(frame)-1]), MsgpackType.ID(), MaxFrameSize); !errors.Is(err, ErrCorruptFrame) {
+		t.Fatalf("read short frame err = %v, want ErrCorruptFrame", err)
+	}
+	if _, _, err = ReadFrame(bytes.NewReader(frame), JsonType.ID(), MaxFrameSize); !errors.Is(err, ErrCorruptFrame) {
+		t.Fatalf("read frame of another codec err = %v, want ErrCorruptFrame", err)
+	}
+}
+
+func FuzzReadFrame(f *testing.F) {
+	var buf bytes.Buffer
+	_ = WriteFrame(&buf, 0, FlagHandshake, []byte(`{"MagicNumber":3928924}`))
+	f.Add(buf.Bytes(), byte(0))
+	for _, typ := range codecTypes {
+		f.Add(message(f, typ, 1), typ.ID())
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, id byte) {
+		h, payload, err := ReadFrame(bytes.NewReader(data), id, 1<<16)
+		if err != nil {
+			return
+		}
+		if int(h.Length) != len(payload) || h.Codec != id {
+			t.Fatalf("read frame %+v of %d bytes, codec %d", h, len(payload), id)
+		}
+		// a frame read is written back as is
+		var buf bytes.Buffer
+		if err = WriteFrame(&buf, h.Codec, h.Flags, payload); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), data[:buf.Len()]) {
+			t.Fatalf("frame written back = %x, read from %x", buf.Bytes(), data)
+		}
+	})
+}
+
+func FuzzBinaryCodecReadHeader(f *testing.F) {
+	for i, typ := range codecTypes {
+		f.Add(message(f, typ, uint64(i)), uint8(i))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte, i uint8) {
+		typ := codecTypes[int(i)%len(codecTypes)]
+		c := &bufferConn{}
+		c.Write(data)
+		cc := NewCodecFuncMap[typ](c)
+		var h Header
+		if cc.ReadeHeader(&h) != nil {
+			return
+		}
+		var args benchArgs
+		_ = cc.ReadBody(&args)
+	})
+}
@@ -0,0 +1,25 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Gob marshals bodies of GobType, each body carries its type since frames are decoded apart
+type Gob struct{}
+
+var _ Marshaler = Gob{}
+
+var NewGobCodec = NewBinaryCodec(GobType, Gob{})
+
+func (Gob) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (Gob) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
@@ -1,56 +1,20 @@
 package codec
 
 import (
-	"bufio"
-	"io"
-
 	jsoniter "github.com/json-iterator/go"
-	"github.com/pedrogao/log"
 )
 
-type JsonCodec struct {
-	conn io.ReadWriteCloser
-	buf  *bufio.Writer
-	dec  *jsoniter.Decoder
-	enc  *jsoniter.Encoder
-}
-
-var _ Codec = (*JsonCodec)(nil) // must implement Codec
-
-func NewJsonCodec(conn io.ReadWriteCloser) Codec {
-	buf := bufio.NewWriter(conn)
-	return &JsonCodec{
-		conn: conn,
-		buf:  buf,
-		dec:  jsoniter.NewDecoder(conn),
-		enc:  jsoniter.NewEncoder(buf),
-	}
-}
+// Json marshals bodies of JsonType
+type Json struct{}
 
-func (c *JsonCodec) Close() error {
-	return c.conn.Close()
-}
+var _ Marshaler = Json{}
 
-func (c *JsonCodec) ReadeHeader(header *Header) error {
-	return c.dec.Decode(header)
-}
+var NewJsonCodec = NewBinaryCodec(JsonType, Json{})
 
-func (c *JsonCodec) ReadBody(body any) error {
-	return c.dec.Decode(body)
+func (Json) Marshal(v any) ([]byte, error) {
+	return jsoniter.Marshal(v)
 }
 
-func (c *JsonCodec) Write(header *Header, body any) (err error) {
-	defer c.buf.Flush()
-
-	if err = c.enc.Encode(header); err != nil {
-		log.Errorf("rpc codec: json encoding header err: %s", err)
-		return err
-	}
-
-	if err = c.enc.Encode(body); err != nil {
-		log.Errorf("rpc codec: json encoding body err: %s", err)
-		return err
-	}
-
-	return nil
+func (Json) Unmarshal(data []byte, v any) error {
+	return jsoniter.Unmarshal(data, v)
 }
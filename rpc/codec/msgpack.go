@@ -0,0 +1,663 @@
+package codec
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+// Msgpack marshals values in MessagePack by reflection: structs are maps keyed by
+// exported field names, and values of encoding.BinaryMarshaler, eg. time.Time, are bins
+type Msgpack struct{}
+
+var _ Marshaler = Msgpack{}
+
+var (
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+func (Msgpack) Marshal(v any) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// Unmarshal decodes data into v, which must be a non-nil pointer
+func (Msgpack) Unmarshal(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: unmarshal into %T: must be a non-nil pointer", v)
+	}
+	d := &msgpackDecoder{data: data}
+	if err := d.decode(rv.Elem()); err != nil {
+		return err
+	}
+	if d.pos != len(d.data) {
+		return fmt.Errorf("msgpack: %d bytes left after value", len(d.data)-d.pos)
+	}
+	return nil
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+	if v.Type().Implements(binaryMarshalerType) && (v.Kind() != reflect.Ptr || !v.IsNil()) {
+		b, err := v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			return err
+		}
+		e.bin(b)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.int(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.uint(v.Uint())
+	case reflect.Float32:
+		e.buf = append(e.buf, 0xca)
+		e.buf = appendUint(e.buf, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.buf = append(e.buf, 0xcb)
+		e.buf = appendUint(e.buf, uint64(math.Float64bits(v.Float())), 8)
+	case reflect.String:
+		e.str(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.bin(b)
+			return nil
+		}
+		e.length(v.Len(), 0x90, 0xdc, 0xdd)
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		e.length(v.Len(), 0x80, 0xde, 0xdf)
+		iter := v.MapRange()
+		for iter.Next() {
+			if err := e.encode(iter.Key()); err != nil {
+				return err
+			}
+			if err := e.encode(iter.Value()); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := fieldsOf(v.Type())
+		e.length(len(fields.names), 0x80, 0xde, 0xdf)
+		for i, name := range fields.names {
+			e.str(name)
+			if err := e.encode(v.Field(fields.index[i])); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) int(i int64) {
+	switch {
+	case i >= 0:
+		e.uint(uint64(i))
+	case i >= -32:
+		e.buf = append(e.buf, byte(i))
+	case i >= math.MinInt8:
+		e.buf = append(e.buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		e.buf = append(e.buf, 0xd1)
+		e.buf = appendUint(e.buf, uint64(i), 2)
+	case i >= math.MinInt32:
+		e.buf = append(e.buf, 0xd2)
+		e.buf = appendUint(e.buf, uint64(i), 4)
+	default:
+		e.buf = append(e.buf, 0xd3)
+		e.buf = appendUint(e.buf, uint64(i), 8)
+	}
+}
+
+func (e *msgpackEncoder) uint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf = append(e.buf, byte(u))
+	case u <= math.MaxUint8:
+		e.buf = append(e.buf, 0xcc, byte(u))
+	case u <= math.MaxUint16:
+		e.buf = append(e.buf, 0xcd)
+		e.buf = appendUint(e.buf, u, 2)
+	case u <= math.MaxUint32:
+		e.buf = append(e.buf, 0xce)
+		e.buf = appendUint(e.buf, u, 4)
+	default:
+		e.buf = append(e.buf, 0xcf)
+		e.buf = appendUint(e.buf, u, 8)
+	}
+}
+
+func (e *msgpackEncoder) str(s string) {
+	switch n := len(s); {
+	case n < 32:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xda)
+		e.buf = appendUint(e.buf, uint64(n), 2)
+	default:
+		e.buf = append(e.buf, 0xdb)
+		e.buf = appendUint(e.buf, uint64(n), 4)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) bin(b []byte) {
+	switch n := len(b); {
+	case n <= math.MaxUint8:
+		e.buf = append(e.buf, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, 0xc5)
+		e.buf = appendUint(e.buf, uint64(n), 2)
+	default:
+		e.buf = append(e.buf, 0xc6)
+		e.buf = appendUint(e.buf, uint64(n), 4)
+	}
+	e.buf = append(e.buf, b...)
+}
+
+// length writes the length of an array or a map by its fix, 16 bits or 32 bits format
+func (e *msgpackEncoder) length(n int, fix, b16, b32 byte) {
+	switch {
+	case n < 16:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.buf = append(e.buf, b16)
+		e.buf = appendUint(e.buf, uint64(n), 2)
+	default:
+		e.buf = append(e.buf, b32)
+		e.buf = appendUint(e.buf, uint64(n), 4)
+	}
+}
+
+// appendUint appends u of n bytes in big endian
+func appendUint(b []byte, u uint64, n int) []byte {
+	for i := n - 1; i >= 0; i-- {
+		b = append(b, byte(u>>(8*i)))
+	}
+	return b
+}
+
+// structFields are exported fields of a struct type
+type structFields struct {
+	names  []string
+	index  []int
+	byName map[string]int
+}
+
+var fieldCache sync.Map // reflect.Type to *structFields
+
+func fieldsOf(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	f := &structFields{byName: map[string]int{}}
+	for i := 0; i < t.NumField(); i++ {
+		if field := t.Field(i); field.IsExported() {
+			f.names = append(f.names, field.Name)
+			f.index = append(f.index, i)
+			f.byName[field.Name] = i
+		}
+	}
+	fieldCache.Store(t, f)
+	return f
+}
+
+type msgpackDecoder struct {
+	data  []byte
+	pos   int
+	depth int // arrays and maps being decoded
+}
+
+// maxDepth limits nested arrays and maps, so that a malicious body can't overflow the stack
+const maxDepth = 10000
+
+var (
+	errShortData = fmt.Errorf("msgpack: unexpected end of data")
+	errTooDeep   = fmt.Errorf("msgpack: nested deeper than %d", maxDepth)
+)
+
+func (d *msgpackDecoder) next(n int) ([]byte, error) {
+	if n < 0 || len(d.data)-d.pos < n {
+		return nil, errShortData
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *msgpackDecoder) peek() (byte, error) {
+	if d.pos >= len(d.data) {
+		return 0, errShortData
+	}
+	return d.data[d.pos], nil
+}
+
+// uintN reads a big endian unsigned integer of n bytes
+func (d *msgpackDecoder) uintN(n int) (uint64, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return 0, err
+	}
+	var u uint64
+	for _, c := range b {
+		u = u<<8 | uint64(c)
+	}
+	return u, nil
+}
+
+// decodeAny decodes the next value as nil, bool, int64, uint64, float32, float64,
+// string, []byte, []any or map[any]any
+func (d *msgpackDecoder) decodeAny() (any, error) {
+	c, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f, c >= 0xe0, c >= 0xcc && c <= 0xd3:
+		return d.number()
+	case c == 0xca, c == 0xcb:
+		return d.number()
+	case c == 0xc0:
+		d.pos++
+		return nil, nil
+	case c == 0xc2, c == 0xc3:
+		d.pos++
+		return c == 0xc3, nil
+	case c&0xe0 == 0xa0, c == 0xd9, c == 0xda, c == 0xdb, c == 0xc4, c == 0xc5, c == 0xc6:
+		b, isStr, err := d.bytes()
+		if err != nil {
+			return nil, err
+		}
+		if isStr {
+			return string(b), nil
+		}
+		return append([]byte(nil), b...), nil
+	case c&0xf0 == 0x90, c == 0xdc, c == 0xdd:
+		n, err := d.arrayLen()
+		if err != nil {
+			return nil, err
+		}
+		list := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, item)
+		}
+		d.depth--
+		return list, nil
+	case c&0xf0 == 0x80, c == 0xde, c == 0xdf:
+		n, err := d.mapLen()
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[any]any, n)
+		for i := 0; i < n; i++ {
+			k, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.decodeAny()
+			if err != nil {
+				return nil, err
+			}
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, fmt.Errorf("msgpack: invalid map key %T", k)
+			}
+			m[k] = v
+		}
+		d.depth--
+		return m, nil
+	}
+	return nil, fmt.Errorf("msgpack: unsupported format 0x%02x", c)
+}
+
+// number decodes an integer as int64 or uint64, or a float as float32 or float64
+func (d *msgpackDecoder) number() (any, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	switch c := b[0]; {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0xcc && c <= 0xcf:
+		u, err := d.uintN(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if u <= math.MaxInt64 {
+			return int64(u), nil
+		}
+		return u, nil
+	case c >= 0xd0 && c <= 0xd3:
+		n := 1 << (c - 0xd0)
+		u, err := d.uintN(n)
+		if err != nil {
+			return nil, err
+		}
+		// sign extension
+		shift := 64 - 8*n
+		return int64(u<<shift) >> shift, nil
+	case c == 0xca:
+		u, err := d.uintN(4)
+		return math.Float32frombits(uint32(u)), err
+	case c == 0xcb:
+		u, err := d.uintN(8)
+		return math.Float64frombits(u), err
+	}
+	return nil, fmt.Errorf("msgpack: 0x%02x is not a number", b[0])
+}
+
+// bytes decodes a str or a bin
+func (d *msgpackDecoder) bytes() ([]byte, bool, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return nil, false, err
+	}
+	var n uint64
+	switch c := b[0]; {
+	case c&0xe0 == 0xa0:
+		n = uint64(c & 0x1f)
+	case c == 0xd9, c == 0xc4:
+		n, err = d.uintN(1)
+	case c == 0xda, c == 0xc5:
+		n, err = d.uintN(2)
+	case c == 0xdb, c == 0xc6:
+		n, err = d.uintN(4)
+	default:
+		return nil, false, fmt.Errorf("msgpack: 0x%02x is not a str or bin", c)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	isStr := b[0] < 0xc4 || b[0] > 0xc6
+	data, err := d.next(int(n))
+	return data, isStr, err
+}
+
+// arrayLen reads the length of an array and enters it, the caller leaves it by d.depth--
+// once its items are decoded
+func (d *msgpackDecoder) arrayLen() (int, error) {
+	return d.enter(0x90, 0xdc, 0xdd, 1)
+}
+
+// mapLen reads the length of a map and enters it like arrayLen
+func (d *msgpackDecoder) mapLen() (int, error) {
+	return d.enter(0x80, 0xde, 0xdf, 2)
+}
+
+// enter reads the length of an array or a map, whose items take size bytes at least,
+// the length is capped by the bytes left so that no huge container is allocated
+func (d *msgpackDecoder) enter(fix, b16, b32 byte, size int) (int, error) {
+	if d.depth >= maxDepth {
+		return 0, errTooDeep
+	}
+	n, err := d.length(fix, b16, b32)
+	if err != nil {
+		return 0, err
+	}
+	if n > (len(d.data)-d.pos)/size {
+		return 0, errShortData
+	}
+	d.depth++
+	return n, nil
+}
+
+func (d *msgpackDecoder) length(fix, b16, b32 byte) (int, error) {
+	b, err := d.next(1)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	switch c := b[0]; {
+	case c&0xf0 == fix:
+		n = uint64(c & 0x0f)
+	case c == b16:
+		n, err = d.uintN(2)
+	case c == b32:
+		n, err = d.uintN(4)
+	default:
+		return 0, fmt.Errorf("msgpack: unexpected format 0x%02x", c)
+	}
+	return int(n), err
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	c, err := d.peek()
+	if err != nil {
+		return err
+	}
+	if c == 0xc0 {
+		d.pos++
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	if v.Kind() != reflect.Ptr && reflect.PtrTo(v.Type()).Implements(binaryUnmarshalerType) {
+		b, _, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("msgpack: unmarshal into %s", v.Type())
+		}
+		x, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(&x).Elem())
+	case reflect.Bool:
+		b, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		ok, isBool := b.(bool)
+		if !isBool {
+			return fmt.Errorf("msgpack: unmarshal %T into bool", b)
+		}
+		v.SetBool(ok)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := d.number()
+		if err != nil {
+			return err
+		}
+		i, ok := x.(int64)
+		if !ok || v.OverflowInt(i) {
+			return fmt.Errorf("msgpack: unmarshal %v into %s", x, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		x, err := d.number()
+		if err != nil {
+			return err
+		}
+		var u uint64
+		switch x := x.(type) {
+		case int64:
+			if x < 0 {
+				return fmt.Errorf("msgpack: unmarshal %d into %s", x, v.Type())
+			}
+			u = uint64(x)
+		case uint64:
+			u = x
+		default:
+			return fmt.Errorf("msgpack: unmarshal %v into %s", x, v.Type())
+		}
+		if v.OverflowUint(u) {
+			return fmt.Errorf("msgpack: unmarshal %d into %s", u, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		x, err := d.number()
+		if err != nil {
+			return err
+		}
+		switch x := x.(type) {
+		case float32:
+			v.SetFloat(float64(x))
+		case float64:
+			v.SetFloat(x)
+		case int64:
+			v.SetFloat(float64(x))
+		case uint64:
+			v.SetFloat(float64(x))
+		}
+	case reflect.String:
+		b, _, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, _, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append([]byte(nil), b...))
+			return nil
+		}
+		n, err := d.arrayLen()
+		if err != nil {
+			return err
+		}
+		slice := reflect.MakeSlice(v.Type(), n, n)
+		for i := 0; i < n; i++ {
+			if err = d.decode(slice.Index(i)); err != nil {
+				return err
+			}
+		}
+		d.depth--
+		v.Set(slice)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, _, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		n, err := d.arrayLen()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if i >= v.Len() {
+				if _, err = d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+		d.depth--
+	case reflect.Map:
+		n, err := d.mapLen()
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMapWithSize(v.Type(), n)
+		for i := 0; i < n; i++ {
+			key := reflect.New(v.Type().Key()).Elem()
+			if err = d.decode(key); err != nil {
+				return err
+			}
+			value := reflect.New(v.Type().Elem()).Elem()
+			if err = d.decode(value); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		d.depth--
+		v.Set(m)
+	case reflect.Struct:
+		n, err := d.mapLen()
+		if err != nil {
+			return err
+		}
+		fields := fieldsOf(v.Type())
+		for i := 0; i < n; i++ {
+			name, _, err := d.bytes()
+			if err != nil {
+				return err
+			}
+			index, ok := fields.byName[string(name)]
+			if !ok {
+				// unknown fields are skipped
+				if _, err = d.decodeAny(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err = d.decode(v.Field(index)); err != nil {
+				return err
+			}
+		}
+		d.depth--
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
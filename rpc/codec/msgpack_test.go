@@ -0,0 +1,114 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type msgpackItem struct {
+	ID    int64
+	Name  string
+	Tags  []string
+	Attrs map[string]int
+	Price float64
+	Next  *msgpackItem
+	At    time.Time
+	Any   any
+}
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	in := msgpackItem{
+		ID:    -1 << 40,
+		Name:  "item",
+		Tags:  []string{"a", "b"},
+		Attrs: map[string]int{"x": 1},
+		Price: 2.5,
+		Next:  &msgpackItem{ID: 2},
+		At:    time.Date(2022, 1, 2, 3, 4, 5, 6, time.UTC),
+		Any:   []any{int64(1), "s", nil, true},
+	}
+	b, err := Msgpack{}.Marshal(&in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out msgpackItem
+	if err = (Msgpack{}).Unmarshal(b, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("round trip = %+v, want %+v", out, in)
+	}
+}
+
+func TestMsgpackTooDeep(t *testing.T) {
+	// arrays of one array nested deeper than maxDepth
+	data := append(bytes.Repeat([]byte{0x91}, maxDepth+1), 0xc0)
+	var v any
+	if err := (Msgpack{}).Unmarshal(data, &v); !errors.Is(err, errTooDeep) {
+		t.Fatalf("unmarshal into any err = %v, want errTooDeep", err)
+	}
+	var list []any
+	if err := (Msgpack{}).Unmarshal(data, &list); !errors.Is(err, errTooDeep) {
+		t.Fatalf("unmarshal into slice err = %v, want errTooDeep", err)
+	}
+
+	data = append(bytes.Repeat([]byte{0x91}, maxDepth), 0xc0)
+	if err := (Msgpack{}).Unmarshal(data, &v); err != nil {
+		t.Fatalf("unmarshal %d nested arrays err = %v", maxDepth, err)
+	}
+}
+
+func TestMsgpackLengthCap(t *testing.T) {
+	tests := map[string][]byte{
+		"array32": {0xdd, 0xff, 0xff, 0xff, 0xff, 0xc0},
+		"array16": {0xdc, 0x00, 0x03, 0xc0, 0xc0},
+		"map32":   {0xdf, 0xff, 0xff, 0xff, 0xff, 0xc0, 0xc0},
+		"map16":   {0xde, 0x00, 0x02, 0xc0, 0xc0},
+	}
+	for name, data := range tests {
+		var v any
+		if err := (Msgpack{}).Unmarshal(data, &v); !errors.Is(err, errShortData) {
+			t.Errorf("%s into any err = %v, want errShortData", name, err)
+		}
+	}
+
+	var list []int
+	if err := (Msgpack{}).Unmarshal(tests["array32"], &list); !errors.Is(err, errShortData) {
+		t.Errorf("array32 into slice err = %v, want errShortData", err)
+	}
+	var m map[string]int
+	if err := (Msgpack{}).Unmarshal(tests["map32"], &m); !errors.Is(err, errShortData) {
+		t.Errorf("map32 into map err = %v, want errShortData", err)
+	}
+}
+
+func FuzzMsgpackUnmarshal(f *testing.F) {
+	seeds := []any{
+		&msgpackItem{ID: 1, Name: "item", Tags: []string{"a"}, Attrs: map[string]int{"x": 1}, Next: &msgpackItem{}},
+		[]any{int64(-1), uint64(1 << 63), 1.5, "s", []byte{1}, nil, true},
+		map[string]any{"k": []any{map[string]any{}}},
+	}
+	for _, seed := range seeds {
+		b, err := Msgpack{}.Marshal(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(b)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var item msgpackItem
+		_ = Msgpack{}.Unmarshal(data, &item)
+		var v any
+		if err := (Msgpack{}).Unmarshal(data, &v); err != nil {
+			return
+		}
+		// values decoded are encoded again
+		if _, err := (Msgpack{}).Marshal(v); err != nil {
+			t.Fatalf("marshal %#v decoded from %x: %v", v, data, err)
+		}
+	})
+}
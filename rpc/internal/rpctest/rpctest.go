@@ -0,0 +1,64 @@
+// Package rpctest provides a service and servers of it for tests of rpc
+package rpctest
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// Foo is a service for tests, eg. "Foo.Sum"
+type Foo int
+
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func (f Foo) SumPtr(args *Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+// Fail fails with msg
+func (f Foo) Fail(msg string, _ *int) error {
+	return errors.New(msg)
+}
+
+func (f Foo) Sleep(d time.Duration, reply *int) error {
+	time.Sleep(d)
+	*reply = 1
+	return nil
+}
+
+// Server registers services and serves connections, eg. *rpc.Server
+type Server interface {
+	Register(rcvr any) error
+	ServeConn(conn net.Conn)
+}
+
+// Start serves Foo by s on a local listener until the test ends, and returns its address
+func Start(t testing.TB, s Server) string {
+	t.Helper()
+	if err := s.Register(new(Foo)); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.ServeConn(conn)
+		}
+	}()
+	return l.Addr().String()
+}
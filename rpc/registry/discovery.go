@@ -0,0 +1,271 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pedrogao/log"
+)
+
+// SelectMode is the strategy of picking a server
+type SelectMode int
+
+const (
+	RandomSelect         SelectMode = iota // select randomly
+	RoundRobinSelect                       // select in turn
+	ConsistentHashSelect                   // select by hash of key, the same key sticks to its server
+)
+
+var ErrNoServer = errors.New("rpc discovery: no available servers")
+
+// Discovery discovers servers of rpc, eg. "tcp@127.0.0.1:9999"
+type Discovery interface {
+	Refresh() error // refresh servers from remote registry
+	Update(servers []string) error
+	// Get returns a server by mode, key is hashed by ConsistentHashSelect only
+	Get(mode SelectMode, key string) (string, error)
+	GetAll() ([]string, error)
+}
+
+// Watcher is implemented by discoveries notifying servers removed from them,
+// eg. so that clients of removed servers are closed
+type Watcher interface {
+	// Watch calls f with servers removed by every following update
+	Watch(f func(removed []string))
+}
+
+// StaticDiscovery is a discovery of servers listed by user
+type StaticDiscovery struct {
+	r        *rand.Rand
+	mu       sync.RWMutex // protects following
+	servers  []string
+	ring     *hashRing
+	index    int // position of round robin
+	watchers []func(removed []string)
+}
+
+var (
+	_ Discovery = (*StaticDiscovery)(nil)
+	_ Watcher   = (*StaticDiscovery)(nil)
+)
+
+func NewStaticDiscovery(servers []string) *StaticDiscovery {
+	d := &StaticDiscovery{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+	_ = d.Update(servers)
+	d.index = d.r.Intn(1 << 30) // avoid always starting from the first server
+	return d
+}
+
+// Refresh is a no-op since servers are static
+func (d *StaticDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *StaticDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	kept := make(map[string]bool, len(servers))
+	for _, s := range servers {
+		kept[s] = true
+	}
+	var removed []string
+	for _, s := range d.servers {
+		if !kept[s] {
+			removed = append(removed, s)
+		}
+	}
+	d.servers = append([]string(nil), servers...)
+	d.ring = newHashRing(defaultReplicas, d.servers)
+	watchers := d.watchers
+	d.mu.Unlock()
+
+	if len(removed) > 0 {
+		for _, f := range watchers {
+			f(removed)
+		}
+	}
+	return nil
+}
+
+func (d *StaticDiscovery) Watch(f func(removed []string)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.watchers = append(d.watchers, f)
+}
+
+func (d *StaticDiscovery) Get(mode SelectMode, key string) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := len(d.servers)
+	if n == 0 {
+		return "", ErrNoServer
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n] // servers may be updated, so mod n to ensure safety
+		d.index = (d.index + 1) % n
+		return s, nil
+	case ConsistentHashSelect:
+		return d.ring.get(key), nil
+	default:
+		return "", fmt.Errorf("rpc discovery: not supported select mode %d", mode)
+	}
+}
+
+func (d *StaticDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]string(nil), d.servers...), nil
+}
+
+const defaultReplicas = 50
+
+// hashRing maps keys to servers by consistent hashing, each server has replicas virtual nodes
+type hashRing struct {
+	hashes []uint32 // sorted
+	nodes  map[uint32]string
+}
+
+func newHashRing(replicas int, servers []string) *hashRing {
+	r := &hashRing{nodes: make(map[uint32]string)}
+	for _, s := range servers {
+		for i := 0; i < replicas; i++ {
+			h := crc32.ChecksumIEEE([]byte(strconv.Itoa(i) + s))
+			r.hashes = append(r.hashes, h)
+			r.nodes[h] = s
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+	return r
+}
+
+// get returns the server of the first virtual node clockwise from the hash of key
+func (r *hashRing) get(key string) string {
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	return r.nodes[r.hashes[i%len(r.hashes)]]
+}
+
+// RegistryDiscovery is a discovery of servers alive in a Registry, servers are
+// refreshed from registry once they are older than timeout. The last known servers
+// are used while registry is unreachable, and a failed refresh isn't retried until timeout.
+type RegistryDiscovery struct {
+	*StaticDiscovery
+	registry   string
+	timeout    time.Duration
+	lastUpdate time.Time
+	refreshing sync.Mutex // refreshes one at a time, concurrent callers wait for its result
+	retryAt    time.Time  // a failed refresh is retried since retryAt, protected by refreshing
+	refreshErr error      // error of the failed refresh, protected by refreshing
+}
+
+var _ Discovery = (*RegistryDiscovery)(nil)
+
+const defaultUpdateTimeout = 10 * time.Second
+
+// NewRegistryDiscovery returns a discovery of registry, eg. "http://127.0.0.1:9998/_rpc_/registry",
+// timeout is 10s if zero
+func NewRegistryDiscovery(registry string, timeout time.Duration) *RegistryDiscovery {
+	if timeout == 0 {
+		timeout = defaultUpdateTimeout
+	}
+	return &RegistryDiscovery{
+		StaticDiscovery: NewStaticDiscovery(nil),
+		registry:        registry,
+		timeout:         timeout,
+	}
+}
+
+func (d *RegistryDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	d.lastUpdate = time.Now()
+	d.mu.Unlock()
+	return d.StaticDiscovery.Update(servers)
+}
+
+// Refresh refreshes servers from registry if they are older than timeout, the error of
+// a failed refresh is returned until timeout without requesting registry again
+func (d *RegistryDiscovery) Refresh() error {
+	d.refreshing.Lock()
+	defer d.refreshing.Unlock()
+	d.mu.RLock()
+	fresh := d.lastUpdate.Add(d.timeout).After(time.Now())
+	d.mu.RUnlock()
+	if fresh {
+		return nil
+	}
+	if time.Now().Before(d.retryAt) {
+		return d.refreshErr
+	}
+
+	if err := d.fetch(); err != nil {
+		log.Errorf("rpc discovery: refresh err: %s", err)
+		d.retryAt, d.refreshErr = time.Now().Add(d.timeout), err
+		return err
+	}
+	return nil
+}
+
+// fetch requests servers from registry and updates them
+func (d *RegistryDiscovery) fetch() error {
+	log.Debugf("rpc discovery: refresh servers from registry %s", d.registry)
+	resp, err := httpClient.Get(d.registry)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc discovery: refresh from %s: %s", d.registry, resp.Status)
+	}
+
+	var servers []string
+	for _, s := range strings.Split(resp.Header.Get(serversHeader), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			servers = append(servers, s)
+		}
+	}
+	return d.Update(servers)
+}
+
+func (d *RegistryDiscovery) Get(mode SelectMode, key string) (string, error) {
+	if err := d.refresh(); err != nil {
+		return "", err
+	}
+	return d.StaticDiscovery.Get(mode, key)
+}
+
+func (d *RegistryDiscovery) GetAll() ([]string, error) {
+	if err := d.refresh(); err != nil {
+		return nil, err
+	}
+	return d.StaticDiscovery.GetAll()
+}
+
+// refresh refreshes servers like Refresh, but falls back to the last known servers
+// if registry fails, the error is returned only if servers were never refreshed
+func (d *RegistryDiscovery) refresh() error {
+	err := d.Refresh()
+	if err == nil {
+		return nil
+	}
+	d.mu.RLock()
+	known := !d.lastUpdate.IsZero()
+	d.mu.RUnlock()
+	if !known {
+		return err
+	}
+	log.Warnf("rpc discovery: use last known servers: %s", err)
+	return nil
+}
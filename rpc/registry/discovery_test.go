@@ -0,0 +1,179 @@
+package registry
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testServers = []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2", "tcp@127.0.0.1:3"}
+
+func TestRandomSelect(t *testing.T) {
+	d := NewStaticDiscovery(testServers)
+	picked := map[string]int{}
+	for i := 0; i < 300; i++ {
+		s, err := d.Get(RandomSelect, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		picked[s]++
+	}
+	if len(picked) != len(testServers) {
+		t.Fatalf("picked %v, want all servers", picked)
+	}
+}
+
+func TestRoundRobinSelect(t *testing.T) {
+	d := NewStaticDiscovery(testServers)
+	first, _ := d.Get(RoundRobinSelect, "")
+	i := 0
+	for i < len(testServers) && testServers[i] != first {
+		i++
+	}
+	for n := 1; n < 2*len(testServers); n++ {
+		s, err := d.Get(RoundRobinSelect, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := testServers[(i+n)%len(testServers)]; s != want {
+			t.Fatalf("pick %d = %s, want %s", n, s, want)
+		}
+	}
+}
+
+func TestConsistentHashSelect(t *testing.T) {
+	d := NewStaticDiscovery(testServers)
+	picked := map[string]string{}
+	for i := 0; i < 100; i++ {
+		key := string(rune('a'+i%26)) + string(rune('0'+i/26))
+		s, err := d.Get(ConsistentHashSelect, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := d.Get(ConsistentHashSelect, key); again != s {
+			t.Fatalf("key %s picked %s then %s", key, s, again)
+		}
+		picked[key] = s
+	}
+
+	// keys of kept servers stick to them after a server is added
+	_ = d.Update(append(testServers, "tcp@127.0.0.1:4"))
+	moved := 0
+	for key, s := range picked {
+		if again, _ := d.Get(ConsistentHashSelect, key); again != s {
+			if again != "tcp@127.0.0.1:4" {
+				t.Fatalf("key %s moved from %s to %s", key, s, again)
+			}
+			moved++
+		}
+	}
+	if moved == len(picked) {
+		t.Fatal("all keys moved to the added server")
+	}
+}
+
+func TestSelectErrors(t *testing.T) {
+	d := NewStaticDiscovery(nil)
+	if _, err := d.Get(RandomSelect, ""); !errors.Is(err, ErrNoServer) {
+		t.Fatalf("get of no server err = %v, want ErrNoServer", err)
+	}
+	_ = d.Update(testServers)
+	if _, err := d.Get(SelectMode(42), ""); err == nil {
+		t.Fatal("get of unsupported mode succeeded")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	d := NewStaticDiscovery(testServers)
+	var removed []string
+	d.Watch(func(servers []string) { removed = append(removed, servers...) })
+
+	_ = d.Update(append(testServers[1:], "tcp@127.0.0.1:4"))
+	if !reflect.DeepEqual(removed, testServers[:1]) {
+		t.Fatalf("removed = %v, want %v", removed, testServers[:1])
+	}
+}
+
+func TestRegistryDiscoveryFallback(t *testing.T) {
+	_, url := startRegistry(t, time.Minute)
+	if _, err := NewRegistryDiscovery("http://127.0.0.1:1/_rpc_/registry", time.Millisecond).GetAll(); err == nil {
+		t.Fatal("discovery of an unreachable registry succeeded")
+	}
+
+	stop, err := Heartbeat(url, testServers[0], time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	d := NewRegistryDiscovery(url, time.Millisecond)
+	if s, err := d.Get(RandomSelect, ""); err != nil || s != testServers[0] {
+		t.Fatalf("get = %s, %v", s, err)
+	}
+
+	// the registry goes down, the last known servers are used
+	d.registry = "http://127.0.0.1:1/_rpc_/registry"
+	time.Sleep(5 * time.Millisecond)
+	if s, err := d.Get(RandomSelect, ""); err != nil || s != testServers[0] {
+		t.Fatalf("get while registry is down = %s, %v", s, err)
+	}
+	if servers, err := d.GetAll(); err != nil || !reflect.DeepEqual(servers, testServers[:1]) {
+		t.Fatalf("get all while registry is down = %v, %v", servers, err)
+	}
+}
+
+func TestRegistryDiscoveryBackoff(t *testing.T) {
+	var requests, failing int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(serversHeader, testServers[0])
+	}))
+	defer ts.Close()
+
+	d := NewRegistryDiscovery(ts.URL, 100*time.Millisecond)
+	if s, err := d.Get(RandomSelect, ""); err != nil || s != testServers[0] {
+		t.Fatalf("get = %s, %v", s, err)
+	}
+
+	// the registry fails, concurrent gets request it once and use the last known servers
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(110 * time.Millisecond)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if s, err := d.Get(RandomSelect, ""); err != nil || s != testServers[0] {
+				t.Errorf("get while registry fails = %s, %v", s, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := d.GetAll(); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Refresh(); err == nil {
+		t.Fatal("refresh within the backoff succeeded")
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Fatalf("%d requests to registry, want 2", n)
+	}
+
+	// the failed refresh is retried after timeout
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(110 * time.Millisecond)
+	if err := d.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Fatalf("%d requests to registry, want 3", n)
+	}
+}
@@ -0,0 +1,153 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pedrogao/log"
+)
+
+const (
+	DefaultPath    = "/_rpc_/registry"
+	DefaultTimeout = 5 * time.Minute
+
+	serversHeader = "X-Rpc-Servers" // alive servers replied to GET, separated by comma
+	serverHeader  = "X-Rpc-Server"  // server of POST heartbeat
+)
+
+// Registry is a registry of rpc servers over HTTP, servers send heartbeats by POST,
+// and clients get alive servers by GET. Servers without heartbeat in timeout expire.
+type Registry struct {
+	timeout time.Duration
+	mu      sync.Mutex
+	servers map[string]*serverItem
+}
+
+type serverItem struct {
+	Addr  string
+	start time.Time // time of the last heartbeat
+}
+
+// New returns a registry expiring servers after timeout, servers never expire if timeout is zero
+func New(timeout time.Duration) *Registry {
+	return &Registry{
+		timeout: timeout,
+		servers: make(map[string]*serverItem),
+	}
+}
+
+var DefaultRegistry = New(DefaultTimeout)
+
+// httpClient requests registries by heartbeats and discoveries
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+func (r *Registry) putServer(addr string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.servers[addr]
+	if s == nil {
+		r.servers[addr] = &serverItem{Addr: addr, start: time.Now()}
+		log.Infof("rpc registry: put server %s", addr)
+	} else {
+		s.start = time.Now() // renew
+	}
+}
+
+// aliveServers returns sorted alive servers, and removes expired ones
+func (r *Registry) aliveServers() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var alive []string
+	for addr, s := range r.servers {
+		if r.timeout == 0 || s.start.Add(r.timeout).After(time.Now()) {
+			alive = append(alive, addr)
+		} else {
+			delete(r.servers, addr)
+			log.Infof("rpc registry: server %s expired", addr)
+		}
+	}
+	sort.Strings(alive)
+	return alive
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set(serversHeader, strings.Join(r.aliveServers(), ","))
+	case http.MethodPost:
+		addr := req.Header.Get(serverHeader)
+		if addr == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.putServer(addr)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleHTTP registers r on path of http.DefaultServeMux
+func (r *Registry) HandleHTTP(path string) {
+	http.Handle(path, r)
+	log.Infof("rpc registry path: %s", path)
+}
+
+// HandleHTTP registers DefaultRegistry on DefaultPath
+func HandleHTTP() {
+	DefaultRegistry.HandleHTTP(DefaultPath)
+}
+
+// Heartbeat sends a heartbeat of server addr, eg. "tcp@127.0.0.1:9999", to registry,
+// eg. "http://127.0.0.1:9998/_rpc_/registry", and then every duration until stop is called.
+// Duration is one minute less than DefaultTimeout if zero.
+func Heartbeat(registry, addr string, duration time.Duration) (stop func(), err error) {
+	if duration == 0 {
+		duration = DefaultTimeout - time.Minute
+	}
+	if err = sendHeartbeat(registry, addr); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(duration)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				if err := sendHeartbeat(registry, addr); err != nil {
+					log.Errorf("rpc server: heartbeat err: %s", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }, nil
+}
+
+func sendHeartbeat(registry, addr string) error {
+	log.Debugf("rpc server: send heartbeat %s to registry %s", addr, registry)
+	req, err := http.NewRequest(http.MethodPost, registry, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(serverHeader, addr)
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("rpc server: heartbeat to %s: %s", registry, resp.Status)
+	}
+	return nil
+}
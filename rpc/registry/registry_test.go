@@ -0,0 +1,78 @@
+package registry
+
+import (
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/log"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOptions(log.WithLevel(log.FatalLevel))
+	os.Exit(m.Run())
+}
+
+// startRegistry serves a registry expiring servers after timeout until the test ends
+func startRegistry(t *testing.T, timeout time.Duration) (*Registry, string) {
+	t.Helper()
+	r := New(timeout)
+	ts := httptest.NewServer(r)
+	t.Cleanup(ts.Close)
+	return r, ts.URL + DefaultPath
+}
+
+func TestHeartbeat(t *testing.T) {
+	r, url := startRegistry(t, time.Minute)
+	stop, err := Heartbeat(url, "tcp@127.0.0.1:1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	stop2, err := Heartbeat(url, "tcp@127.0.0.1:2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop2()
+
+	if alive := r.aliveServers(); !reflect.DeepEqual(alive, []string{"tcp@127.0.0.1:1", "tcp@127.0.0.1:2"}) {
+		t.Fatalf("alive servers = %v", alive)
+	}
+	d := NewRegistryDiscovery(url, 0)
+	if servers, err := d.GetAll(); err != nil || len(servers) != 2 {
+		t.Fatalf("discovered servers = %v, %v", servers, err)
+	}
+
+	if _, err = Heartbeat(url, "", time.Minute); err == nil {
+		t.Fatal("heartbeat without server succeeded")
+	}
+}
+
+func TestExpire(t *testing.T) {
+	r, url := startRegistry(t, 100*time.Millisecond)
+
+	// the server sending heartbeats stays alive, the other one expires
+	stop, err := Heartbeat(url, "tcp@127.0.0.1:1", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	stopped, err := Heartbeat(url, "tcp@127.0.0.1:2", 20*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped()
+
+	time.Sleep(250 * time.Millisecond)
+	if alive := r.aliveServers(); !reflect.DeepEqual(alive, []string{"tcp@127.0.0.1:1"}) {
+		t.Fatalf("alive servers = %v, want the expired one removed", alive)
+	}
+
+	stop()
+	time.Sleep(150 * time.Millisecond)
+	if alive := r.aliveServers(); len(alive) != 0 {
+		t.Fatalf("alive servers after heartbeats stop = %v", alive)
+	}
+}
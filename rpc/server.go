@@ -2,8 +2,13 @@ package rpc
 
 import (
 	"fmt"
+	"go/ast"
+	"io"
 	"net"
+	"reflect"
+	"strings"
 	"sync"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
 	"github.com/pedrogao/log"
@@ -14,17 +19,33 @@ const MagicNumber = 0x3bef5c
 
 type Option struct {
 	MagicNumber int
-	CodeType    codec.Type
+	CodeType    codec.Type // codec of the connection, replied by server
+	// CodecTypes are codecs offered by client in preference, only CodeType is offered if empty
+	CodecTypes []codec.Type
+	// ConnectTimeout limits dialing and handshake, HandleTimeout limits handling of each request
+	// by server, no limit if zero
+	ConnectTimeout time.Duration
+	HandleTimeout  time.Duration
+}
+
+// offers returns codecs offered by client
+func (o *Option) offers() []codec.Type {
+	if len(o.CodecTypes) > 0 {
+		return o.CodecTypes
+	}
+	return []codec.Type{o.CodeType}
 }
 
 var DefaultOption = &Option{
-	MagicNumber: MagicNumber,
-	CodeType:    codec.JsonType,
+	MagicNumber:    MagicNumber,
+	CodeType:       codec.JsonType,
+	ConnectTimeout: 10 * time.Second,
 }
 
 // Server of rpc
 type Server struct {
-	sending sync.Mutex
+	sending    sync.Mutex
+	serviceMap sync.Map // name to *service
 }
 
 func NewServer() *Server {
@@ -44,52 +65,156 @@ func (s *Server) Accept(listener net.Listener) {
 }
 
 func (s *Server) ServeConn(conn net.Conn) {
-	var opt Option
-	if err := jsoniter.NewDecoder(conn).Decode(&opt); err != nil {
+	opt, err := ReadOption(conn)
+	if err != nil {
 		log.Errorf("decode option err: %s", err)
+		_ = conn.Close()
 		return
 	}
 
 	if opt.MagicNumber != MagicNumber {
 		log.Error("invalid packed, magic number in-correct")
+		_ = conn.Close()
 		return
 	}
 
-	f := codec.NewCodecFuncMap[opt.CodeType]
-	if f == nil {
-		log.Error("invalid codec type")
+	// reply the codec picked, the client waits for it before sending requests
+	reply := &Option{MagicNumber: MagicNumber, CodeType: pickCodec(opt.offers())}
+	if err := WriteOption(conn, reply); err != nil {
+		log.Errorf("encode option err: %s", err)
+		_ = conn.Close()
+		return
+	}
+	if reply.CodeType == "" {
+		log.Errorf("invalid codec types: %v", opt.offers())
+		_ = conn.Close()
 		return
 	}
-	cc := f(conn)
+	cc := codec.NewCodecFuncMap[reply.CodeType](conn)
 	defer cc.Close()
 
-	s.serveCodec(cc)
+	s.serveCodec(cc, opt.HandleTimeout)
+}
+
+// maxOptionSize limits the handshake frame of Option
+const maxOptionSize = 4 << 10
+
+// WriteOption writes opt in JSON as the handshake frame
+func WriteOption(w io.Writer, opt *Option) error {
+	b, err := jsoniter.Marshal(opt)
+	if err != nil {
+		return err
+	}
+	return codec.WriteFrame(w, 0, codec.FlagHandshake, b)
+}
+
+// ReadOption reads the handshake frame of Option, only the frame is read from r
+func ReadOption(r io.Reader) (*Option, error) {
+	h, b, err := codec.ReadFrame(r, 0, maxOptionSize)
+	if err != nil {
+		return nil, err
+	}
+	if h.Flags&codec.FlagHandshake == 0 {
+		return nil, fmt.Errorf("%w: expect handshake", codec.ErrCorruptFrame)
+	}
+	var opt Option
+	if err = jsoniter.Unmarshal(b, &opt); err != nil {
+		return nil, err
+	}
+	return &opt, nil
+}
+
+// Register publishes exported methods of rcvr of shape `func (T) Method(args A, reply *R) error`
+// as service named by the type of rcvr, eg. "Foo.Sum"
+func (s *Server) Register(rcvr any) error {
+	return s.RegisterName(reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name(), rcvr)
+}
+
+// RegisterName publishes methods of rcvr like Register as service name
+func (s *Server) RegisterName(name string, rcvr any) error {
+	if name == "" || !ast.IsExported(name) {
+		log.Errorf("rpc server: invalid service name %q", name)
+		return fmt.Errorf("rpc server: invalid service name %q", name)
+	}
+	svc := newService(rcvr, name)
+	if len(svc.method) == 0 {
+		log.Errorf("rpc server: service %s has no suitable method", name)
+		return fmt.Errorf("rpc server: service %s has no suitable method", name)
+	}
+	if _, dup := s.serviceMap.LoadOrStore(name, svc); dup {
+		return fmt.Errorf("rpc server: service already defined: %s", name)
+	}
+	return nil
+}
+
+// findService returns the service and method of `Service.Method`
+func (s *Server) findService(serviceMethod string) (*service, *methodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return nil, nil, fmt.Errorf("rpc server: service/method request ill-formed: %s", serviceMethod)
+	}
+	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
+	svci, ok := s.serviceMap.Load(serviceName)
+	if !ok {
+		return nil, nil, fmt.Errorf("rpc server: can't find service %s", serviceName)
+	}
+	svc := svci.(*service)
+	mtype := svc.method[methodName]
+	if mtype == nil {
+		return nil, nil, fmt.Errorf("rpc server: can't find method %s", serviceMethod)
+	}
+	return svc, mtype, nil
+}
+
+// invalidRequest is the body of error responses
+var invalidRequest = struct{}{}
+
+// pickCodec returns the first supported codec of offers, empty if none
+func pickCodec(offers []codec.Type) codec.Type {
+	for _, t := range offers {
+		if codec.NewCodecFuncMap[t] != nil {
+			return t
+		}
+	}
+	return ""
 }
 
-func (s *Server) serveCodec(cc codec.Codec) {
+func (s *Server) serveCodec(cc codec.Codec, timeout time.Duration) {
+	wg := new(sync.WaitGroup)
 	for {
 		// 读取请求
 		req, err := s.readRequest(cc)
 		if err != nil {
+			// the connection can't be read any more
+			if req == nil {
+				break
+			}
 			req.h.Error = err.Error()
 			// err response
-			s.sendResponse(cc, req.h, nil)
+			s.sendResponse(cc, req.h, invalidRequest)
 			continue
 		}
-		go s.handleRequest(cc, req)
+		wg.Add(1)
+		go s.handleRequest(cc, req, wg, timeout)
 	}
+	// responses are sent before the codec is closed
+	wg.Wait()
 }
 
 type request struct {
-	h     *codec.Header
-	argv  any
-	reply any
+	h      *codec.Header
+	argv   reflect.Value
+	replyv reflect.Value
+	mtype  *methodType
+	svc    *service
 }
 
 func (s *Server) readRequestHeader(cc codec.Codec) (*codec.Header, error) {
 	var h codec.Header
 	if err := cc.ReadeHeader(&h); err != nil {
-		log.Errorf("read header err: %s", err)
+		if err != io.EOF {
+			log.Errorf("read header err: %s", err)
+		}
 		return nil, err
 	}
 
@@ -103,18 +228,63 @@ func (s *Server) readRequest(cc codec.Codec) (*request, error) {
 	}
 
 	req := &request{h: h}
-	if err = cc.ReadBody(&req.argv); err != nil {
+	req.svc, req.mtype, err = s.findService(h.ServiceMethod)
+	if err != nil {
+		// discard the body
+		_ = cc.ReadBody(nil)
+		return req, err
+	}
+
+	req.argv = req.mtype.newArgv()
+	req.replyv = req.mtype.newReplyv()
+	// body is decoded by pointer
+	argvi := req.argv.Interface()
+	if req.argv.Type().Kind() != reflect.Ptr {
+		argvi = req.argv.Addr().Interface()
+	}
+	if err = cc.ReadBody(argvi); err != nil {
 		log.Errorf("read request argv err: %s", err)
-		return nil, fmt.Errorf("read request body err: %s", err)
+		return req, fmt.Errorf("read request body err: %s", err)
 	}
 
 	return req, nil
 }
 
-func (s *Server) handleRequest(cc codec.Codec, req *request) {
-	log.Infof("handle request: %+v, %+v", req.h, req.argv)
-	req.reply = fmt.Sprintf("resp: %d", req.h.Seq)
-	s.sendResponse(cc, req.h, req.reply)
+// handleRequest calls the method of request, an error is responded if the call doesn't
+// return in timeout, and the late reply is dropped
+func (s *Server) handleRequest(cc codec.Codec, req *request, wg *sync.WaitGroup, timeout time.Duration) {
+	defer wg.Done()
+
+	log.Debugf("handle request: %+v", req.h)
+	var once sync.Once
+	respond := func(h codec.Header, body any) {
+		once.Do(func() { s.sendResponse(cc, &h, body) })
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := req.svc.call(req.mtype, req.argv, req.replyv); err != nil {
+			h := *req.h
+			h.Error = err.Error()
+			respond(h, invalidRequest)
+			return
+		}
+		respond(*req.h, req.replyv.Interface())
+	}()
+
+	if timeout <= 0 {
+		<-done
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		h := *req.h
+		h.Error = fmt.Sprintf("rpc server: request handle timeout: expect within %s", timeout)
+		respond(h, invalidRequest)
+	case <-done:
+	}
 }
 
 func (s *Server) sendResponse(cc codec.Codec, h *codec.Header, body any) {
@@ -128,6 +298,16 @@ func (s *Server) sendResponse(cc codec.Codec, h *codec.Header, body any) {
 
 var DefaultServer = NewServer()
 
+// Register publishes methods of rcvr in DefaultServer
+func Register(rcvr any) error {
+	return DefaultServer.Register(rcvr)
+}
+
+// RegisterName publishes methods of rcvr as service name in DefaultServer
+func RegisterName(name string, rcvr any) error {
+	return DefaultServer.RegisterName(name, rcvr)
+}
+
 func Accept(listener net.Listener) {
 	DefaultServer.Accept(listener)
 }
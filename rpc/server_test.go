@@ -0,0 +1,170 @@
+package rpc
+
+import (
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/rpc/codec"
+	"github.com/pedrogao/rpc/internal/rpctest"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOptions(log.WithLevel(log.FatalLevel)) // corrupt requests are logged as errors
+	os.Exit(m.Run())
+}
+
+// startServer serves rpctest.Foo until the test ends, and returns its address
+func startServer(t *testing.T) string {
+	t.Helper()
+	return rpctest.Start(t, NewServer())
+}
+
+func TestHandleTimeout(t *testing.T) {
+	addr := startServer(t)
+	client, err := Dial("tcp", addr, &Option{HandleTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	start := time.Now()
+	err = client.Call("Foo.Sleep", time.Second, &reply)
+	if err == nil || !strings.Contains(err.Error(), "handle timeout") {
+		t.Fatalf("call err = %v, want handle timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("timeout responded after %s", elapsed)
+	}
+
+	// the connection serves other requests, the late reply is dropped
+	if err = client.Call("Foo.Sum", rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("call after timeout = %d, %v", reply, err)
+	}
+}
+
+func TestCorruptFrameClosesConn(t *testing.T) {
+	addr := startServer(t)
+	client, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if err = WriteOption(conn, &Option{MagicNumber: MagicNumber, CodeType: codec.MsgpackType}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadOption(conn); err != nil {
+		t.Fatal(err)
+	}
+	// a frame of bad magic
+	if _, err = conn.Write([]byte{0xde, 0xad, 1, codec.MsgpackType.ID(), 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.Copy(io.Discard, conn); err != nil {
+		t.Fatalf("server doesn't close the connection of corrupt frame: %v", err)
+	}
+
+	var reply int
+	if err = client.Call("Foo.Sum", rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("call on another connection = %d, %v", reply, err)
+	}
+}
+
+type unexported int
+
+func (unexported) Sum(args rpctest.Args, reply *int) error { return nil }
+
+type Empty struct{}
+
+// Unsuitable has methods of other shapes only
+type Unsuitable int
+
+func (Unsuitable) NoReply(args rpctest.Args) error                { return nil }
+func (Unsuitable) ValueReply(args rpctest.Args, reply int) error  { return nil }
+func (Unsuitable) NoError(args rpctest.Args, reply *int)          {}
+func (Unsuitable) unexported(args rpctest.Args, reply *int) error { return nil }
+
+func TestRegister(t *testing.T) {
+	s := NewServer()
+	tests := map[string]struct {
+		register func() error
+		want     string
+	}{
+		"unexported receiver": {func() error { return s.Register(new(unexported)) }, "invalid service name"},
+		"empty name":          {func() error { return s.RegisterName("", new(rpctest.Foo)) }, "invalid service name"},
+		"unexported name":     {func() error { return s.RegisterName("foo", new(rpctest.Foo)) }, "invalid service name"},
+		"no method":           {func() error { return s.Register(&Empty{}) }, "no suitable method"},
+		"unsuitable methods":  {func() error { return s.Register(new(Unsuitable)) }, "no suitable method"},
+	}
+	for name, test := range tests {
+		if err := test.register(); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("register of %s err = %v, want %s", name, err, test.want)
+		}
+	}
+
+	if err := s.Register(new(rpctest.Foo)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(new(rpctest.Foo)); err == nil || !strings.Contains(err.Error(), "already defined") {
+		t.Fatalf("duplicate register err = %v, want already defined", err)
+	}
+	if err := s.RegisterName("Bar", new(rpctest.Foo)); err != nil {
+		t.Fatal(err)
+	}
+	svc, mtype, err := s.findService("Bar.SumPtr")
+	if err != nil || svc.name != "Bar" || mtype.ArgType != reflect.TypeOf(&rpctest.Args{}) {
+		t.Fatalf("find Bar.SumPtr = %v, %v, %v", svc, mtype, err)
+	}
+	if _, ok := svc.method["Sleep"]; !ok || len(svc.method) != 4 {
+		t.Fatalf("methods of Bar = %v, want Sum, SumPtr, Fail and Sleep", svc.method)
+	}
+}
+
+func TestServeCall(t *testing.T) {
+	addr := startServer(t)
+	client, err := Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	var reply int
+	if err = client.Call("Foo.Sum", rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("call of value args = %d, %v", reply, err)
+	}
+	if err = client.Call("Foo.SumPtr", &rpctest.Args{Num1: 3, Num2: 4}, &reply); err != nil || reply != 7 {
+		t.Fatalf("call of pointer args = %d, %v", reply, err)
+	}
+	if err = client.Call("Foo.Fail", "failed", &reply); err == nil || err.Error() != "failed" {
+		t.Fatalf("call of failed handler err = %v, want failed", err)
+	}
+
+	tests := map[string]string{
+		"Foo":         "ill-formed",
+		"Bar.Sum":     "can't find service Bar",
+		"Foo.Missing": "can't find method Foo.Missing",
+	}
+	for serviceMethod, want := range tests {
+		err = client.Call(serviceMethod, rpctest.Args{Num1: 1, Num2: 2}, &reply)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("call of %s err = %v, want %s", serviceMethod, err, want)
+		}
+	}
+	// bodies of invalid requests are discarded, the connection serves following requests
+	if err = client.Call("Foo.Sum", rpctest.Args{Num1: 5, Num2: 6}, &reply); err != nil || reply != 11 {
+		t.Fatalf("call after invalid requests = %d, %v", reply, err)
+	}
+}
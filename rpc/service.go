@@ -0,0 +1,100 @@
+package rpc
+
+import (
+	"go/ast"
+	"reflect"
+	"sync/atomic"
+
+	"github.com/pedrogao/log"
+)
+
+var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
+
+// methodType is a method of shape `func (T) Method(args A, reply *R) error`
+type methodType struct {
+	method    reflect.Method
+	ArgType   reflect.Type
+	ReplyType reflect.Type
+	numCalls  uint64
+}
+
+func (m *methodType) NumCalls() uint64 {
+	return atomic.LoadUint64(&m.numCalls)
+}
+
+// newArgv returns a new value of args, args of pointer type point to a zero value
+func (m *methodType) newArgv() reflect.Value {
+	if m.ArgType.Kind() == reflect.Ptr {
+		return reflect.New(m.ArgType.Elem())
+	}
+	return reflect.New(m.ArgType).Elem()
+}
+
+// newReplyv returns a pointer of a new reply, maps and slices are made
+func (m *methodType) newReplyv() reflect.Value {
+	replyv := reflect.New(m.ReplyType.Elem())
+	switch m.ReplyType.Elem().Kind() {
+	case reflect.Map:
+		replyv.Elem().Set(reflect.MakeMap(m.ReplyType.Elem()))
+	case reflect.Slice:
+		replyv.Elem().Set(reflect.MakeSlice(m.ReplyType.Elem(), 0, 0))
+	}
+	return replyv
+}
+
+// service is a receiver whose methods are called by `Service.Method`
+type service struct {
+	name   string
+	typ    reflect.Type
+	rcvr   reflect.Value
+	method map[string]*methodType
+}
+
+func newService(rcvr any, name string) *service {
+	s := &service{
+		name: name,
+		typ:  reflect.TypeOf(rcvr),
+		rcvr: reflect.ValueOf(rcvr),
+	}
+	s.registerMethods()
+	return s
+}
+
+// registerMethods registers exported methods of shape `func (T) Method(args A, reply *R) error`,
+// A and R must be exported or builtin types
+func (s *service) registerMethods() {
+	s.method = make(map[string]*methodType)
+	for i := 0; i < s.typ.NumMethod(); i++ {
+		method := s.typ.Method(i)
+		mType := method.Type
+		if mType.NumIn() != 3 || mType.NumOut() != 1 || mType.Out(0) != typeOfError {
+			continue
+		}
+		argType, replyType := mType.In(1), mType.In(2)
+		if replyType.Kind() != reflect.Ptr || !isExportedOrBuiltinType(argType) || !isExportedOrBuiltinType(replyType) {
+			continue
+		}
+		s.method[method.Name] = &methodType{
+			method:    method,
+			ArgType:   argType,
+			ReplyType: replyType,
+		}
+		log.Infof("rpc server: register %s.%s", s.name, method.Name)
+	}
+}
+
+func (s *service) call(m *methodType, argv, replyv reflect.Value) error {
+	atomic.AddUint64(&m.numCalls, 1)
+	returnValues := m.method.Func.Call([]reflect.Value{s.rcvr, argv, replyv})
+	if errInter := returnValues[0].Interface(); errInter != nil {
+		return errInter.(error)
+	}
+	return nil
+}
+
+func isExportedOrBuiltinType(t reflect.Type) bool {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return ast.IsExported(t.Name()) || t.PkgPath() == ""
+}
@@ -0,0 +1,202 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"github.com/pedrogao/rpc"
+	"github.com/pedrogao/rpc/registry"
+)
+
+// XClient calls servers of Discovery picked by mode, clients of servers are cached,
+// and closed once their servers are removed from a Discovery implementing registry.Watcher
+type XClient struct {
+	d       registry.Discovery
+	mode    registry.SelectMode
+	opt     *rpc.Option
+	mu      sync.Mutex // protects following
+	clients map[string]*rpc.Client
+	dialing map[string]*dialCall
+	closed  bool
+}
+
+// dialCall is a dial in flight, which is shared by calls of the same server
+type dialCall struct {
+	done   chan struct{}
+	client *rpc.Client
+	err    error
+}
+
+var _ io.Closer = (*XClient)(nil)
+
+func NewXClient(d registry.Discovery, mode registry.SelectMode, opt *rpc.Option) *XClient {
+	xc := &XClient{
+		d:       d,
+		mode:    mode,
+		opt:     opt,
+		clients: make(map[string]*rpc.Client),
+		dialing: make(map[string]*dialCall),
+	}
+	if w, ok := d.(registry.Watcher); ok {
+		w.Watch(xc.remove)
+	}
+	return xc
+}
+
+func (xc *XClient) Close() error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+
+	xc.closed = true
+	for key, client := range xc.clients {
+		_ = client.Close()
+		delete(xc.clients, key)
+	}
+	return nil
+}
+
+// remove closes clients of servers removed from discovery
+func (xc *XClient) remove(servers []string) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+
+	for _, rpcAddr := range servers {
+		if client, ok := xc.clients[rpcAddr]; ok {
+			_ = client.Close()
+			delete(xc.clients, rpcAddr)
+		}
+	}
+}
+
+// dial returns the cached client of rpcAddr, unavailable clients are redialed.
+// Servers are dialed without holding the lock, and concurrent dials of a server are shared.
+func (xc *XClient) dial(rpcAddr string) (*rpc.Client, error) {
+	xc.mu.Lock()
+	if xc.closed {
+		xc.mu.Unlock()
+		return nil, rpc.ErrShutdown
+	}
+	client, ok := xc.clients[rpcAddr]
+	if ok && client.IsAvailable() {
+		xc.mu.Unlock()
+		return client, nil
+	}
+	if ok {
+		_ = client.Close()
+		delete(xc.clients, rpcAddr)
+	}
+	call, dialing := xc.dialing[rpcAddr]
+	if !dialing {
+		call = &dialCall{done: make(chan struct{})}
+		xc.dialing[rpcAddr] = call
+	}
+	xc.mu.Unlock()
+
+	if dialing {
+		<-call.done
+		return call.client, call.err
+	}
+
+	opt := xc.opt
+	if opt != nil {
+		copied := *opt // Dial fills the option
+		opt = &copied
+	}
+	call.client, call.err = rpc.XDial(rpcAddr, opt)
+
+	xc.mu.Lock()
+	delete(xc.dialing, rpcAddr)
+	if call.err == nil {
+		if xc.closed {
+			_ = call.client.Close()
+			call.client, call.err = nil, rpc.ErrShutdown
+		} else {
+			xc.clients[rpcAddr] = call.client
+		}
+	}
+	xc.mu.Unlock()
+	close(call.done)
+	return call.client, call.err
+}
+
+func (xc *XClient) call(ctx context.Context, rpcAddr string, serviceMethod string, args, reply any) error {
+	client, err := xc.dial(rpcAddr)
+	if err != nil {
+		return err
+	}
+	return client.CallContext(ctx, serviceMethod, args, reply)
+}
+
+// Call calls a server picked by mode, ConsistentHashSelect hashes args,
+// so calls of the same args stick to the same server
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply any) error {
+	return xc.CallKey(ctx, hashKey(args), serviceMethod, args, reply)
+}
+
+// hashKey returns the text of args dereferenced, so that pointers to the same args hash alike.
+// Pointers nested in args are printed as addresses, calls of such args should use CallKey.
+func hashKey(args any) string {
+	v := reflect.ValueOf(args)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return fmt.Sprint(args)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// CallKey calls like Call, but ConsistentHashSelect hashes key
+func (xc *XClient) CallKey(ctx context.Context, key, serviceMethod string, args, reply any) error {
+	rpcAddr, err := xc.d.Get(xc.mode, key)
+	if err != nil {
+		return err
+	}
+	return xc.call(ctx, rpcAddr, serviceMethod, args, reply)
+}
+
+// Broadcast calls all servers of discovery, the reply is the reply of any successful call,
+// and the error is the first error, calls in flight are canceled once any call fails
+func (xc *XClient) Broadcast(ctx context.Context, serviceMethod string, args, reply any) error {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return err
+	}
+	if len(servers) == 0 {
+		return registry.ErrNoServer
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex // protects e and replyDone
+	var e error
+	replyDone := reply == nil // if reply is nil, don't need to set value
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for _, rpcAddr := range servers {
+		wg.Add(1)
+		go func(rpcAddr string) {
+			defer wg.Done()
+
+			var clonedReply any
+			if reply != nil {
+				clonedReply = reflect.New(reflect.ValueOf(reply).Elem().Type()).Interface()
+			}
+			err := xc.call(ctx, rpcAddr, serviceMethod, args, clonedReply)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && e == nil {
+				e = err
+				cancel() // if any call failed, cancel unfinished calls
+			}
+			if err == nil && !replyDone {
+				reflect.ValueOf(reply).Elem().Set(reflect.ValueOf(clonedReply).Elem())
+				replyDone = true
+			}
+		}(rpcAddr)
+	}
+	wg.Wait()
+	return e
+}
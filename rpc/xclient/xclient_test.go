@@ -0,0 +1,152 @@
+package xclient
+
+import (
+	"context"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pedrogao/log"
+	"github.com/pedrogao/rpc"
+	"github.com/pedrogao/rpc/internal/rpctest"
+	"github.com/pedrogao/rpc/registry"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOptions(log.WithLevel(log.FatalLevel))
+	os.Exit(m.Run())
+}
+
+// startServer serves rpctest.Foo until the test ends, and returns its address of format tcp@addr
+func startServer(t *testing.T) string {
+	t.Helper()
+	return "tcp@" + rpctest.Start(t, rpc.NewServer())
+}
+
+func cached(xc *XClient) map[string]*rpc.Client {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+
+	clients := make(map[string]*rpc.Client, len(xc.clients))
+	for addr, client := range xc.clients {
+		clients[addr] = client
+	}
+	return clients
+}
+
+func TestDialShared(t *testing.T) {
+	addr := startServer(t)
+	xc := NewXClient(registry.NewStaticDiscovery([]string{addr}), registry.RandomSelect, nil)
+	defer xc.Close()
+
+	var wg sync.WaitGroup
+	clients := make([]*rpc.Client, 10)
+	for i := range clients {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			client, err := xc.dial(addr)
+			if err != nil {
+				t.Error(err)
+			}
+			clients[i] = client
+		}(i)
+	}
+	wg.Wait()
+	for _, client := range clients {
+		if client != clients[0] {
+			t.Fatal("concurrent dials of a server returned different clients")
+		}
+	}
+}
+
+func TestDialWithoutLock(t *testing.T) {
+	// the listener accepts connections but never replies the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	hanging, addr := "tcp@"+l.Addr().String(), startServer(t)
+	xc := NewXClient(registry.NewStaticDiscovery([]string{hanging, addr}), registry.RandomSelect,
+		&rpc.Option{ConnectTimeout: time.Second})
+	defer xc.Close()
+
+	go func() { _, _ = xc.dial(hanging) }()
+	time.Sleep(20 * time.Millisecond)
+	start := time.Now()
+	var reply int
+	if err = xc.call(context.Background(), addr, "Foo.Sum", rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("call = %d, %v", reply, err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("call waited %s for the dial of another server", elapsed)
+	}
+}
+
+func TestRemovedServerClosed(t *testing.T) {
+	addr1, addr2 := startServer(t), startServer(t)
+	d := registry.NewStaticDiscovery([]string{addr1, addr2})
+	xc := NewXClient(d, registry.RoundRobinSelect, nil)
+	defer xc.Close()
+
+	var reply int
+	if err := xc.Broadcast(context.Background(), "Foo.Sum", rpctest.Args{Num1: 1, Num2: 2}, &reply); err != nil || reply != 3 {
+		t.Fatalf("broadcast = %d, %v", reply, err)
+	}
+	clients := cached(xc)
+	if len(clients) != 2 {
+		t.Fatalf("%d clients cached, want 2", len(clients))
+	}
+
+	_ = d.Update([]string{addr1})
+	if _, ok := cached(xc)[addr2]; ok {
+		t.Fatal("client of the removed server is still cached")
+	}
+	if clients[addr2].IsAvailable() {
+		t.Fatal("client of the removed server isn't closed")
+	}
+	if !clients[addr1].IsAvailable() {
+		t.Fatal("client of the kept server is closed")
+	}
+	for i := 0; i < 3; i++ {
+		if err := xc.Call(context.Background(), "Foo.Sum", rpctest.Args{Num1: i, Num2: 1}, &reply); err != nil || reply != i+1 {
+			t.Fatalf("call %d = %d, %v", i, reply, err)
+		}
+	}
+}
+
+func TestClosed(t *testing.T) {
+	addr := startServer(t)
+	xc := NewXClient(registry.NewStaticDiscovery([]string{addr}), registry.RandomSelect, nil)
+	_ = xc.Close()
+	var reply int
+	if err := xc.Call(context.Background(), "Foo.Sum", rpctest.Args{}, &reply); err != rpc.ErrShutdown {
+		t.Fatalf("call after close err = %v, want ErrShutdown", err)
+	}
+}
+
+func TestHashKey(t *testing.T) {
+	args := rpctest.Args{Num1: 1, Num2: 2}
+	same := args
+	if hashKey(&args) != hashKey(&same) || hashKey(&args) != hashKey(args) {
+		t.Fatalf("keys of equal args differ: %s, %s, %s", hashKey(&args), hashKey(&same), hashKey(args))
+	}
+	if hashKey(&args) == hashKey(&rpctest.Args{Num1: 2, Num2: 1}) {
+		t.Fatal("keys of different args are equal")
+	}
+	if hashKey(nil) != "<nil>" || hashKey((*rpctest.Args)(nil)) != "<nil>" {
+		t.Fatalf("keys of nil = %s, %s", hashKey(nil), hashKey((*rpctest.Args)(nil)))
+	}
+}
@@ -66,6 +66,9 @@ func (c *Collection) Put(key []byte, value []byte) error {
 	if !c.tx.write {
 		return WriteInsideReadTxErr
 	}
+	if len(key) > maxItemSize || len(value) > maxItemSize {
+		return ItemTooLargeErr
+	}
 
 	i := newItem(key, value)
 
@@ -186,6 +189,7 @@ func (c *Collection) Remove(key []byte) error {
 	}
 
 	// Rebalance the nodes all the way up. Start From one node before the last and go all the way up. Exclude root.
+	// Items have variable sizes, so replacing or rotating an item may also leave a node too big, then it is split.
 	for i := len(ancestors) - 2; i >= 0; i-- {
 		pnode := ancestors[i]
 		node := ancestors[i+1]
@@ -194,18 +198,61 @@ func (c *Collection) Remove(key []byte) error {
 			if err != nil {
 				return err
 			}
+		} else if node.isOverPopulated() {
+			pnode.split(node, ancestorsIndexes[i+1])
 		}
 	}
 
 	rootNode = ancestors[0]
 	// If the root has no items after rebalancing, there's no need to save it because we ignore it.
 	if len(rootNode.items) == 0 && len(rootNode.childNodes) > 0 {
-		c.root = ancestors[1].pageNum
+		c.root = rootNode.childNodes[0]
+		c.tx.deleteNode(rootNode)
+	} else if rootNode.isOverPopulated() {
+		newRoot := c.tx.newNode([]*Item{}, []pgnum{rootNode.pageNum})
+		newRoot.split(rootNode, 0)
+		c.root = c.tx.writeNode(newRoot).pageNum
 	}
 
 	return nil
 }
 
+// ForEach calls fn for every item of the tree in ascending Key order, iteration stops at the first error returned by
+// fn. The tree must not be modified inside fn.
+func (c *Collection) ForEach(fn func(key, value []byte) error) error {
+	root, err := c.tx.getNode(c.root)
+	if err != nil {
+		return err
+	}
+	return c.forEach(root, fn)
+}
+
+func (c *Collection) forEach(n *Node, fn func(key, value []byte) error) error {
+	for i, item := range n.items {
+		if !n.isLeaf() {
+			child, err := c.tx.getNode(n.childNodes[i])
+			if err != nil {
+				return err
+			}
+			if err = c.forEach(child, fn); err != nil {
+				return err
+			}
+		}
+		if err := fn(item.Key, item.Value); err != nil {
+			return err
+		}
+	}
+
+	if n.isLeaf() {
+		return nil
+	}
+	child, err := c.tx.getNode(n.childNodes[len(n.childNodes)-1])
+	if err != nil {
+		return err
+	}
+	return c.forEach(child, fn)
+}
+
 // getNodes returns a list of nodes based on their indexes (the breadcrumbs) from the root
 //
 //	         p
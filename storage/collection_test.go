@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func openTestDB(t testing.TB, path string) *DB {
+	t.Helper()
+	options := *DefaultOptions
+	db, err := Open(path, &options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testKey(i int) []byte {
+	return []byte(fmt.Sprintf("key%05d", i))
+}
+
+func testValue(i int) []byte {
+	return bytes.Repeat([]byte{byte('a' + i%26)}, 100)
+}
+
+// checkCollection checks the collection holds exactly keys, in ascending order
+func checkCollection(t *testing.T, c *Collection, keys []int) {
+	t.Helper()
+	for _, i := range keys {
+		item, err := c.Find(testKey(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item == nil || !bytes.Equal(item.Value, testValue(i)) {
+			t.Fatalf("Find(%s) = %v", testKey(i), item)
+		}
+	}
+	n := 0
+	err := c.ForEach(func(key, value []byte) error {
+		if n >= len(keys) || !bytes.Equal(key, testKey(keys[n])) {
+			return fmt.Errorf("unexpected key %s at %d", key, n)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(keys) {
+		t.Fatalf("ForEach visited %d items, want %d", n, len(keys))
+	}
+}
+
+func isLeafRoot(t *testing.T, c *Collection) bool {
+	t.Helper()
+	root, err := c.tx.getNode(c.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root.isLeaf()
+}
+
+func TestCollectionSplitAndMerge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	db := openTestDB(t, path)
+
+	const count = 2000
+	var keys []int
+	tx := db.WriteTx()
+	c, err := tx.CreateCollection([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// insert out of order, so splits happen in the middle of nodes too
+	for i := 0; i < count; i++ {
+		k := i * 7 % count
+		if err = c.Put(testKey(k), testValue(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < count; i++ {
+		keys = append(keys, i)
+	}
+	if isLeafRoot(t, c) {
+		t.Fatal("root is a leaf after inserting, the tree was not split")
+	}
+	checkCollection(t, c, keys)
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// remove all keys but every tenth one, nodes are merged and rotated
+	tx = db.WriteTx()
+	if c, err = tx.GetCollection([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	keys = keys[:0]
+	for i := 0; i < count; i++ {
+		if i%10 == 0 {
+			keys = append(keys, i)
+			continue
+		}
+		if err = c.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkCollection(t, c, keys)
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the remaining keys fit in the root, the tree shrinks to a single leaf
+	tx = db.WriteTx()
+	if c, err = tx.GetCollection([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range keys[10:] {
+		if err = c.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys = keys[:10]
+	if !isLeafRoot(t, c) {
+		t.Fatal("root is not a leaf after removing, the tree was not merged")
+	}
+	checkCollection(t, c, keys)
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	db = openTestDB(t, path)
+	defer db.Close()
+	tx = db.ReadTx()
+	defer tx.Rollback()
+	if c, err = tx.GetCollection([]byte("test")); err != nil || c == nil {
+		t.Fatalf("GetCollection after reopen = %v, %v", c, err)
+	}
+	checkCollection(t, c, keys)
+}
+
+func TestCollectionItemTooLarge(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	tx := db.WriteTx()
+	defer tx.Rollback()
+	c, err := tx.CreateCollection([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = c.Put([]byte("key"), make([]byte, maxItemSize+1)); err != ItemTooLargeErr {
+		t.Fatalf("Put = %v, want %v", err, ItemTooLargeErr)
+	}
+	if err = c.Put([]byte("key"), make([]byte, maxItemSize)); err != nil {
+		t.Fatal(err)
+	}
+}
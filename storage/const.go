@@ -9,6 +9,12 @@ const (
 
 	collectionSize = 16
 	pageNumSize    = 8
+
+	// maxItemSize is the max length of a key or value, lengths are stored in one byte
+	maxItemSize = 255
 )
 
-var WriteInsideReadTxErr = errors.New("can't perform a write operation inside a read transaction")
+var (
+	WriteInsideReadTxErr = errors.New("can't perform a write operation inside a read transaction")
+	ItemTooLargeErr      = errors.New("key or value is longer than 255 bytes")
+)
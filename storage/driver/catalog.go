@@ -0,0 +1,316 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pedrogao/storage"
+)
+
+const (
+	// catalogCollection holds the definitions of tables
+	catalogCollection = "pedrodb_catalog"
+	// tableCollection is the prefix of collections holding rows of tables
+	tableCollection = "pedrodb_table_"
+	// masterTable is the read only table listing tables and indexes
+	masterTable = "pedrodb_master"
+)
+
+// txn is implemented by the read and write transactions of storage
+type txn interface {
+	GetCollection(name []byte) (*storage.Collection, error)
+	CreateCollection(name []byte) (*storage.Collection, error)
+	DeleteCollection(name []byte) error
+	Savepoint() (*storage.Savepoint, error)
+	RollbackTo(sp *storage.Savepoint)
+	Commit() error
+	Rollback()
+}
+
+type column struct {
+	Name    string
+	Type    string
+	NotNull bool   `json:",omitempty"`
+	Unique  bool   `json:",omitempty"`
+	Default string `json:",omitempty"`
+}
+
+type index struct {
+	Name    string
+	Columns []string
+	Unique  bool `json:",omitempty"`
+}
+
+// table is the definition of a table, rows of a table are keyed by the primary key,
+// or by a hidden row id if the table has no primary key
+type table struct {
+	Name       string
+	Columns    []column
+	PrimaryKey []string `json:",omitempty"`
+	NextRowID  int64
+	Indexes    []index `json:",omitempty"`
+
+	columns    map[string]int // lower case column name to index
+	primaryKey []int
+	affinities []affinity
+	defaults   []expr
+}
+
+func (t *table) init() error {
+	t.columns = make(map[string]int, len(t.Columns))
+	t.affinities = make([]affinity, len(t.Columns))
+	t.defaults = make([]expr, len(t.Columns))
+	for i, col := range t.Columns {
+		name := strings.ToLower(col.Name)
+		if _, ok := t.columns[name]; ok {
+			return fmt.Errorf("pedrodb: duplicate column name: %s", col.Name)
+		}
+		t.columns[name] = i
+		t.affinities[i] = affinityOf(col.Type)
+		if col.Default != "" {
+			x, err := parseExpr(col.Default)
+			if err != nil {
+				return err
+			}
+			t.defaults[i] = x
+		}
+	}
+	t.primaryKey = t.primaryKey[:0]
+	for _, name := range t.PrimaryKey {
+		i, err := t.column(name)
+		if err != nil {
+			return err
+		}
+		t.primaryKey = append(t.primaryKey, i)
+	}
+	return nil
+}
+
+func (t *table) column(name string) (int, error) {
+	i, ok := t.columns[strings.ToLower(name)]
+	if !ok {
+		return -1, fmt.Errorf("pedrodb: no such column: %s", name)
+	}
+	return i, nil
+}
+
+// rowID returns the index of the integer primary key, which is assigned automatically if it is NULL
+func (t *table) rowID() int {
+	if len(t.primaryKey) == 1 && t.affinities[t.primaryKey[0]] == affinityInteger {
+		return t.primaryKey[0]
+	}
+	return -1
+}
+
+func (t *table) columnNames() []string {
+	names := make([]string, len(t.Columns))
+	for i, col := range t.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// defaultValue evaluates the default value of column i
+func (t *table) defaultValue(i int) (driver.Value, error) {
+	if t.defaults[i] == nil {
+		return nil, nil
+	}
+	return eval(t.defaults[i], &env{})
+}
+
+func (t *table) decode(b []byte) ([]driver.Value, error) {
+	row, err := decodeRow(b, 0)
+	if err != nil {
+		return nil, err
+	}
+	// columns added after the row is written
+	for i := len(row); i < len(t.Columns); i++ {
+		v, err := t.defaultValue(i)
+		if err != nil {
+			return nil, err
+		}
+		row = append(row, v)
+	}
+	return row, nil
+}
+
+// prepare converts values of row by column types and checks constraints, it returns the key of row.
+// The integer primary key or the hidden row id is assigned if not given.
+func (t *table) prepare(row []driver.Value) ([]byte, int64, error) {
+	for i, v := range row {
+		row[i] = t.affinities[i].convert(v)
+	}
+
+	var id int64
+	if len(t.primaryKey) == 0 {
+		id = t.NextRowID
+		t.NextRowID++
+	} else if i := t.rowID(); i >= 0 {
+		switch v := row[i].(type) {
+		case nil:
+			row[i] = t.NextRowID
+			id = t.NextRowID
+			t.NextRowID++
+		case int64:
+			id = v
+			if v >= t.NextRowID {
+				t.NextRowID = v + 1
+			}
+		}
+	}
+
+	if err := t.check(row); err != nil {
+		return nil, 0, err
+	}
+	if len(t.primaryKey) == 0 {
+		key, err := encodeKey([]driver.Value{id})
+		return key, id, err
+	}
+	key, err := t.key(row)
+	return key, id, err
+}
+
+func (t *table) check(row []driver.Value) error {
+	for i, col := range t.Columns {
+		if row[i] == nil && col.NotNull {
+			return fmt.Errorf("pedrodb: NOT NULL constraint failed: %s.%s", t.Name, col.Name)
+		}
+	}
+	return nil
+}
+
+func (t *table) key(row []driver.Value) ([]byte, error) {
+	values := make([]driver.Value, len(t.primaryKey))
+	for i, j := range t.primaryKey {
+		values[i] = row[j]
+	}
+	return encodeKey(values)
+}
+
+func (t *table) uniqueError() error {
+	return fmt.Errorf("pedrodb: UNIQUE constraint failed: %s.%s", t.Name, strings.Join(t.PrimaryKey, ", "))
+}
+
+// catalog returns the collection of table definitions, it is nil in a read transaction of a new database
+func (e *executor) catalog() (*storage.Collection, error) {
+	c, err := e.tx.GetCollection([]byte(catalogCollection))
+	if err != nil || c != nil {
+		return c, err
+	}
+	c, err = e.tx.CreateCollection([]byte(catalogCollection))
+	if err == storage.WriteInsideReadTxErr {
+		return nil, nil
+	}
+	return c, err
+}
+
+func (e *executor) table(name string) (*table, error) {
+	t, err := e.findTable(name)
+	if err == nil && t == nil {
+		err = fmt.Errorf("pedrodb: no such table: %s", name)
+	}
+	return t, err
+}
+
+func (e *executor) findTable(name string) (*table, error) {
+	c, err := e.catalog()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	key, err := encodeKey([]driver.Value{name})
+	if err != nil {
+		return nil, err
+	}
+	b, ok, err := getChunked(c, key)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return decodeTable(b)
+}
+
+func (e *executor) tables() ([]*table, error) {
+	c, err := e.catalog()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	var tables []*table
+	err = scanChunked(c, func(_, value []byte) error {
+		t, err := decodeTable(value)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, t)
+		return nil
+	})
+	return tables, err
+}
+
+func decodeTable(b []byte) (*table, error) {
+	t := &table{}
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	return t, t.init()
+}
+
+func (e *executor) saveTable(t *table) error {
+	c, err := e.catalog()
+	if err != nil {
+		return err
+	}
+	key, err := encodeKey([]driver.Value{t.Name})
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	return putChunked(c, key, b)
+}
+
+func (e *executor) deleteTable(t *table) error {
+	c, err := e.catalog()
+	if err != nil {
+		return err
+	}
+	key, err := encodeKey([]driver.Value{t.Name})
+	if err != nil {
+		return err
+	}
+	if err = deleteChunked(c, key); err != nil {
+		return err
+	}
+	return e.tx.DeleteCollection([]byte(tableCollection + t.Name))
+}
+
+// rows returns the collection holding rows of table
+func (e *executor) rows(t *table) (*storage.Collection, error) {
+	c, err := e.tx.GetCollection([]byte(tableCollection + t.Name))
+	if err == nil && c == nil {
+		err = errCorrupted
+	}
+	return c, err
+}
+
+// master returns the definition and rows of the master table
+func (e *executor) master() (*table, []record, error) {
+	t := &table{Name: masterTable, Columns: []column{{Name: "type"}, {Name: "name"}, {Name: "tbl_name"}}}
+	if err := t.init(); err != nil {
+		return nil, nil, err
+	}
+	tables, err := e.tables()
+	if err != nil {
+		return nil, nil, err
+	}
+	var records []record
+	for _, table := range tables {
+		records = append(records, record{values: []driver.Value{"table", table.Name, table.Name}})
+		for _, index := range table.Indexes {
+			records = append(records, record{values: []driver.Value{"index", index.Name, table.Name}})
+		}
+	}
+	return t, records, nil
+}
@@ -0,0 +1,515 @@
+package driver
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pedrogao/storage"
+)
+
+//
+// encoding of keys, rows and values
+//
+
+const (
+	maxItemSize = 255
+	maxChunks   = 255
+)
+
+var (
+	errRowTooLarge = errors.New("pedrodb: row is too large")
+	errCorrupted   = errors.New("pedrodb: corrupted row")
+)
+
+// value tags of encoded rows
+const (
+	tagNull byte = iota
+	tagInt
+	tagFloat
+	tagFalse
+	tagTrue
+	tagString
+	tagBytes
+	tagTime
+)
+
+// encodeRow encodes the values of a row in order
+func encodeRow(values []driver.Value) ([]byte, error) {
+	var buf []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			buf = append(buf, tagNull)
+		case int64:
+			buf = append(buf, tagInt)
+			buf = appendVarint(buf, v)
+		case float64:
+			buf = append(buf, tagFloat)
+			buf = appendUint64(buf, math.Float64bits(v))
+		case bool:
+			if v {
+				buf = append(buf, tagTrue)
+			} else {
+				buf = append(buf, tagFalse)
+			}
+		case string:
+			buf = append(buf, tagString)
+			buf = appendUvarint(buf, uint64(len(v)))
+			buf = append(buf, v...)
+		case []byte:
+			buf = append(buf, tagBytes)
+			buf = appendUvarint(buf, uint64(len(v)))
+			buf = append(buf, v...)
+		case time.Time:
+			b, err := v.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			buf = append(buf, tagTime)
+			buf = appendUvarint(buf, uint64(len(b)))
+			buf = append(buf, b...)
+		default:
+			return nil, fmt.Errorf("pedrodb: unsupported value type %T", v)
+		}
+	}
+	return buf, nil
+}
+
+// decodeRow decodes the values of a row, missing trailing values are nil
+func decodeRow(buf []byte, n int) ([]driver.Value, error) {
+	values := make([]driver.Value, 0, n)
+	for len(buf) > 0 {
+		tag := buf[0]
+		buf = buf[1:]
+		switch tag {
+		case tagNull:
+			values = append(values, nil)
+		case tagInt:
+			v, size := binary.Varint(buf)
+			if size <= 0 {
+				return nil, errCorrupted
+			}
+			values = append(values, v)
+			buf = buf[size:]
+		case tagFloat:
+			if len(buf) < 8 {
+				return nil, errCorrupted
+			}
+			values = append(values, math.Float64frombits(binary.BigEndian.Uint64(buf)))
+			buf = buf[8:]
+		case tagFalse, tagTrue:
+			values = append(values, tag == tagTrue)
+		case tagString, tagBytes, tagTime:
+			size, n := binary.Uvarint(buf)
+			if n <= 0 || uint64(len(buf)-n) < size {
+				return nil, errCorrupted
+			}
+			b := buf[n : n+int(size)]
+			buf = buf[n+int(size):]
+			switch tag {
+			case tagString:
+				values = append(values, string(b))
+			case tagBytes:
+				values = append(values, append([]byte{}, b...))
+			default:
+				var t time.Time
+				if err := t.UnmarshalBinary(b); err != nil {
+					return nil, err
+				}
+				values = append(values, t)
+			}
+		default:
+			return nil, errCorrupted
+		}
+	}
+	for len(values) < n {
+		values = append(values, nil)
+	}
+	return values, nil
+}
+
+// encodeKey encodes primary key values so that the byte order of keys is the order of values,
+// the encoding of one value is never the prefix of another one.
+func encodeKey(values []driver.Value) ([]byte, error) {
+	var buf []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			return nil, errors.New("pedrodb: primary key must not be NULL")
+		case int64:
+			buf = append(buf, tagInt)
+			buf = appendUint64(buf, uint64(v)^1<<63)
+		case bool:
+			buf = append(buf, tagInt)
+			buf = appendUint64(buf, uint64(boolInt(v))^1<<63)
+		case float64:
+			bits := math.Float64bits(v)
+			if v >= 0 {
+				bits ^= 1 << 63
+			} else {
+				bits = ^bits
+			}
+			buf = append(buf, tagFloat)
+			buf = appendUint64(buf, bits)
+		case time.Time:
+			buf = append(buf, tagTime)
+			buf = appendUint64(buf, uint64(v.UnixNano())^1<<63)
+		case string:
+			buf = append(buf, tagString)
+			buf = appendEscaped(buf, []byte(v))
+		case []byte:
+			buf = append(buf, tagBytes)
+			buf = appendEscaped(buf, v)
+		default:
+			return nil, fmt.Errorf("pedrodb: unsupported value type %T", v)
+		}
+	}
+	// one byte is left for the chunk number
+	if len(buf) >= maxItemSize {
+		return nil, errors.New("pedrodb: primary key is too long")
+	}
+	return buf, nil
+}
+
+// appendEscaped appends b terminated by 0x00 0x01, 0x00 inside b is escaped as 0x00 0xff
+func appendEscaped(buf, b []byte) []byte {
+	for _, c := range b {
+		buf = append(buf, c)
+		if c == 0 {
+			buf = append(buf, 0xff)
+		}
+	}
+	return append(buf, 0, 1)
+}
+
+// Values longer than one item are split into chunks, the key of a chunk is the key followed by the chunk number,
+// and the first chunk starts with the number of chunks.
+
+func chunkKey(key []byte, i int) []byte {
+	return append(append(make([]byte, 0, len(key)+1), key...), byte(i))
+}
+
+func getChunked(c *storage.Collection, key []byte) ([]byte, bool, error) {
+	item, err := c.Find(chunkKey(key, 0))
+	if err != nil || item == nil {
+		return nil, false, err
+	}
+	n := int(item.Value[0])
+	value := append([]byte{}, item.Value[1:]...)
+	for i := 1; i < n; i++ {
+		item, err := c.Find(chunkKey(key, i))
+		if err != nil {
+			return nil, false, err
+		}
+		if item == nil {
+			return nil, false, errCorrupted
+		}
+		value = append(value, item.Value...)
+	}
+	return value, true, nil
+}
+
+func putChunked(c *storage.Collection, key, value []byte) error {
+	n := (len(value) + 1 + maxItemSize - 1) / maxItemSize
+	if n > maxChunks {
+		return errRowTooLarge
+	}
+	old, err := c.Find(chunkKey(key, 0))
+	if err != nil {
+		return err
+	}
+
+	chunk := append([]byte{byte(n)}, value[:min(len(value), maxItemSize-1)]...)
+	value = value[len(chunk)-1:]
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			chunk = value[:min(len(value), maxItemSize)]
+			value = value[len(chunk):]
+		}
+		if err = c.Put(chunkKey(key, i), chunk); err != nil {
+			return err
+		}
+	}
+
+	// remove the chunks left by the old value
+	if old != nil {
+		for i := n; i < int(old.Value[0]); i++ {
+			if err = c.Remove(chunkKey(key, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func deleteChunked(c *storage.Collection, key []byte) error {
+	item, err := c.Find(chunkKey(key, 0))
+	if err != nil || item == nil {
+		return err
+	}
+	for i := int(item.Value[0]) - 1; i >= 0; i-- {
+		if err = c.Remove(chunkKey(key, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanChunked calls fn for every value in key order
+func scanChunked(c *storage.Collection, fn func(key, value []byte) error) error {
+	var (
+		key   []byte
+		value []byte
+		n     int
+		i     int
+	)
+	return c.ForEach(func(k, v []byte) error {
+		if k[len(k)-1] == 0 {
+			key, value, n, i = append([]byte{}, k[:len(k)-1]...), append([]byte{}, v[1:]...), int(v[0]), 0
+		} else {
+			value = append(value, v...)
+		}
+		if i++; i == n {
+			return fn(key, value)
+		}
+		return nil
+	})
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutVarint(b[:], v)]...)
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	return append(buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+//
+// type affinity, values stored in a column are converted according to the declared type as sqlite does
+//
+
+type affinity int
+
+const (
+	affinityNone affinity = iota
+	affinityInteger
+	affinityReal
+	affinityNumeric
+	affinityText
+	affinityBool
+	affinityTime
+)
+
+func affinityOf(typ string) affinity {
+	typ = strings.ToUpper(typ)
+	switch {
+	case strings.Contains(typ, "INT"):
+		return affinityInteger
+	case strings.Contains(typ, "CHAR"), strings.Contains(typ, "CLOB"), strings.Contains(typ, "TEXT"):
+		return affinityText
+	case typ == "", strings.Contains(typ, "BLOB"):
+		return affinityNone
+	case strings.Contains(typ, "REAL"), strings.Contains(typ, "FLOA"), strings.Contains(typ, "DOUB"):
+		return affinityReal
+	case strings.Contains(typ, "BOOL"):
+		return affinityBool
+	case strings.Contains(typ, "DATE"), strings.Contains(typ, "TIME"):
+		return affinityTime
+	}
+	return affinityNumeric
+}
+
+var timeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (a affinity) convert(v driver.Value) driver.Value {
+	switch a {
+	case affinityInteger, affinityNumeric:
+		switch x := v.(type) {
+		case bool:
+			return boolInt(x)
+		case float64:
+			if x == math.Trunc(x) && math.Abs(x) < 1<<63 {
+				return int64(x)
+			}
+		case string:
+			if i, err := strconv.ParseInt(strings.TrimSpace(x), 10, 64); err == nil {
+				return i
+			}
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				return a.convert(f)
+			}
+		}
+	case affinityReal:
+		switch x := v.(type) {
+		case int64:
+			return float64(x)
+		case bool:
+			return float64(boolInt(x))
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(x), 64); err == nil {
+				return f
+			}
+		}
+	case affinityText:
+		switch x := v.(type) {
+		case int64:
+			return strconv.FormatInt(x, 10)
+		case float64:
+			return strconv.FormatFloat(x, 'g', -1, 64)
+		}
+	case affinityBool:
+		switch x := v.(type) {
+		case int64:
+			return x != 0
+		case float64:
+			return x != 0
+		case string:
+			if b, err := strconv.ParseBool(x); err == nil {
+				return b
+			}
+		}
+	case affinityTime:
+		if x, ok := v.(string); ok {
+			if t, ok := parseTime(x); ok {
+				return t
+			}
+		}
+	}
+	return v
+}
+
+func boolInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+//
+// comparison of values
+//
+
+// class orders values of different types: numbers < times < texts < blobs
+func class(v driver.Value) int {
+	switch v.(type) {
+	case int64, float64, bool:
+		return 1
+	case time.Time:
+		return 2
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// compare compares two non nil values
+func compare(a, b driver.Value) int {
+	if ca, cb := class(a), class(b); ca != cb {
+		// texts are compared with times if they are times
+		if s, ok := a.(string); ok && cb == 2 {
+			if t, ok := parseTime(s); ok {
+				return compare(t, b)
+			}
+		}
+		if s, ok := b.(string); ok && ca == 2 {
+			if t, ok := parseTime(s); ok {
+				return compare(a, t)
+			}
+		}
+		return ca - cb
+	}
+	switch a := a.(type) {
+	case int64, float64, bool:
+		x, xf, xIsFloat := number(a)
+		y, yf, yIsFloat := number(b)
+		if !xIsFloat && !yIsFloat {
+			return cmp(x < y, x > y)
+		}
+		if !xIsFloat {
+			xf = float64(x)
+		}
+		if !yIsFloat {
+			yf = float64(y)
+		}
+		return cmp(xf < yf, xf > yf)
+	case time.Time:
+		t := b.(time.Time)
+		return cmp(a.Before(t), a.After(t))
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return bytes.Compare(toBytes(a), toBytes(b))
+}
+
+func cmp(less, greater bool) int {
+	switch {
+	case less:
+		return -1
+	case greater:
+		return 1
+	}
+	return 0
+}
+
+// number returns the integer or float of a numeric value
+func number(v driver.Value) (int64, float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, 0, false
+	case bool:
+		return boolInt(v), 0, false
+	case float64:
+		return 0, v, true
+	}
+	return 0, 0, false
+}
+
+func toBytes(v driver.Value) []byte {
+	switch v := v.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	}
+	return []byte(fmt.Sprint(v))
+}
@@ -0,0 +1,395 @@
+// Package driver implements a database/sql driver named "pedrodb" on top of the storage engine,
+// so that the engine can be used by database/sql and orm without cgo:
+//
+//	import _ "github.com/pedrogao/storage/driver"
+//
+//	db, err := sql.Open("pedrodb", "/path/to/file.db")
+//
+// A small SQL subset is supported: CREATE/DROP TABLE, CREATE/DROP INDEX, ALTER TABLE ADD COLUMN,
+// INSERT with ON CONFLICT, SELECT from one table with WHERE, ORDER BY, LIMIT and OFFSET,
+// UPDATE and DELETE. Every table is a collection keyed by the primary key, rows are looked up directly
+// if WHERE restricts the primary key, otherwise the table is scanned.
+//
+// SAVEPOINT, RELEASE SAVEPOINT and ROLLBACK TO SAVEPOINT are supported in transactions.
+//
+// The storage locks the whole file by a readers-writer lock: a write transaction, explicit or of
+// one statement, blocks all other transactions including reads until it ends. BeginTx and statements
+// wait for the lock until their context is done, so set a deadline if transactions are long.
+//
+// Limitations: indexes are recorded but not used, and UNIQUE constraints other than the primary key
+// are not enforced.
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pedrogao/storage"
+)
+
+func init() {
+	sql.Register("pedrodb", &Driver{})
+}
+
+var (
+	errTxStarted  = errors.New("pedrodb: transaction already started")
+	errNoTx       = errors.New("pedrodb: savepoints need a transaction")
+	errNamedParam = errors.New("pedrodb: named parameters are not supported")
+)
+
+// Driver opens connections to the database file named by the data source name
+type Driver struct{}
+
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	db, err := openDB(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{db: db}, nil
+}
+
+// sharedDB is the database file shared by connections, the storage locks the whole file
+type sharedDB struct {
+	*storage.DB
+	path string
+	refs int
+}
+
+var (
+	mu  sync.Mutex
+	dbs = map[string]*sharedDB{}
+)
+
+func openDB(name string) (*sharedDB, error) {
+	path, err := filepath.Abs(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if db, ok := dbs[path]; ok {
+		db.refs++
+		return db, nil
+	}
+	options := *storage.DefaultOptions
+	db, err := storage.Open(path, &options)
+	if err != nil {
+		return nil, err
+	}
+	dbs[path] = &sharedDB{DB: db, path: path, refs: 1}
+	return dbs[path], nil
+}
+
+func (db *sharedDB) close() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if db.refs--; db.refs > 0 {
+		return nil
+	}
+	delete(dbs, db.path)
+	return db.Close()
+}
+
+type conn struct {
+	db *sharedDB
+	// tx is the explicit transaction, statements run in their own transactions if nil
+	tx txn
+	// savepoints of tx, from the outermost
+	savepoints []savepoint
+}
+
+type savepoint struct {
+	name string
+	sp   *storage.Savepoint
+}
+
+var (
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.StmtExecContext    = (*stmt)(nil)
+	_ driver.StmtQueryContext   = (*stmt)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+)
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	s, n, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{c: c, s: s, n: n}, nil
+}
+
+func (c *conn) Close() error {
+	if c.tx != nil {
+		c.tx.Rollback()
+		c.tx = nil
+		c.savepoints = nil
+	}
+	return c.db.close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+// BeginTx starts a read transaction if opts is read only, otherwise a write transaction
+// which blocks other transactions until it ends, ctx.Err() is returned if ctx is done
+// before the transaction starts
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, errTxStarted
+	}
+	t, err := c.start(ctx, opts.ReadOnly)
+	if err != nil {
+		return nil, err
+	}
+	c.tx = t
+	return &tx{c}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s, _, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return c.exec(ctx, s, values)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s, _, err := parse(query)
+	if err != nil {
+		return nil, err
+	}
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return c.query(ctx, s, values)
+}
+
+func (c *conn) exec(ctx context.Context, s statement, args []driver.Value) (driver.Result, error) {
+	if sp, ok := s.(*savepointStmt); ok {
+		return &result{}, c.savepoint(sp)
+	}
+	_, read := s.(*selectStmt)
+	t, auto, err := c.begin(ctx, read)
+	if err != nil {
+		return nil, err
+	}
+	res, err := (&executor{tx: t, args: args}).exec(s)
+	if err = c.end(t, auto, err); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *conn) query(ctx context.Context, s statement, args []driver.Value) (driver.Rows, error) {
+	sel, ok := s.(*selectStmt)
+	if !ok {
+		// statements other than SELECT return no rows
+		if _, err := c.exec(ctx, s, args); err != nil {
+			return nil, err
+		}
+		return &rows{}, nil
+	}
+	t, auto, err := c.begin(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	r, err := (&executor{tx: t, args: args}).query(sel)
+	if err = c.end(t, auto, err); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// savepoint saves, releases or rollbacks to a savepoint of the explicit transaction,
+// releasing or rollbacking to a savepoint releases savepoints after it
+func (c *conn) savepoint(s *savepointStmt) error {
+	if c.tx == nil {
+		return errNoTx
+	}
+	if s.op == "SAVEPOINT" {
+		sp, err := c.tx.Savepoint()
+		if err != nil {
+			return err
+		}
+		c.savepoints = append(c.savepoints, savepoint{name: s.name, sp: sp})
+		return nil
+	}
+
+	i := len(c.savepoints) - 1
+	for i >= 0 && !strings.EqualFold(c.savepoints[i].name, s.name) {
+		i--
+	}
+	if i < 0 {
+		return fmt.Errorf("pedrodb: no such savepoint: %s", s.name)
+	}
+	if s.op == "RELEASE" {
+		c.savepoints = c.savepoints[:i]
+		return nil
+	}
+	// the savepoint is kept after rollback, like SQL
+	c.tx.RollbackTo(c.savepoints[i].sp)
+	c.savepoints = c.savepoints[:i+1]
+	return nil
+}
+
+// begin returns the explicit transaction, or starts a transaction for one statement
+func (c *conn) begin(ctx context.Context, read bool) (txn, bool, error) {
+	if c.tx != nil {
+		return c.tx, false, nil
+	}
+	t, err := c.start(ctx, read)
+	return t, true, err
+}
+
+// start starts a transaction, waiting for the lock of storage until ctx is done,
+// the transaction started after ctx is done is rolled back
+func (c *conn) start(ctx context.Context, read bool) (txn, error) {
+	begin := func() txn {
+		if read {
+			return c.db.ReadTx()
+		}
+		return c.db.WriteTx()
+	}
+	if ctx.Done() == nil {
+		return begin(), nil
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	started := make(chan txn, 1)
+	go func() {
+		started <- begin()
+	}()
+	select {
+	case t := <-started:
+		return t, nil
+	case <-ctx.Done():
+		go func() {
+			(<-started).Rollback()
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+func (c *conn) end(t txn, auto bool, err error) error {
+	if !auto {
+		return err
+	}
+	if err != nil {
+		t.Rollback()
+		return err
+	}
+	return t.Commit()
+}
+
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for _, arg := range args {
+		if arg.Name != "" {
+			return nil, errNamedParam
+		}
+		values[arg.Ordinal-1] = arg.Value
+	}
+	return values, nil
+}
+
+type tx struct {
+	c *conn
+}
+
+func (t *tx) Commit() error {
+	err := t.c.tx.Commit()
+	t.c.tx = nil
+	t.c.savepoints = nil
+	return err
+}
+
+func (t *tx) Rollback() error {
+	t.c.tx.Rollback()
+	t.c.tx = nil
+	t.c.savepoints = nil
+	return nil
+}
+
+type stmt struct {
+	c *conn
+	s statement
+	n int
+}
+
+func (s *stmt) Close() error {
+	return nil
+}
+
+func (s *stmt) NumInput() int {
+	return s.n
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.c.exec(context.Background(), s.s, args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.c.query(context.Background(), s.s, args)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.exec(ctx, s.s, values)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	values, err := namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.query(ctx, s.s, values)
+}
+
+// rows are read entirely when the statement runs
+type rows struct {
+	columns []string
+	values  [][]driver.Value
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) Close() error {
+	r.values = nil
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
+	return nil
+}
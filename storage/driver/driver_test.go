@@ -0,0 +1,359 @@
+package driver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("pedrodb", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	mustExec(t, db, "CREATE TABLE users (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, age INTEGER)")
+	return db
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func mustExec(t *testing.T, db execer, query string, args ...any) sql.Result {
+	t.Helper()
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return result
+}
+
+type queryer interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// names returns the first column of the rows as strings
+func names(t *testing.T, db queryer, query string, args ...any) []string {
+	t.Helper()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	defer rows.Close()
+	var names []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func insertUsers(t *testing.T, db execer) {
+	t.Helper()
+	mustExec(t, db, "INSERT INTO users (name, age) VALUES (?, ?), (?, ?), (?, ?)", "Tom", 18, "Sam", 25, "Amy", 30)
+}
+
+func TestCreateAndDropTable(t *testing.T) {
+	db := openTestDB(t)
+
+	if _, err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY)"); err == nil {
+		t.Fatal("creating an existing table succeeded")
+	}
+	mustExec(t, db, "CREATE TABLE IF NOT EXISTS users (id INTEGER PRIMARY KEY)")
+	got := names(t, db, "SELECT name FROM pedrodb_master WHERE type = 'table' AND name = ?", "users")
+	if !reflect.DeepEqual(got, []string{"users"}) {
+		t.Fatalf("tables = %v", got)
+	}
+
+	mustExec(t, db, "DROP TABLE users")
+	if _, err := db.Exec("DROP TABLE users"); err == nil {
+		t.Fatal("dropping a missing table succeeded")
+	}
+	mustExec(t, db, "DROP TABLE IF EXISTS users")
+	if got = names(t, db, "SELECT name FROM pedrodb_master WHERE type = 'table'"); len(got) != 0 {
+		t.Fatalf("tables after drop = %v", got)
+	}
+}
+
+func TestCreateAndDropIndex(t *testing.T) {
+	db := openTestDB(t)
+
+	mustExec(t, db, "CREATE INDEX idx_name ON users (name)")
+	mustExec(t, db, "CREATE UNIQUE INDEX IF NOT EXISTS idx_age ON users (age DESC)")
+	if _, err := db.Exec("CREATE INDEX idx_name ON users (name)"); err == nil {
+		t.Fatal("creating an existing index succeeded")
+	}
+	got := names(t, db, "SELECT name FROM pedrodb_master WHERE type = 'index' AND tbl_name = ? ORDER BY name", "users")
+	if !reflect.DeepEqual(got, []string{"idx_age", "idx_name"}) {
+		t.Fatalf("indexes = %v", got)
+	}
+
+	mustExec(t, db, "DROP INDEX idx_name")
+	mustExec(t, db, "DROP INDEX IF EXISTS idx_name")
+	if _, err := db.Exec("DROP INDEX idx_name"); err == nil {
+		t.Fatal("dropping a missing index succeeded")
+	}
+}
+
+func TestAlterTableAddColumn(t *testing.T) {
+	db := openTestDB(t)
+	insertUsers(t, db)
+
+	mustExec(t, db, "ALTER TABLE users ADD COLUMN email TEXT NOT NULL DEFAULT 'none'")
+	if _, err := db.Exec("ALTER TABLE users ADD COLUMN score INTEGER NOT NULL"); err == nil {
+		t.Fatal("adding a NOT NULL column without default succeeded")
+	}
+	if _, err := db.Exec("ALTER TABLE users ADD COLUMN email TEXT"); err == nil {
+		t.Fatal("adding a duplicate column succeeded")
+	}
+
+	got := names(t, db, "SELECT email FROM users")
+	if !reflect.DeepEqual(got, []string{"none", "none", "none"}) {
+		t.Fatalf("emails = %v", got)
+	}
+	mustExec(t, db, "INSERT INTO users (name, email) VALUES (?, ?)", "Bob", "bob@example.com")
+	if got = names(t, db, "SELECT email FROM users WHERE name = ?", "Bob"); !reflect.DeepEqual(got, []string{"bob@example.com"}) {
+		t.Fatalf("emails = %v", got)
+	}
+}
+
+func TestInsert(t *testing.T) {
+	db := openTestDB(t)
+
+	result := mustExec(t, db, "INSERT INTO users (name, age) VALUES (?, ?), (?, ?)", "Tom", 18, "Sam", 25)
+	if n, _ := result.RowsAffected(); n != 2 {
+		t.Fatalf("RowsAffected = %d, want 2", n)
+	}
+	if id, _ := result.LastInsertId(); id != 2 {
+		t.Fatalf("LastInsertId = %d, want 2", id)
+	}
+
+	if _, err := db.Exec("INSERT INTO users (id, name) VALUES (?, ?)", 1, "Amy"); err == nil ||
+		!strings.Contains(err.Error(), "UNIQUE constraint failed") {
+		t.Fatalf("inserting a duplicate key = %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users (age) VALUES (?)", 30); err == nil ||
+		!strings.Contains(err.Error(), "NOT NULL constraint failed") {
+		t.Fatalf("inserting a NULL name = %v", err)
+	}
+
+	mustExec(t, db, "INSERT INTO users (id, name) VALUES (?, ?) ON CONFLICT DO NOTHING", 1, "Amy")
+	mustExec(t, db, "INSERT INTO users (id, name, age) VALUES (?, ?, ?) ON CONFLICT (id) DO UPDATE SET age = excluded.age",
+		2, "Sam", 26)
+	var name string
+	var age int
+	if err := db.QueryRow("SELECT name, age FROM users WHERE id = ?", 1).Scan(&name, &age); err != nil || name != "Tom" {
+		t.Fatalf("user 1 = %s, %v", name, err)
+	}
+	if err := db.QueryRow("SELECT name, age FROM users WHERE id = ?", 2).Scan(&name, &age); err != nil || age != 26 {
+		t.Fatalf("user 2 age = %d, %v", age, err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	db := openTestDB(t)
+	insertUsers(t, db)
+
+	tests := []struct {
+		query string
+		args  []any
+		want  []string
+	}{
+		{"SELECT name FROM users WHERE id = ?", []any{2}, []string{"Sam"}},
+		{"SELECT name FROM users WHERE age > ? AND name <> ?", []any{18, "Amy"}, []string{"Sam"}},
+		{"SELECT name FROM users WHERE name IN (?, ?) ORDER BY name", []any{"Tom", "Amy"}, []string{"Amy", "Tom"}},
+		{"SELECT name FROM users WHERE name LIKE ?", []any{"%m"}, []string{"Tom", "Sam"}},
+		{"SELECT name FROM users ORDER BY age DESC", nil, []string{"Amy", "Sam", "Tom"}},
+		{"SELECT name FROM users ORDER BY age LIMIT ? OFFSET ?", []any{2, 1}, []string{"Sam", "Amy"}},
+		{"SELECT COUNT(*) FROM users WHERE age >= ?", []any{25}, []string{"2"}},
+	}
+	for _, tt := range tests {
+		if got := names(t, db, tt.query, tt.args...); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	if _, err := db.Query("SELECT name FROM missing"); err == nil {
+		t.Fatal("selecting from a missing table succeeded")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	db := openTestDB(t)
+	insertUsers(t, db)
+
+	result := mustExec(t, db, "UPDATE users SET age = age + 1 WHERE age < ?", 30)
+	if n, _ := result.RowsAffected(); n != 2 {
+		t.Fatalf("RowsAffected = %d, want 2", n)
+	}
+	got := names(t, db, "SELECT age FROM users ORDER BY id")
+	if !reflect.DeepEqual(got, []string{"19", "26", "30"}) {
+		t.Fatalf("ages = %v", got)
+	}
+
+	// updating the primary key moves the row
+	mustExec(t, db, "UPDATE users SET id = ? WHERE id = ?", 10, 1)
+	if got = names(t, db, "SELECT name FROM users WHERE id = ?", 10); !reflect.DeepEqual(got, []string{"Tom"}) {
+		t.Fatalf("user 10 = %v", got)
+	}
+	if _, err := db.Exec("UPDATE users SET id = ? WHERE id = ?", 2, 3); err == nil {
+		t.Fatal("updating to a duplicate key succeeded")
+	}
+}
+
+func TestDelete(t *testing.T) {
+	db := openTestDB(t)
+	insertUsers(t, db)
+
+	result := mustExec(t, db, "DELETE FROM users WHERE age > ?", 20)
+	if n, _ := result.RowsAffected(); n != 2 {
+		t.Fatalf("RowsAffected = %d, want 2", n)
+	}
+	if got := names(t, db, "SELECT name FROM users"); !reflect.DeepEqual(got, []string{"Tom"}) {
+		t.Fatalf("users = %v", got)
+	}
+	mustExec(t, db, "DELETE FROM users")
+	if got := names(t, db, "SELECT name FROM users"); len(got) != 0 {
+		t.Fatalf("users = %v", got)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	db := openTestDB(t)
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertUsers(t, tx)
+	if got := names(t, tx, "SELECT name FROM users ORDER BY id"); len(got) != 3 {
+		t.Fatalf("users in tx = %v", got)
+	}
+	if err = tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, db, "SELECT name FROM users"); len(got) != 0 {
+		t.Fatalf("users after rollback = %v", got)
+	}
+
+	if tx, err = db.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	insertUsers(t, tx)
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, db, "SELECT name FROM users ORDER BY id"); !reflect.DeepEqual(got, []string{"Tom", "Sam", "Amy"}) {
+		t.Fatalf("users after commit = %v", got)
+	}
+}
+
+func TestContextWhileLocked(t *testing.T) {
+	db := openTestDB(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insertUsers(t, tx)
+
+	// the write transaction blocks others, which give up once their context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = db.QueryContext(ctx, "SELECT name FROM users"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("query while locked err = %v, want context.DeadlineExceeded", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err = db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("begin while locked err = %v, want context.DeadlineExceeded", err)
+	}
+
+	// the transactions given up don't hold the lock after it's released
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tx.Exec("UPDATE users SET age = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, db, "SELECT name FROM users WHERE age = 1"); len(got) != 3 {
+		t.Fatalf("users after commit = %v", got)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	db := openTestDB(t)
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec("SAVEPOINT sp1"); err == nil {
+		t.Fatal("savepoint outside a transaction succeeded")
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mustExec(t, tx, "INSERT INTO users (name) VALUES (?)", "Tom")
+	mustExec(t, tx, "SAVEPOINT sp1")
+	mustExec(t, tx, "INSERT INTO users (name) VALUES (?)", "Sam")
+	mustExec(t, tx, `SAVEPOINT "sp2"`)
+	mustExec(t, tx, "INSERT INTO users (name) VALUES (?)", "Amy")
+
+	mustExec(t, tx, "ROLLBACK TO SAVEPOINT sp2")
+	if got := names(t, tx, "SELECT name FROM users ORDER BY id"); !reflect.DeepEqual(got, []string{"Tom", "Sam"}) {
+		t.Fatalf("users after ROLLBACK TO sp2 = %v", got)
+	}
+	// sp2 is kept after rolling back to it
+	mustExec(t, tx, "INSERT INTO users (name) VALUES (?)", "Bob")
+	mustExec(t, tx, "ROLLBACK TO sp2")
+	mustExec(t, tx, "RELEASE SAVEPOINT sp2")
+	if _, err = tx.Exec("ROLLBACK TO sp2"); err == nil || !strings.Contains(err.Error(), "no such savepoint") {
+		t.Fatalf("rolling back to a released savepoint = %v", err)
+	}
+
+	// releasing sp1 keeps its changes, rolling back to it drops savepoints after it
+	mustExec(t, tx, "SAVEPOINT sp3")
+	mustExec(t, tx, "ROLLBACK TO sp1")
+	if _, err = tx.Exec("RELEASE sp3"); err == nil {
+		t.Fatal("releasing a savepoint after the rolled back one succeeded")
+	}
+	mustExec(t, tx, "INSERT INTO users (name) VALUES (?)", "Amy")
+	mustExec(t, tx, "RELEASE sp1")
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(t, db, "SELECT name FROM users ORDER BY id"); !reflect.DeepEqual(got, []string{"Tom", "Amy"}) {
+		t.Fatalf("users after commit = %v", got)
+	}
+
+	// savepoints do not outlive their transaction
+	if tx, err = db.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec("ROLLBACK TO sp1"); err == nil {
+		t.Fatal("rolling back to a savepoint of a finished transaction succeeded")
+	}
+}
@@ -0,0 +1,376 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// env is the context evaluating an expression
+type env struct {
+	table *table
+	row   []driver.Value
+	// excluded is the row failed to insert, referred by excluded.column in ON CONFLICT DO UPDATE
+	excluded []driver.Value
+	args     []driver.Value
+}
+
+func (env *env) column(ref *columnRef) (driver.Value, error) {
+	if env.table == nil {
+		return nil, fmt.Errorf("pedrodb: no such column: %s", ref.name)
+	}
+	i, err := env.table.column(ref.name)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(ref.table, "excluded") && env.excluded != nil {
+		return env.excluded[i], nil
+	}
+	if ref.table != "" && !strings.EqualFold(ref.table, env.table.Name) {
+		return nil, fmt.Errorf("pedrodb: no such column: %s.%s", ref.table, ref.name)
+	}
+	return env.row[i], nil
+}
+
+// affinity returns the affinity of x if it is a column
+func (env *env) affinity(x expr) affinity {
+	ref, ok := x.(*columnRef)
+	if !ok || env.table == nil {
+		return affinityNone
+	}
+	i, ok := env.table.columns[strings.ToLower(ref.name)]
+	if !ok {
+		return affinityNone
+	}
+	return env.table.affinities[i]
+}
+
+// eval evaluates x, boolean results are true, false or nil for unknown
+func eval(x expr, env *env) (driver.Value, error) {
+	switch x := x.(type) {
+	case *literal:
+		return x.value, nil
+	case *param:
+		if x.index >= len(env.args) {
+			return nil, fmt.Errorf("pedrodb: missing argument %d", x.index+1)
+		}
+		return env.args[x.index], nil
+	case *columnRef:
+		return env.column(x)
+	case *unaryExpr:
+		v, err := eval(x.x, env)
+		if err != nil || v == nil {
+			return nil, err
+		}
+		if x.op == "NOT" {
+			ok, _ := truth(v)
+			return !ok, nil
+		}
+		return arithmetic("-", int64(0), v)
+	case *binaryExpr:
+		return evalBinary(x, env)
+	case *isNullExpr:
+		v, err := eval(x.x, env)
+		if err != nil {
+			return nil, err
+		}
+		return (v == nil) != x.not, nil
+	case *inExpr:
+		return evalIn(x, env)
+	case *caseExpr:
+		return evalCase(x, env)
+	case *callExpr:
+		return evalCall(x, env)
+	}
+	return nil, fmt.Errorf("pedrodb: unsupported expression %T", x)
+}
+
+func evalBinary(x *binaryExpr, env *env) (driver.Value, error) {
+	l, err := eval(x.l, env)
+	if err != nil {
+		return nil, err
+	}
+	switch x.op {
+	case "AND", "OR":
+		lok, lknown := truth(l)
+		// short circuit
+		if lknown && lok == (x.op == "OR") {
+			return lok, nil
+		}
+		r, err := eval(x.r, env)
+		if err != nil {
+			return nil, err
+		}
+		rok, rknown := truth(r)
+		if rknown && rok == (x.op == "OR") {
+			return rok, nil
+		}
+		if !lknown || !rknown {
+			return nil, nil
+		}
+		return rok, nil
+	}
+
+	r, err := eval(x.r, env)
+	if err != nil || l == nil || r == nil {
+		return nil, err
+	}
+	// a value compared with a column is converted to the type of the column
+	if a := env.affinity(x.l); a != affinityNone && env.affinity(x.r) == affinityNone {
+		r = a.convert(r)
+	} else if a = env.affinity(x.r); a != affinityNone && env.affinity(x.l) == affinityNone {
+		l = a.convert(l)
+	}
+
+	switch x.op {
+	case "=":
+		return class(l) == class(r) && compare(l, r) == 0, nil
+	case "<>":
+		return class(l) != class(r) || compare(l, r) != 0, nil
+	case "<":
+		return compare(l, r) < 0, nil
+	case "<=":
+		return compare(l, r) <= 0, nil
+	case ">":
+		return compare(l, r) > 0, nil
+	case ">=":
+		return compare(l, r) >= 0, nil
+	case "LIKE":
+		return like(text(l), text(r)), nil
+	}
+	return arithmetic(x.op, l, r)
+}
+
+func evalIn(x *inExpr, env *env) (driver.Value, error) {
+	v, err := eval(x.x, env)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	a := env.affinity(x.x)
+	unknown := false
+	for _, item := range x.list {
+		w, err := eval(item, env)
+		if err != nil {
+			return nil, err
+		}
+		if w == nil {
+			unknown = true
+			continue
+		}
+		if a != affinityNone {
+			w = a.convert(w)
+		}
+		if class(v) == class(w) && compare(v, w) == 0 {
+			return !x.not, nil
+		}
+	}
+	if unknown {
+		return nil, nil
+	}
+	return x.not, nil
+}
+
+func evalCase(x *caseExpr, env *env) (driver.Value, error) {
+	var operand driver.Value
+	if x.operand != nil {
+		var err error
+		if operand, err = eval(x.operand, env); err != nil {
+			return nil, err
+		}
+	}
+	for _, when := range x.whens {
+		v, err := eval(when.cond, env)
+		if err != nil {
+			return nil, err
+		}
+		var matched bool
+		if x.operand != nil {
+			matched = operand != nil && v != nil && class(operand) == class(v) && compare(operand, v) == 0
+		} else {
+			matched, _ = truth(v)
+		}
+		if matched {
+			return eval(when.then, env)
+		}
+	}
+	if x.els == nil {
+		return nil, nil
+	}
+	return eval(x.els, env)
+}
+
+func evalCall(x *callExpr, env *env) (driver.Value, error) {
+	if aggregates[x.name] {
+		return nil, fmt.Errorf("pedrodb: misuse of aggregate function %s()", x.name)
+	}
+	args := make([]driver.Value, len(x.args))
+	for i, arg := range x.args {
+		v, err := eval(arg, env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+
+	switch x.name {
+	case "CURRENT_TIMESTAMP":
+		return time.Now().UTC(), nil
+	case "COALESCE", "IFNULL":
+		for _, arg := range args {
+			if arg != nil {
+				return arg, nil
+			}
+		}
+		return nil, nil
+	case "LOWER", "UPPER", "LENGTH":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("pedrodb: wrong number of arguments to function %s()", x.name)
+		}
+		if args[0] == nil {
+			return nil, nil
+		}
+		switch x.name {
+		case "LOWER":
+			return strings.ToLower(text(args[0])), nil
+		case "UPPER":
+			return strings.ToUpper(text(args[0])), nil
+		}
+		if b, ok := args[0].([]byte); ok {
+			return int64(len(b)), nil
+		}
+		return int64(utf8.RuneCountInString(text(args[0]))), nil
+	}
+	return nil, fmt.Errorf("pedrodb: no such function: %s", x.name)
+}
+
+// truth returns the boolean of v, known is false if v is NULL
+func truth(v driver.Value) (ok bool, known bool) {
+	switch v := v.(type) {
+	case nil:
+		return false, false
+	case bool:
+		return v, true
+	case int64:
+		return v != 0, true
+	case float64:
+		return v != 0, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return err == nil && f != 0, true
+	}
+	return false, true
+}
+
+func arithmetic(op string, l, r driver.Value) (driver.Value, error) {
+	if !isNumeric(l) || !isNumeric(r) {
+		return nil, fmt.Errorf("pedrodb: invalid operands %v %s %v", l, op, r)
+	}
+	x, xf, xIsFloat := number(numeric(l))
+	y, yf, yIsFloat := number(numeric(r))
+
+	if !xIsFloat && !yIsFloat {
+		switch op {
+		case "+":
+			return x + y, nil
+		case "-":
+			return x - y, nil
+		case "*":
+			return x * y, nil
+		case "/", "%":
+			if y == 0 {
+				return nil, nil
+			}
+			if op == "/" {
+				return x / y, nil
+			}
+			return x % y, nil
+		}
+	}
+
+	if !xIsFloat {
+		xf = float64(x)
+	}
+	if !yIsFloat {
+		yf = float64(y)
+	}
+	switch op {
+	case "+":
+		return xf + yf, nil
+	case "-":
+		return xf - yf, nil
+	case "*":
+		return xf * yf, nil
+	case "/":
+		if yf == 0 {
+			return nil, nil
+		}
+		return xf / yf, nil
+	}
+	return nil, fmt.Errorf("pedrodb: unsupported operator %s", op)
+}
+
+func isNumeric(v driver.Value) bool {
+	return class(numeric(v)) == 1
+}
+
+// numeric converts a numeric text to a number
+func numeric(v driver.Value) driver.Value {
+	if s, ok := v.(string); ok {
+		return affinityNumeric.convert(s)
+	}
+	return v
+}
+
+// text returns v as a string
+func text(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.999999999-07:00")
+	}
+	return fmt.Sprint(v)
+}
+
+// like matches s against the pattern, % matches any sequence and _ matches one character,
+// letters are case insensitive
+func like(s, pattern string) bool {
+	s, pattern = strings.ToLower(s), strings.ToLower(pattern)
+	// the position after the last %, and the position in s it matched up to
+	star, matched := -1, 0
+	i, j := 0, 0
+	for i < len(s) {
+		switch {
+		case j < len(pattern) && pattern[j] == '%':
+			star, matched = j+1, i
+			j++
+		case j < len(pattern) && (pattern[j] == '_' || pattern[j] == s[i]):
+			if pattern[j] == '_' {
+				_, size := utf8.DecodeRuneInString(s[i:])
+				i += size
+			} else {
+				i++
+			}
+			j++
+		case star >= 0:
+			_, size := utf8.DecodeRuneInString(s[matched:])
+			matched += size
+			i, j = matched, star
+		default:
+			return false
+		}
+	}
+	for j < len(pattern) && pattern[j] == '%' {
+		j++
+	}
+	return j == len(pattern)
+}
@@ -0,0 +1,769 @@
+package driver
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pedrogao/storage"
+)
+
+// executor runs statements in a transaction
+type executor struct {
+	tx   txn
+	args []driver.Value
+}
+
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r *result) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r *result) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// record is a row with its key
+type record struct {
+	key    []byte
+	values []driver.Value
+}
+
+func (e *executor) exec(stmt statement) (driver.Result, error) {
+	switch stmt := stmt.(type) {
+	case *createTableStmt:
+		return &result{}, e.createTable(stmt)
+	case *dropTableStmt:
+		return &result{}, e.dropTable(stmt)
+	case *createIndexStmt:
+		return &result{}, e.createIndex(stmt)
+	case *dropIndexStmt:
+		return &result{}, e.dropIndex(stmt)
+	case *addColumnStmt:
+		return &result{}, e.addColumn(stmt)
+	case *insertStmt:
+		return e.insert(stmt)
+	case *updateStmt:
+		return e.update(stmt)
+	case *deleteStmt:
+		return e.delete(stmt)
+	case *selectStmt:
+		_, err := e.query(stmt)
+		return &result{}, err
+	}
+	return nil, fmt.Errorf("pedrodb: unsupported statement %T", stmt)
+}
+
+func (e *executor) createTable(stmt *createTableStmt) error {
+	if t, err := e.findTable(stmt.name); err != nil || t != nil {
+		if err == nil && !stmt.ifNotExists {
+			err = fmt.Errorf("pedrodb: table %s already exists", stmt.name)
+		}
+		return err
+	}
+	if strings.HasPrefix(strings.ToLower(stmt.name), "pedrodb_") {
+		return fmt.Errorf("pedrodb: table name %s is reserved", stmt.name)
+	}
+
+	t := &table{Name: stmt.name, PrimaryKey: stmt.primaryKey, NextRowID: 1}
+	for _, def := range stmt.columns {
+		t.Columns = append(t.Columns, column{
+			Name:    def.name,
+			Type:    def.typ,
+			NotNull: def.notNull,
+			Unique:  def.unique,
+			Default: def.dflt,
+		})
+	}
+	if err := t.init(); err != nil {
+		return err
+	}
+
+	name := []byte(tableCollection + t.Name)
+	if c, err := e.tx.GetCollection(name); err != nil {
+		return err
+	} else if c != nil {
+		if err = e.tx.DeleteCollection(name); err != nil {
+			return err
+		}
+	}
+	if _, err := e.tx.CreateCollection(name); err != nil {
+		return err
+	}
+	return e.saveTable(t)
+}
+
+func (e *executor) dropTable(stmt *dropTableStmt) error {
+	t, err := e.findTable(stmt.name)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		if stmt.ifExists {
+			return nil
+		}
+		return fmt.Errorf("pedrodb: no such table: %s", stmt.name)
+	}
+	return e.deleteTable(t)
+}
+
+func (e *executor) createIndex(stmt *createIndexStmt) error {
+	t, err := e.table(stmt.table)
+	if err != nil {
+		return err
+	}
+	if owner, _, err := e.findIndex(stmt.name); err != nil || owner != nil {
+		if err == nil && !stmt.ifNotExists {
+			err = fmt.Errorf("pedrodb: index %s already exists", stmt.name)
+		}
+		return err
+	}
+	for _, name := range stmt.columns {
+		if _, err = t.column(name); err != nil {
+			return err
+		}
+	}
+	t.Indexes = append(t.Indexes, index{Name: stmt.name, Columns: stmt.columns, Unique: stmt.unique})
+	return e.saveTable(t)
+}
+
+func (e *executor) dropIndex(stmt *dropIndexStmt) error {
+	t, i, err := e.findIndex(stmt.name)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		if stmt.ifExists {
+			return nil
+		}
+		return fmt.Errorf("pedrodb: no such index: %s", stmt.name)
+	}
+	t.Indexes = append(t.Indexes[:i], t.Indexes[i+1:]...)
+	return e.saveTable(t)
+}
+
+// findIndex returns the table owning the index and the position of the index
+func (e *executor) findIndex(name string) (*table, int, error) {
+	tables, err := e.tables()
+	if err != nil {
+		return nil, -1, err
+	}
+	for _, t := range tables {
+		for i, index := range t.Indexes {
+			if strings.EqualFold(index.Name, name) {
+				return t, i, nil
+			}
+		}
+	}
+	return nil, -1, nil
+}
+
+func (e *executor) addColumn(stmt *addColumnStmt) error {
+	t, err := e.table(stmt.table)
+	if err != nil {
+		return err
+	}
+	def := stmt.column
+	if def.notNull && def.dflt == "" {
+		return errors.New("pedrodb: cannot add a NOT NULL column with default value NULL")
+	}
+	t.Columns = append(t.Columns, column{
+		Name:    def.name,
+		Type:    def.typ,
+		NotNull: def.notNull,
+		Unique:  def.unique,
+		Default: def.dflt,
+	})
+	if err = t.init(); err != nil {
+		return err
+	}
+	return e.saveTable(t)
+}
+
+func (e *executor) insert(stmt *insertStmt) (driver.Result, error) {
+	t, err := e.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	c, err := e.rows(t)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]int, 0, len(t.Columns))
+	if len(stmt.columns) == 0 {
+		for i := range t.Columns {
+			columns = append(columns, i)
+		}
+	}
+	for _, name := range stmt.columns {
+		i, err := t.column(name)
+		if err != nil {
+			return nil, err
+		}
+		columns = append(columns, i)
+	}
+
+	res := &result{}
+	nextRowID := t.NextRowID
+	for _, exprs := range stmt.rows {
+		if len(exprs) != len(columns) {
+			return nil, fmt.Errorf("pedrodb: %d values for %d columns", len(exprs), len(columns))
+		}
+		row := make([]driver.Value, len(t.Columns))
+		given := make([]bool, len(t.Columns))
+		for i, x := range exprs {
+			if row[columns[i]], err = eval(x, &env{args: e.args}); err != nil {
+				return nil, err
+			}
+			given[columns[i]] = true
+		}
+		for i := range row {
+			if !given[i] {
+				if row[i], err = t.defaultValue(i); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		key, id, err := t.prepare(row)
+		if err != nil {
+			return nil, err
+		}
+		b, found, err := getChunked(c, key)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			if !stmt.onConflict {
+				return nil, t.uniqueError()
+			}
+			if len(stmt.conflict) == 0 {
+				continue
+			}
+			old, err := t.decode(b)
+			if err != nil {
+				return nil, err
+			}
+			if err = e.set(t, c, record{key, old}, stmt.conflict, row); err != nil {
+				return nil, err
+			}
+			res.rowsAffected++
+			continue
+		}
+
+		if err = e.put(c, key, row); err != nil {
+			return nil, err
+		}
+		res.rowsAffected++
+		res.lastInsertID = id
+	}
+
+	if t.NextRowID != nextRowID {
+		if err = e.saveTable(t); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (e *executor) put(c *storage.Collection, key []byte, row []driver.Value) error {
+	b, err := encodeRow(row)
+	if err != nil {
+		return err
+	}
+	return putChunked(c, key, b)
+}
+
+// set assigns columns of the record, excluded is the row failed to insert by ON CONFLICT DO UPDATE
+func (e *executor) set(t *table, c *storage.Collection, r record, sets []assignment, excluded []driver.Value) error {
+	row := append([]driver.Value{}, r.values...)
+	for _, set := range sets {
+		i, err := t.column(set.column)
+		if err != nil {
+			return err
+		}
+		if row[i], err = eval(set.value, &env{table: t, row: r.values, excluded: excluded, args: e.args}); err != nil {
+			return err
+		}
+	}
+	for i, v := range row {
+		row[i] = t.affinities[i].convert(v)
+	}
+	if err := t.check(row); err != nil {
+		return err
+	}
+
+	key := r.key
+	if len(t.primaryKey) > 0 {
+		var err error
+		if key, err = t.key(row); err != nil {
+			return err
+		}
+	}
+	if !bytes.Equal(key, r.key) {
+		if _, found, err := getChunked(c, key); err != nil {
+			return err
+		} else if found {
+			return t.uniqueError()
+		}
+		if err := deleteChunked(c, r.key); err != nil {
+			return err
+		}
+		if id := t.rowID(); id >= 0 {
+			if v, ok := row[id].(int64); ok && v >= t.NextRowID {
+				t.NextRowID = v + 1
+				if err := e.saveTable(t); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return e.put(c, key, row)
+}
+
+func (e *executor) update(stmt *updateStmt) (driver.Result, error) {
+	t, err := e.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	c, err := e.rows(t)
+	if err != nil {
+		return nil, err
+	}
+	records, err := e.scan(t, c, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if err = e.set(t, c, r, stmt.sets, nil); err != nil {
+			return nil, err
+		}
+	}
+	return &result{rowsAffected: int64(len(records))}, nil
+}
+
+func (e *executor) delete(stmt *deleteStmt) (driver.Result, error) {
+	t, err := e.table(stmt.table)
+	if err != nil {
+		return nil, err
+	}
+	c, err := e.rows(t)
+	if err != nil {
+		return nil, err
+	}
+	records, err := e.scan(t, c, stmt.where)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range records {
+		if err = deleteChunked(c, r.key); err != nil {
+			return nil, err
+		}
+	}
+	return &result{rowsAffected: int64(len(records))}, nil
+}
+
+// scan returns the records matching where, rows are looked up directly if where restricts the primary key
+func (e *executor) scan(t *table, c *storage.Collection, where expr) ([]record, error) {
+	var records []record
+	keys, err := e.lookupKeys(t, where)
+	if err != nil {
+		return nil, err
+	}
+	if keys != nil {
+		for _, key := range keys {
+			b, found, err := getChunked(c, key)
+			if err != nil {
+				return nil, err
+			}
+			if !found {
+				continue
+			}
+			row, err := t.decode(b)
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, record{key, row})
+		}
+	} else {
+		err = scanChunked(c, func(key, value []byte) error {
+			row, err := t.decode(value)
+			if err != nil {
+				return err
+			}
+			records = append(records, record{key, row})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return e.filter(t, records, where)
+}
+
+func (e *executor) filter(t *table, records []record, where expr) ([]record, error) {
+	if where == nil {
+		return records, nil
+	}
+	matched := records[:0]
+	for _, r := range records {
+		v, err := eval(where, &env{table: t, row: r.values, args: e.args})
+		if err != nil {
+			return nil, err
+		}
+		if ok, _ := truth(v); ok {
+			matched = append(matched, r)
+		}
+	}
+	return matched, nil
+}
+
+// lookupKeys returns the sorted keys if where is a conjunction containing `pk = value` or `pk IN (values...)`,
+// nil if the table must be scanned.
+func (e *executor) lookupKeys(t *table, where expr) ([][]byte, error) {
+	if len(t.primaryKey) != 1 {
+		return nil, nil
+	}
+	pk := t.primaryKey[0]
+
+	var values []expr
+	for _, x := range conjuncts(where) {
+		switch x := x.(type) {
+		case *binaryExpr:
+			if x.op != "=" {
+				continue
+			}
+			if t.isColumn(x.l, pk) && isConst(x.r) {
+				values = []expr{x.r}
+			} else if t.isColumn(x.r, pk) && isConst(x.l) {
+				values = []expr{x.l}
+			}
+		case *inExpr:
+			if x.not || !t.isColumn(x.x, pk) {
+				continue
+			}
+			ok := true
+			for _, item := range x.list {
+				ok = ok && isConst(item)
+			}
+			if ok {
+				values = x.list
+			}
+		}
+		if values != nil {
+			break
+		}
+	}
+	if values == nil {
+		return nil, nil
+	}
+
+	keys := make([][]byte, 0, len(values))
+	seen := make(map[string]bool, len(values))
+	for _, x := range values {
+		v, err := eval(x, &env{args: e.args})
+		if err != nil {
+			return nil, err
+		}
+		if v = t.affinities[pk].convert(v); v == nil {
+			continue
+		}
+		key, err := encodeKey([]driver.Value{v})
+		if err != nil {
+			return nil, err
+		}
+		if !seen[string(key)] {
+			seen[string(key)] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(keys[i], keys[j]) < 0
+	})
+	return keys, nil
+}
+
+func conjuncts(x expr) []expr {
+	if b, ok := x.(*binaryExpr); ok && b.op == "AND" {
+		return append(conjuncts(b.l), conjuncts(b.r)...)
+	}
+	if x == nil {
+		return nil
+	}
+	return []expr{x}
+}
+
+func isConst(x expr) bool {
+	switch x.(type) {
+	case *literal, *param:
+		return true
+	}
+	return false
+}
+
+func (t *table) isColumn(x expr, i int) bool {
+	ref, ok := x.(*columnRef)
+	if !ok || ref.table != "" && !strings.EqualFold(ref.table, t.Name) {
+		return false
+	}
+	j, ok := t.columns[strings.ToLower(ref.name)]
+	return ok && i == j
+}
+
+// query runs the select statement, the rows are read before the transaction ends
+func (e *executor) query(stmt *selectStmt) (*rows, error) {
+	var (
+		t       *table
+		records []record
+		err     error
+	)
+	if strings.EqualFold(stmt.table, masterTable) {
+		if t, records, err = e.master(); err == nil {
+			records, err = e.filter(t, records, stmt.where)
+		}
+	} else if t, err = e.table(stmt.table); err == nil {
+		var c *storage.Collection
+		if c, err = e.rows(t); err == nil {
+			records, err = e.scan(t, c, stmt.where)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var columns []string
+	for _, item := range stmt.items {
+		if item.star {
+			columns = append(columns, t.columnNames()...)
+		} else {
+			columns = append(columns, item.alias)
+		}
+	}
+
+	if isAggregate(stmt.items) {
+		row, err := e.aggregate(t, stmt.items, records)
+		if err != nil {
+			return nil, err
+		}
+		return e.limit(stmt, &rows{columns: columns, values: [][]driver.Value{row}})
+	}
+
+	if err = e.sort(t, stmt, records); err != nil {
+		return nil, err
+	}
+	values := make([][]driver.Value, 0, len(records))
+	for _, r := range records {
+		var row []driver.Value
+		for _, item := range stmt.items {
+			if item.star {
+				row = append(row, r.values...)
+				continue
+			}
+			v, err := eval(item.expr, &env{table: t, row: r.values, args: e.args})
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+		}
+		values = append(values, row)
+	}
+	return e.limit(stmt, &rows{columns: columns, values: values})
+}
+
+func (e *executor) sort(t *table, stmt *selectStmt, records []record) error {
+	if len(stmt.orders) == 0 {
+		return nil
+	}
+
+	// ORDER BY may refer to aliases of the selected expressions
+	orders := make([]expr, len(stmt.orders))
+	for i, order := range stmt.orders {
+		orders[i] = order.expr
+		if ref, ok := order.expr.(*columnRef); ok && ref.table == "" {
+			if _, err := t.column(ref.name); err != nil {
+				for _, item := range stmt.items {
+					if !item.star && strings.EqualFold(item.alias, ref.name) {
+						orders[i] = item.expr
+					}
+				}
+			}
+		}
+	}
+
+	keys := make([][]driver.Value, len(records))
+	for i, r := range records {
+		keys[i] = make([]driver.Value, len(orders))
+		for j, order := range orders {
+			v, err := eval(order, &env{table: t, row: r.values, args: e.args})
+			if err != nil {
+				return err
+			}
+			keys[i][j] = v
+		}
+	}
+
+	index := make([]int, len(records))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(a, b int) bool {
+		for j, order := range stmt.orders {
+			c := compareNullable(keys[index[a]][j], keys[index[b]][j])
+			if order.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	sorted := make([]record, len(records))
+	for i, j := range index {
+		sorted[i] = records[j]
+	}
+	copy(records, sorted)
+	return nil
+}
+
+func compareNullable(a, b driver.Value) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return compare(a, b)
+}
+
+func (e *executor) limit(stmt *selectStmt, r *rows) (*rows, error) {
+	if stmt.offset != nil {
+		offset, err := e.count(stmt.offset)
+		if err != nil {
+			return nil, err
+		}
+		if offset > int64(len(r.values)) {
+			offset = int64(len(r.values))
+		}
+		if offset > 0 {
+			r.values = r.values[offset:]
+		}
+	}
+	if stmt.limit != nil {
+		limit, err := e.count(stmt.limit)
+		if err != nil {
+			return nil, err
+		}
+		if limit >= 0 && limit < int64(len(r.values)) {
+			r.values = r.values[:limit]
+		}
+	}
+	return r, nil
+}
+
+func (e *executor) count(x expr) (int64, error) {
+	v, err := eval(x, &env{args: e.args})
+	if err != nil {
+		return 0, err
+	}
+	n, ok := affinityInteger.convert(v).(int64)
+	if !ok {
+		return 0, fmt.Errorf("pedrodb: LIMIT and OFFSET must be integers, got %v", v)
+	}
+	return n, nil
+}
+
+var aggregates = map[string]bool{"COUNT": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true}
+
+func isAggregate(items []selectItem) bool {
+	for _, item := range items {
+		if call, ok := item.expr.(*callExpr); ok && aggregates[call.name] {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregate computes one row from the records, other expressions are evaluated on the first record
+func (e *executor) aggregate(t *table, items []selectItem, records []record) ([]driver.Value, error) {
+	var row []driver.Value
+	for _, item := range items {
+		call, ok := item.expr.(*callExpr)
+		if !ok || !aggregates[call.name] {
+			if len(records) == 0 {
+				if item.star {
+					row = append(row, make([]driver.Value, len(t.Columns))...)
+				} else {
+					row = append(row, nil)
+				}
+				continue
+			}
+			if item.star {
+				row = append(row, records[0].values...)
+				continue
+			}
+			v, err := eval(item.expr, &env{table: t, row: records[0].values, args: e.args})
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+			continue
+		}
+
+		if call.star {
+			row = append(row, int64(len(records)))
+			continue
+		}
+		if len(call.args) != 1 {
+			return nil, fmt.Errorf("pedrodb: wrong number of arguments to function %s()", call.name)
+		}
+		var (
+			acc   driver.Value
+			count int64
+		)
+		for _, r := range records {
+			v, err := eval(call.args[0], &env{table: t, row: r.values, args: e.args})
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				continue
+			}
+			count++
+			switch {
+			case acc == nil:
+				acc = v
+			case call.name == "MIN" && compare(v, acc) < 0, call.name == "MAX" && compare(v, acc) > 0:
+				acc = v
+			case call.name == "SUM" || call.name == "AVG":
+				if acc, err = arithmetic("+", acc, v); err != nil {
+					return nil, err
+				}
+			}
+		}
+		switch call.name {
+		case "COUNT":
+			acc = count
+		case "AVG":
+			if acc != nil {
+				sum, err := arithmetic("+", acc, 0.0)
+				if err != nil {
+					return nil, err
+				}
+				acc = sum.(float64) / float64(count)
+			}
+		}
+		row = append(row, acc)
+	}
+	return row, nil
+}
@@ -0,0 +1,1032 @@
+package driver
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//
+// parser of the SQL subset understood by pedrodb
+//
+
+type tokenKind int
+
+const (
+	tokEOF    tokenKind = iota
+	tokIdent            // bare identifier or keyword
+	tokQuoted           // quoted identifier
+	tokString           // string literal
+	tokNumber           // numeric literal
+	tokParam            // ? placeholder
+	tokSymbol           // punctuation and operators
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '\'' || c == '"' || c == '`':
+			text, n, err := unquote(query[i:], c)
+			if err != nil {
+				return nil, err
+			}
+			kind := tokQuoted
+			if c == '\'' {
+				kind = tokString
+			}
+			tokens = append(tokens, token{kind, text, i})
+			i += n
+		case c == '?':
+			tokens = append(tokens, token{tokParam, "?", i})
+			i++
+		case isDigit(c) || c == '.' && i+1 < len(query) && isDigit(query[i+1]):
+			j := i
+			for j < len(query) && (isDigit(query[j]) || query[j] == '.' || query[j] == 'e' || query[j] == 'E' ||
+				(query[j] == '+' || query[j] == '-') && (query[j-1] == 'e' || query[j-1] == 'E')) {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, query[i:j], i})
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(query) && (isIdentStart(query[j]) || isDigit(query[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, query[i:j], i})
+			i = j
+		default:
+			symbol := string(c)
+			if i+1 < len(query) {
+				switch two := query[i : i+2]; two {
+				case "<=", ">=", "<>", "!=", "==":
+					symbol = two
+				}
+			}
+			if !strings.Contains("(),;*=<>!.+-/%", symbol[:1]) {
+				return nil, fmt.Errorf("pedrodb: unexpected character %q at %d", c, i)
+			}
+			tokens = append(tokens, token{tokSymbol, symbol, i})
+			i += len(symbol)
+		}
+	}
+	return append(tokens, token{tokEOF, "", len(query)}), nil
+}
+
+// unquote reads a quoted string from the start of s, doubled quotes are escaped quotes
+func unquote(s string, quote byte) (string, int, error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		if s[i] != quote {
+			sb.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			sb.WriteByte(quote)
+			i++
+			continue
+		}
+		return sb.String(), i + 1, nil
+	}
+	return "", 0, fmt.Errorf("pedrodb: unterminated quoted string %s", s)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// statements
+
+type statement interface{}
+
+type columnDef struct {
+	name          string
+	typ           string
+	primaryKey    bool
+	autoIncrement bool
+	notNull       bool
+	unique        bool
+	dflt          string // sql of the default value
+}
+
+type createTableStmt struct {
+	name        string
+	ifNotExists bool
+	columns     []columnDef
+	primaryKey  []string
+}
+
+type dropTableStmt struct {
+	name     string
+	ifExists bool
+}
+
+type createIndexStmt struct {
+	name        string
+	table       string
+	columns     []string
+	unique      bool
+	ifNotExists bool
+}
+
+type dropIndexStmt struct {
+	name     string
+	ifExists bool
+}
+
+type addColumnStmt struct {
+	table  string
+	column columnDef
+}
+
+type assignment struct {
+	column string
+	value  expr
+}
+
+type insertStmt struct {
+	table   string
+	columns []string
+	rows    [][]expr
+	// onConflict is set if ON CONFLICT clause is given, conflict is empty for DO NOTHING
+	onConflict bool
+	conflict   []assignment
+}
+
+type selectItem struct {
+	expr  expr
+	star  bool
+	alias string
+}
+
+type orderItem struct {
+	expr expr
+	desc bool
+}
+
+type selectStmt struct {
+	items  []selectItem
+	table  string
+	where  expr
+	orders []orderItem
+	limit  expr
+	offset expr
+}
+
+type updateStmt struct {
+	table string
+	sets  []assignment
+	where expr
+}
+
+type deleteStmt struct {
+	table string
+	where expr
+}
+
+// savepointStmt is SAVEPOINT, RELEASE SAVEPOINT or ROLLBACK TO SAVEPOINT of name
+type savepointStmt struct {
+	op   string // SAVEPOINT, RELEASE or ROLLBACK
+	name string
+}
+
+// expressions
+
+type expr interface{}
+
+type columnRef struct {
+	table string
+	name  string
+}
+
+type param struct {
+	index int
+}
+
+type literal struct {
+	value driver.Value
+}
+
+type unaryExpr struct {
+	op string
+	x  expr
+}
+
+type binaryExpr struct {
+	op   string
+	l, r expr
+}
+
+type isNullExpr struct {
+	x   expr
+	not bool
+}
+
+type inExpr struct {
+	x    expr
+	list []expr
+	not  bool
+}
+
+type whenClause struct {
+	cond, then expr
+}
+
+type caseExpr struct {
+	operand expr
+	whens   []whenClause
+	els     expr
+}
+
+type callExpr struct {
+	name string
+	star bool
+	args []expr
+}
+
+type parser struct {
+	query  string
+	tokens []token
+	pos    int
+	params int
+}
+
+// parse parses one statement, it returns the statement and the number of placeholders
+func parse(query string) (statement, int, error) {
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, 0, err
+	}
+	p := &parser{query: query, tokens: tokens}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, 0, err
+	}
+	p.symbol(";")
+	if p.peek().kind != tokEOF {
+		return nil, 0, p.errorf("unexpected %q", p.peek().text)
+	}
+	return stmt, p.params, nil
+}
+
+// parseExpr parses a standalone expression, eg. the default value of a column
+func parseExpr(s string) (expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{query: s, tokens: tokens}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return e, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("pedrodb: %s near position %d of %q", fmt.Sprintf(format, args...), p.peek().pos, p.query)
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// keyword consumes the keywords if all of them are next
+func (p *parser) keyword(words ...string) bool {
+	for i, word := range words {
+		if p.pos+i >= len(p.tokens) {
+			return false
+		}
+		t := p.tokens[p.pos+i]
+		if t.kind != tokIdent || !strings.EqualFold(t.text, word) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *parser) expectKeyword(words ...string) error {
+	if !p.keyword(words...) {
+		return p.errorf("expected %s", strings.Join(words, " "))
+	}
+	return nil
+}
+
+func (p *parser) symbol(s string) bool {
+	if t := p.peek(); t.kind == tokSymbol && t.text == s {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectSymbol(s string) error {
+	if !p.symbol(s) {
+		return p.errorf("expected %q", s)
+	}
+	return nil
+}
+
+func (p *parser) identifier() (string, error) {
+	t := p.peek()
+	if t.kind != tokIdent && t.kind != tokQuoted {
+		return "", p.errorf("expected identifier")
+	}
+	p.pos++
+	return t.text, nil
+}
+
+func (p *parser) identifierList() ([]string, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var names []string
+	for {
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		// ASC and DESC of index columns are ignored
+		_ = p.keyword("ASC") || p.keyword("DESC")
+		names = append(names, name)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	return names, p.expectSymbol(")")
+}
+
+func (p *parser) statement() (statement, error) {
+	switch {
+	case p.keyword("CREATE", "TABLE"):
+		return p.createTable()
+	case p.keyword("CREATE", "INDEX"):
+		return p.createIndex(false)
+	case p.keyword("CREATE", "UNIQUE", "INDEX"):
+		return p.createIndex(true)
+	case p.keyword("DROP", "TABLE"):
+		stmt := &dropTableStmt{ifExists: p.keyword("IF", "EXISTS")}
+		name, err := p.identifier()
+		stmt.name = name
+		return stmt, err
+	case p.keyword("DROP", "INDEX"):
+		stmt := &dropIndexStmt{ifExists: p.keyword("IF", "EXISTS")}
+		name, err := p.identifier()
+		stmt.name = name
+		return stmt, err
+	case p.keyword("ALTER", "TABLE"):
+		return p.alterTable()
+	case p.keyword("INSERT", "INTO"):
+		return p.insert()
+	case p.keyword("SELECT"):
+		return p.selectStmt()
+	case p.keyword("UPDATE"):
+		return p.update()
+	case p.keyword("DELETE", "FROM"):
+		return p.delete()
+	case p.keyword("SAVEPOINT"):
+		return p.savepoint("SAVEPOINT")
+	case p.keyword("RELEASE"):
+		p.keyword("SAVEPOINT")
+		return p.savepoint("RELEASE")
+	case p.keyword("ROLLBACK", "TO"):
+		p.keyword("SAVEPOINT")
+		return p.savepoint("ROLLBACK")
+	}
+	return nil, p.errorf("unsupported statement")
+}
+
+func (p *parser) savepoint(op string) (statement, error) {
+	name, err := p.identifier()
+	return &savepointStmt{op: op, name: name}, err
+}
+
+func (p *parser) createTable() (statement, error) {
+	stmt := &createTableStmt{ifNotExists: p.keyword("IF", "NOT", "EXISTS")}
+	name, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	stmt.name = name
+	if err = p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.keyword("PRIMARY", "KEY"):
+			if stmt.primaryKey, err = p.identifierList(); err != nil {
+				return nil, err
+			}
+		case p.keyword("UNIQUE"):
+			// unique constraints are not enforced
+			if _, err = p.identifierList(); err != nil {
+				return nil, err
+			}
+		default:
+			column, err := p.columnDef()
+			if err != nil {
+				return nil, err
+			}
+			if column.primaryKey {
+				stmt.primaryKey = []string{column.name}
+			}
+			stmt.columns = append(stmt.columns, column)
+		}
+		if !p.symbol(",") {
+			break
+		}
+	}
+	if err = p.expectSymbol(")"); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (p *parser) columnDef() (columnDef, error) {
+	var column columnDef
+	name, err := p.identifier()
+	if err != nil {
+		return column, err
+	}
+	column.name = name
+
+	// type is made of the words before the constraints, eg. `unsigned big int` or `varchar(255)`
+	var words []string
+	for t := p.peek(); t.kind == tokIdent && !isConstraint(t.text); t = p.peek() {
+		words = append(words, p.next().text)
+	}
+	if len(words) > 0 && p.symbol("(") {
+		start := p.peek().pos
+		for !p.symbol(")") {
+			if p.next().kind == tokEOF {
+				return column, p.errorf("expected \")\"")
+			}
+		}
+		words[len(words)-1] += "(" + p.query[start:p.tokens[p.pos-1].pos] + ")"
+	}
+	column.typ = strings.Join(words, " ")
+
+	for {
+		switch {
+		case p.keyword("PRIMARY", "KEY"):
+			column.primaryKey = true
+			_ = p.keyword("ASC") || p.keyword("DESC")
+		case p.keyword("AUTOINCREMENT"), p.keyword("AUTO_INCREMENT"):
+			column.autoIncrement = true
+		case p.keyword("NOT", "NULL"):
+			column.notNull = true
+		case p.keyword("NULL"):
+		case p.keyword("UNIQUE"):
+			column.unique = true
+		case p.keyword("DEFAULT"):
+			start := p.peek().pos
+			if _, err = p.unary(); err != nil {
+				return column, err
+			}
+			column.dflt = strings.TrimSpace(p.query[start:p.peek().pos])
+		default:
+			return column, nil
+		}
+	}
+}
+
+func isConstraint(word string) bool {
+	switch strings.ToUpper(word) {
+	case "PRIMARY", "NOT", "NULL", "UNIQUE", "DEFAULT", "AUTOINCREMENT", "AUTO_INCREMENT":
+		return true
+	}
+	return false
+}
+
+func (p *parser) createIndex(unique bool) (statement, error) {
+	stmt := &createIndexStmt{unique: unique, ifNotExists: p.keyword("IF", "NOT", "EXISTS")}
+	var err error
+	if stmt.name, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("ON"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	stmt.columns, err = p.identifierList()
+	return stmt, err
+}
+
+func (p *parser) alterTable() (statement, error) {
+	table, err := p.identifier()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("ADD"); err != nil {
+		return nil, err
+	}
+	_ = p.keyword("COLUMN")
+	column, err := p.columnDef()
+	if err != nil {
+		return nil, err
+	}
+	if column.primaryKey {
+		return nil, p.errorf("cannot add a PRIMARY KEY column")
+	}
+	return &addColumnStmt{table: table, column: column}, nil
+}
+
+func (p *parser) insert() (statement, error) {
+	stmt := &insertStmt{}
+	var err error
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if p.peek().text == "(" {
+		if stmt.columns, err = p.identifierList(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expectKeyword("VALUES"); err != nil {
+		return nil, err
+	}
+	for {
+		row, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		stmt.rows = append(stmt.rows, row)
+		if !p.symbol(",") {
+			break
+		}
+	}
+
+	if !p.keyword("ON", "CONFLICT") {
+		return stmt, nil
+	}
+	// conflicts are detected on primary key only
+	if p.peek().text == "(" {
+		if _, err = p.identifierList(); err != nil {
+			return nil, err
+		}
+	}
+	stmt.onConflict = true
+	switch {
+	case p.keyword("DO", "NOTHING"):
+	case p.keyword("DO", "UPDATE", "SET"):
+		stmt.conflict, err = p.assignments()
+	default:
+		err = p.errorf("expected DO NOTHING or DO UPDATE")
+	}
+	return stmt, err
+}
+
+func (p *parser) assignments() ([]assignment, error) {
+	var sets []assignment
+	for {
+		column, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectSymbol("="); err != nil {
+			return nil, err
+		}
+		value, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, assignment{column, value})
+		if !p.symbol(",") {
+			return sets, nil
+		}
+	}
+}
+
+func (p *parser) exprList() ([]expr, error) {
+	if err := p.expectSymbol("("); err != nil {
+		return nil, err
+	}
+	var list []expr
+	for {
+		e, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, e)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	return list, p.expectSymbol(")")
+}
+
+func (p *parser) selectStmt() (statement, error) {
+	stmt := &selectStmt{}
+	for {
+		if p.symbol("*") {
+			stmt.items = append(stmt.items, selectItem{star: true})
+		} else {
+			start := p.peek().pos
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			item := selectItem{expr: e, alias: strings.TrimSpace(p.query[start:p.peek().pos])}
+			if ref, ok := e.(*columnRef); ok {
+				item.alias = ref.name
+			}
+			if p.keyword("AS") || p.peek().kind == tokQuoted ||
+				p.peek().kind == tokIdent && !strings.EqualFold(p.peek().text, "FROM") {
+				if item.alias, err = p.identifier(); err != nil {
+					return nil, err
+				}
+			}
+			stmt.items = append(stmt.items, item)
+		}
+		if !p.symbol(",") {
+			break
+		}
+	}
+
+	var err error
+	if err = p.expectKeyword("FROM"); err != nil {
+		return nil, err
+	}
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if p.keyword("WHERE") {
+		if stmt.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("ORDER", "BY") {
+		for {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			order := orderItem{expr: e}
+			if p.keyword("DESC") {
+				order.desc = true
+			} else {
+				_ = p.keyword("ASC")
+			}
+			stmt.orders = append(stmt.orders, order)
+			if !p.symbol(",") {
+				break
+			}
+		}
+	}
+	if p.keyword("LIMIT") {
+		if stmt.limit, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.keyword("OFFSET") {
+		if stmt.offset, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, nil
+}
+
+func (p *parser) update() (statement, error) {
+	stmt := &updateStmt{}
+	var err error
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if err = p.expectKeyword("SET"); err != nil {
+		return nil, err
+	}
+	if stmt.sets, err = p.assignments(); err != nil {
+		return nil, err
+	}
+	if p.keyword("WHERE") {
+		stmt.where, err = p.expr()
+	}
+	return stmt, err
+}
+
+func (p *parser) delete() (statement, error) {
+	stmt := &deleteStmt{}
+	var err error
+	if stmt.table, err = p.identifier(); err != nil {
+		return nil, err
+	}
+	if p.keyword("WHERE") {
+		stmt.where, err = p.expr()
+	}
+	return stmt, err
+}
+
+// expr parses expressions, from the lowest precedence to the highest:
+// OR, AND, NOT, comparisons, + -, * / %, unary minus
+func (p *parser) expr() (expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{"OR", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (expr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{"AND", l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.keyword("NOT") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryExpr{"NOT", x}, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (expr, error) {
+	l, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	switch t := p.peek(); {
+	case t.kind == tokSymbol && strings.Contains(" = == <> != < <= > >= ", " "+t.text+" "):
+		p.pos++
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		op := t.text
+		switch op {
+		case "==":
+			op = "="
+		case "!=":
+			op = "<>"
+		}
+		return &binaryExpr{op, l, r}, nil
+	case p.keyword("IS", "NOT", "NULL"):
+		return &isNullExpr{l, true}, nil
+	case p.keyword("IS", "NULL"):
+		return &isNullExpr{l, false}, nil
+	}
+
+	not := p.keyword("NOT")
+	switch {
+	case p.keyword("IN"):
+		list, err := p.exprList()
+		if err != nil {
+			return nil, err
+		}
+		return &inExpr{l, list, not}, nil
+	case p.keyword("LIKE"):
+		r, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		return p.negate(&binaryExpr{"LIKE", l, r}, not), nil
+	case p.keyword("BETWEEN"):
+		lo, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("AND"); err != nil {
+			return nil, err
+		}
+		hi, err := p.additive()
+		if err != nil {
+			return nil, err
+		}
+		between := &binaryExpr{"AND", &binaryExpr{">=", l, lo}, &binaryExpr{"<=", l, hi}}
+		return p.negate(between, not), nil
+	}
+	if not {
+		return nil, p.errorf("expected IN, LIKE or BETWEEN after NOT")
+	}
+	return l, nil
+}
+
+func (p *parser) negate(e expr, not bool) expr {
+	if not {
+		return &unaryExpr{"NOT", e}
+	}
+	return e
+}
+
+func (p *parser) additive() (expr, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokSymbol && (t.text == "+" || t.text == "-"); t = p.peek() {
+		p.pos++
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{t.text, l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) multiplicative() (expr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokSymbol && (t.text == "*" || t.text == "/" || t.text == "%"); t = p.peek() {
+		p.pos++
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryExpr{t.text, l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.symbol("-") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		if lit, ok := x.(*literal); ok {
+			switch v := lit.value.(type) {
+			case int64:
+				return &literal{-v}, nil
+			case float64:
+				return &literal{-v}, nil
+			}
+		}
+		return &unaryExpr{"-", x}, nil
+	}
+	if p.symbol("+") {
+		return p.unary()
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tokNumber:
+		p.pos++
+		if i, err := strconv.ParseInt(t.text, 10, 64); err == nil {
+			return &literal{i}, nil
+		}
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %s", t.text)
+		}
+		return &literal{f}, nil
+	case tokString:
+		p.pos++
+		return &literal{t.text}, nil
+	case tokParam:
+		p.pos++
+		p.params++
+		return &param{p.params - 1}, nil
+	case tokSymbol:
+		if p.symbol("(") {
+			e, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			return e, p.expectSymbol(")")
+		}
+	case tokIdent:
+		switch {
+		case p.keyword("NULL"):
+			return &literal{nil}, nil
+		case p.keyword("TRUE"):
+			return &literal{true}, nil
+		case p.keyword("FALSE"):
+			return &literal{false}, nil
+		case p.keyword("CURRENT_TIMESTAMP"):
+			return &callExpr{name: "CURRENT_TIMESTAMP"}, nil
+		case p.keyword("CASE"):
+			return p.caseExpr()
+		}
+		if p.tokens[p.pos+1].text == "(" && p.tokens[p.pos+1].kind == tokSymbol {
+			return p.call()
+		}
+		fallthrough
+	case tokQuoted:
+		p.pos++
+		ref := &columnRef{name: t.text}
+		if p.symbol(".") {
+			name, err := p.identifier()
+			if err != nil {
+				return nil, err
+			}
+			ref.table, ref.name = ref.name, name
+		}
+		return ref, nil
+	}
+	return nil, p.errorf("unexpected %q", t.text)
+}
+
+func (p *parser) call() (expr, error) {
+	call := &callExpr{name: strings.ToUpper(p.next().text)}
+	p.pos++ // (
+	if p.symbol("*") {
+		call.star = true
+		return call, p.expectSymbol(")")
+	}
+	if p.symbol(")") {
+		return call, nil
+	}
+	for {
+		arg, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		call.args = append(call.args, arg)
+		if !p.symbol(",") {
+			break
+		}
+	}
+	return call, p.expectSymbol(")")
+}
+
+func (p *parser) caseExpr() (expr, error) {
+	e := &caseExpr{}
+	var err error
+	if !p.keyword("WHEN") {
+		if e.operand, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("WHEN"); err != nil {
+			return nil, err
+		}
+	}
+	for {
+		var when whenClause
+		if when.cond, err = p.expr(); err != nil {
+			return nil, err
+		}
+		if err = p.expectKeyword("THEN"); err != nil {
+			return nil, err
+		}
+		if when.then, err = p.expr(); err != nil {
+			return nil, err
+		}
+		e.whens = append(e.whens, when)
+		if !p.keyword("WHEN") {
+			break
+		}
+	}
+	if p.keyword("ELSE") {
+		if e.els, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	return e, p.expectKeyword("END")
+}
@@ -45,11 +45,15 @@ func (fr *freelist) serialize(buf []byte) []byte {
 	binary.LittleEndian.PutUint16(buf[pos:], uint16(fr.maxPage))
 	pos += 2
 
-	// released pages count
-	binary.LittleEndian.PutUint16(buf[pos:], uint16(len(fr.releasedPages)))
+	// released pages count, the pages not fitting in one page are leaked
+	releasedPages := fr.releasedPages
+	if capacity := (len(buf) - 4) / pageNumSize; len(releasedPages) > capacity {
+		releasedPages = releasedPages[:capacity]
+	}
+	binary.LittleEndian.PutUint16(buf[pos:], uint16(len(releasedPages)))
 	pos += 2
 
-	for _, page := range fr.releasedPages {
+	for _, page := range releasedPages {
 		binary.LittleEndian.PutUint64(buf[pos:], uint64(page))
 		pos += pageNumSize
 
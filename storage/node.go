@@ -213,6 +213,7 @@ func (n *Node) elementSize(i int) int {
 	size += len(n.items[i].Key)
 	size += len(n.items[i].Value)
 	size += pageNumSize // 8 is the pgnum size
+	size += 4           // offset, key length and value length
 	return size
 }
 
@@ -315,11 +316,15 @@ func (n *Node) split(nodeToSplit *Node, nodeToSplitIndex int) {
 	middleItem := nodeToSplit.items[splitIndex]
 	var newNode *Node
 
+	// The halves must not share the underlying arrays, otherwise appending to the modified node later overwrites
+	// the items of the new node.
+	items := append([]*Item{}, nodeToSplit.items[splitIndex+1:]...)
 	if nodeToSplit.isLeaf() {
-		newNode = n.writeNode(n.tx.newNode(nodeToSplit.items[splitIndex+1:], []pgnum{}))
+		newNode = n.writeNode(n.tx.newNode(items, []pgnum{}))
 		nodeToSplit.items = nodeToSplit.items[:splitIndex]
 	} else {
-		newNode = n.writeNode(n.tx.newNode(nodeToSplit.items[splitIndex+1:], nodeToSplit.childNodes[splitIndex+1:]))
+		childNodes := append([]pgnum{}, nodeToSplit.childNodes[splitIndex+1:]...)
+		newNode = n.writeNode(n.tx.newNode(items, childNodes))
 		nodeToSplit.items = nodeToSplit.items[:splitIndex]
 		nodeToSplit.childNodes = nodeToSplit.childNodes[:splitIndex+1]
 	}
@@ -408,8 +413,8 @@ func (n *Node) removeItemFromInternal(index int) ([]int, error) {
 	}
 
 	for !aNode.isLeaf() {
-		traversingIndex := len(n.childNodes) - 1
-		aNode, err = n.getNode(n.childNodes[traversingIndex])
+		traversingIndex := len(aNode.childNodes) - 1
+		aNode, err = aNode.getNode(aNode.childNodes[traversingIndex])
 		if err != nil {
 			return nil, err
 		}
@@ -507,5 +512,10 @@ func (n *Node) merge(bNode *Node, bNodeIndex int) error {
 	}
 	n.writeNodes(aNode, n)
 	n.tx.db.deleteNode(bNode.pageNum)
+
+	// The merged items may not fit in one page
+	if aNode.isOverPopulated() {
+		n.split(aNode, bNodeIndex-1)
+	}
 	return nil
 }
@@ -1,13 +1,20 @@
 package storage
 
+import "bytes"
+
 // tx transaction implement based page
 type tx struct {
 	// dirty b-tree nodes
 	dirtyNodes map[pgnum]*Node
 	// pages will delete when tx commit
 	pagesToDelete []pgnum
-	// new pages allocated during the transaction. They will be released if rollback is called.
-	allocatedPageNums []pgnum
+	// collections used during the transaction, their roots and counters are saved when commit
+	collections map[string]*Collection
+	// root collection holding all the collections
+	root *Collection
+	// freelist before the transaction, restored if rollback is called
+	maxPage       pgnum
+	releasedPages []pgnum
 	// write or read mode
 	write bool
 	// associate db instance
@@ -16,13 +23,18 @@ type tx struct {
 
 // newTx create transaction underlying db with write mode or not
 func newTx(db *DB, write bool) *tx {
-	return &tx{
-		map[pgnum]*Node{},
-		make([]pgnum, 0),
-		make([]pgnum, 0),
-		write,
-		db,
+	t := &tx{
+		dirtyNodes:    map[pgnum]*Node{},
+		pagesToDelete: make([]pgnum, 0),
+		collections:   map[string]*Collection{},
+		write:         write,
+		db:            db,
+	}
+	if write {
+		t.maxPage = db.maxPage
+		t.releasedPages = append([]pgnum{}, db.releasedPages...)
 	}
+	return t
 }
 
 func (tx *tx) newNode(items []*Item, childNodes []pgnum) *Node {
@@ -31,8 +43,6 @@ func (tx *tx) newNode(items []*Item, childNodes []pgnum) *Node {
 	node.childNodes = childNodes
 	node.pageNum = tx.db.getNextPage()
 	node.tx = tx
-
-	node.tx.allocatedPageNums = append(node.tx.allocatedPageNums, node.pageNum)
 	return node
 }
 
@@ -67,19 +77,49 @@ func (tx *tx) Rollback() {
 
 	tx.dirtyNodes = nil
 	tx.pagesToDelete = nil
-	for _, pageNum := range tx.allocatedPageNums {
-		tx.db.freelist.releasePage(pageNum)
-	}
-	tx.allocatedPageNums = nil
+	tx.collections = nil
+	tx.root = nil
+	tx.db.maxPage = tx.maxPage
+	tx.db.releasedPages = tx.releasedPages
 	tx.db.rwlock.Unlock()
 }
 
+// Commit writes the changes to disk, the transaction is rolled back if any write fails
 func (tx *tx) Commit() error {
 	if !tx.write {
 		tx.db.rwlock.RUnlock()
 		return nil
 	}
 
+	if err := tx.commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	tx.dirtyNodes = nil
+	tx.pagesToDelete = nil
+	tx.collections = nil
+	tx.root = nil
+	tx.db.rwlock.Unlock()
+	return nil
+}
+
+func (tx *tx) commit() error {
+	rootCollection := tx.getRootCollection()
+	for name, collection := range tx.collections {
+		item, err := rootCollection.Find([]byte(name))
+		if err != nil {
+			return err
+		}
+		value := collection.serialize().Value
+		if item != nil && bytes.Equal(item.Value, value) {
+			continue
+		}
+		if err = rootCollection.Put(collection.name, value); err != nil {
+			return err
+		}
+	}
+
 	for _, node := range tx.dirtyNodes {
 		_, err := tx.db.writeNode(node)
 		if err != nil {
@@ -95,21 +135,99 @@ func (tx *tx) Commit() error {
 		return err
 	}
 
-	tx.dirtyNodes = nil
-	tx.pagesToDelete = nil
-	tx.allocatedPageNums = nil
-	tx.db.rwlock.Unlock()
+	if rootCollection.root != tx.db.root {
+		meta := *tx.db.meta
+		meta.root = rootCollection.root
+		if _, err = tx.db.writeMeta(&meta); err != nil {
+			return err
+		}
+		tx.db.root = meta.root
+	}
 	return nil
 }
 
+// Savepoint is the state of a write transaction, which is restored by RollbackTo
+type Savepoint struct {
+	dirtyNodes    map[pgnum]*Node
+	pagesToDelete []pgnum
+	collections   map[string]savedCollection
+	root          savedCollection
+	maxPage       pgnum
+	releasedPages []pgnum
+}
+
+// savedCollection is a collection with its fields when saved, which are restored in place
+type savedCollection struct {
+	c     *Collection
+	saved Collection
+}
+
+// Savepoint saves the state of the write transaction, dirty nodes are copied
+func (tx *tx) Savepoint() (*Savepoint, error) {
+	if !tx.write {
+		return nil, WriteInsideReadTxErr
+	}
+
+	sp := &Savepoint{
+		dirtyNodes:    cloneNodes(tx.dirtyNodes),
+		pagesToDelete: append([]pgnum{}, tx.pagesToDelete...),
+		collections:   make(map[string]savedCollection, len(tx.collections)),
+		maxPage:       tx.db.maxPage,
+		releasedPages: append([]pgnum{}, tx.db.releasedPages...),
+	}
+	for name, c := range tx.collections {
+		sp.collections[name] = savedCollection{c: c, saved: *c}
+	}
+	if tx.root != nil {
+		sp.root = savedCollection{c: tx.root, saved: *tx.root}
+	}
+	return sp, nil
+}
+
+// RollbackTo restores the state saved by sp, sp can be restored again
+func (tx *tx) RollbackTo(sp *Savepoint) {
+	tx.dirtyNodes = cloneNodes(sp.dirtyNodes)
+	tx.pagesToDelete = append([]pgnum{}, sp.pagesToDelete...)
+	tx.collections = make(map[string]*Collection, len(sp.collections))
+	for name, c := range sp.collections {
+		*c.c = c.saved
+		tx.collections[name] = c.c
+	}
+	tx.root = sp.root.c
+	if tx.root != nil {
+		*tx.root = sp.root.saved
+	}
+	tx.db.maxPage = sp.maxPage
+	tx.db.releasedPages = append([]pgnum{}, sp.releasedPages...)
+}
+
+func cloneNodes(nodes map[pgnum]*Node) map[pgnum]*Node {
+	cloned := make(map[pgnum]*Node, len(nodes))
+	for pageNum, node := range nodes {
+		cloned[pageNum] = &Node{
+			tx:         node.tx,
+			pageNum:    node.pageNum,
+			items:      append([]*Item{}, node.items...),
+			childNodes: append([]pgnum{}, node.childNodes...),
+		}
+	}
+	return cloned
+}
+
 func (tx *tx) getRootCollection() *Collection {
-	rootCollection := newEmptyCollection()
-	rootCollection.root = tx.db.root
-	rootCollection.tx = tx
-	return rootCollection
+	if tx.root == nil {
+		tx.root = newEmptyCollection()
+		tx.root.root = tx.db.root
+		tx.root.tx = tx
+	}
+	return tx.root
 }
 
 func (tx *tx) GetCollection(name []byte) (*Collection, error) {
+	if collection, ok := tx.collections[string(name)]; ok {
+		return collection, nil
+	}
+
 	rootCollection := tx.getRootCollection()
 	item, err := rootCollection.Find(name)
 	if err != nil {
@@ -123,6 +241,7 @@ func (tx *tx) GetCollection(name []byte) (*Collection, error) {
 	collection := newEmptyCollection()
 	collection.deserialize(item)
 	collection.tx = tx
+	tx.collections[string(name)] = collection
 	return collection, nil
 }
 
@@ -147,6 +266,7 @@ func (tx *tx) DeleteCollection(name []byte) error {
 		return WriteInsideReadTxErr
 	}
 
+	delete(tx.collections, string(name))
 	rootCollection := tx.getRootCollection()
 
 	return rootCollection.Remove(name)
@@ -163,5 +283,6 @@ func (tx *tx) createCollection(collection *Collection) (*Collection, error) {
 		return nil, err
 	}
 
+	tx.collections[string(collection.name)] = collection
 	return collection, nil
 }
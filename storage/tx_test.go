@@ -0,0 +1,166 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRollbackRestoresFreelist(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	maxPage := db.maxPage
+	tx := db.WriteTx()
+	c, err := tx.CreateCollection([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if err = c.Put(testKey(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if db.maxPage == maxPage {
+		t.Fatal("no page was allocated")
+	}
+	tx.Rollback()
+	if db.maxPage != maxPage {
+		t.Fatalf("maxPage after rollback = %d, want %d", db.maxPage, maxPage)
+	}
+
+	tx = db.ReadTx()
+	defer tx.Rollback()
+	if c, err = tx.GetCollection([]byte("test")); err != nil || c != nil {
+		t.Fatalf("GetCollection after rollback = %v, %v", c, err)
+	}
+}
+
+func TestReleasedPagesAreReused(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	tx := db.WriteTx()
+	c, err := tx.CreateCollection([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		if err = c.Put(testKey(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = db.WriteTx()
+	if c, err = tx.GetCollection([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 490; i++ {
+		if err = c.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	released := len(db.releasedPages)
+	if released == 0 {
+		t.Fatal("no page was released after merging")
+	}
+
+	maxPage := db.maxPage
+	tx = db.WriteTx()
+	if c, err = tx.GetCollection([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		if err = c.Put(testKey(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(db.releasedPages) >= released {
+		t.Fatalf("released pages = %d, want less than %d", len(db.releasedPages), released)
+	}
+	if db.maxPage != maxPage {
+		t.Fatalf("maxPage = %d, want %d, released pages are used first", db.maxPage, maxPage)
+	}
+}
+
+func TestSavepoint(t *testing.T) {
+	db := openTestDB(t, filepath.Join(t.TempDir(), "test.db"))
+	defer db.Close()
+
+	tx := db.ReadTx()
+	if _, err := tx.Savepoint(); err != WriteInsideReadTxErr {
+		t.Fatalf("Savepoint in read tx = %v, want %v", err, WriteInsideReadTxErr)
+	}
+	tx.Rollback()
+
+	tx = db.WriteTx()
+	c, err := tx.CreateCollection([]byte("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var keys []int
+	for i := 0; i < 100; i++ {
+		if err = c.Put(testKey(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, i)
+	}
+	sp, err := tx.Savepoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxPage := db.maxPage
+
+	// splits and merges after the savepoint are undone
+	for i := 100; i < 600; i++ {
+		if err = c.Put(testKey(i), testValue(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 50; i++ {
+		if err = c.Remove(testKey(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = tx.CreateCollection([]byte("other")); err != nil {
+		t.Fatal(err)
+	}
+	tx.RollbackTo(sp)
+	if db.maxPage != maxPage {
+		t.Fatalf("maxPage after RollbackTo = %d, want %d", db.maxPage, maxPage)
+	}
+	checkCollection(t, c, keys)
+
+	// the savepoint can be rolled back to again
+	if err = c.Put(testKey(100), testValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	tx.RollbackTo(sp)
+	checkCollection(t, c, keys)
+
+	if err = c.Put(testKey(100), testValue(100)); err != nil {
+		t.Fatal(err)
+	}
+	keys = append(keys, 100)
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = db.ReadTx()
+	defer tx.Rollback()
+	if c, err = tx.GetCollection([]byte("test")); err != nil {
+		t.Fatal(err)
+	}
+	checkCollection(t, c, keys)
+	if other, err := tx.GetCollection([]byte("other")); err != nil || other != nil {
+		t.Fatalf("GetCollection(other) = %v, %v, want nil", other, err)
+	}
+}